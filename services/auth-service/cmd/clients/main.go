@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+	"github.com/flowmate/auth-service/pkg/database"
+)
+
+const usage = `usage: clients <command> [flags]
+
+commands:
+  list                      show service clients
+  create -name NAME -audiences "AUD ..." [-scopes "SCOPE ..."] [-jwks FILE]
+                            register a service client; its secret is printed
+                            once, or with -jwks it uses private_key_jwt
+  delete CLIENT_ID          remove a service client`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	name := fs.String("name", "", "client name")
+	audiences := fs.String("audiences", "", "space separated audiences the client may request tokens for")
+	scopes := fs.String("scopes", "", "space separated scopes from OAUTH2_SCOPES, or "+models.ScopeProviderTokensRead)
+	jwksFile := fs.String("jwks", "", "JSON Web Key Set file with the client's public keys")
+	_ = fs.Parse(os.Args[2:])
+
+	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("database connection failed: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	manager := service.NewServiceClientManager(repository.NewOAuthClientRepository(db), cfg)
+
+	switch os.Args[1] {
+	case "list":
+	case "create":
+		req := &models.ServiceClientRequest{
+			Name:      *name,
+			Scopes:    strings.Fields(*scopes),
+			Audiences: strings.Fields(*audiences),
+		}
+		if *jwksFile != "" {
+			jwks, err := os.ReadFile(*jwksFile)
+			if err != nil {
+				log.Fatalf("reading jwks failed: %v", err)
+			}
+			req.JWKS = string(jwks)
+		}
+		client, err := manager.Register(ctx, req)
+		if err != nil {
+			log.Fatalf("create failed: %v", err)
+		}
+		fmt.Printf("client_id:     %s\n", client.ClientID)
+		if client.ClientSecret != "" {
+			fmt.Printf("client_secret: %s\n", client.ClientSecret)
+			fmt.Println("The secret is not stored and cannot be shown again.")
+		}
+		fmt.Println()
+	case "delete":
+		if fs.NArg() != 1 {
+			log.Fatal("delete requires a client id")
+		}
+		if err := manager.Delete(ctx, fs.Arg(0)); err != nil {
+			log.Fatalf("delete failed: %v", err)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	printClients(ctx, manager)
+}
+
+func printClients(ctx context.Context, manager service.ServiceClientManager) {
+	clients, err := manager.List(ctx)
+	if err != nil {
+		log.Fatalf("listing clients failed: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CLIENT_ID\tNAME\tAUTH\tAUDIENCES\tSCOPES\tCREATED")
+	for _, c := range clients {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.ClientID, c.Name, c.AuthMethod,
+			strings.Join(c.Audiences, " "), strings.Join(c.Scopes, " "), c.CreatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/keys"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+	"github.com/flowmate/auth-service/pkg/database"
+)
+
+const usage = `usage: keys <command> [flags]
+
+commands:
+  list                 show signing keys and their state
+  generate [-alg ALG]  create a pending key (published, not yet signing)
+  activate KID         switch signing to KID and retire the current key
+  rotate [-alg ALG]    generate a key that the running servers activate once
+                       JWKS caches have expired (5 minutes)
+  prune                delete retired keys whose tokens have all expired`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	alg := fs.String("alg", cfg.JWTSigningAlg, "signing algorithm (HS256, RS256, EdDSA)")
+	_ = fs.Parse(os.Args[2:])
+
+	db, err := database.NewPostgresDB(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("database connection failed: %v", err)
+	}
+	defer db.Close()
+
+	box, err := secrets.LoadBox(cfg)
+	if err != nil {
+		log.Fatalf("encryption key: %v", err)
+	}
+
+	ctx := context.Background()
+	ring := keys.NewRing(repository.NewSigningKeyRepository(db), box, cfg)
+	if err := ring.Load(ctx); err != nil {
+		log.Fatalf("loading signing keys failed: %v", err)
+	}
+
+	switch os.Args[1] {
+	case "list":
+	case "generate":
+		if _, err := ring.Generate(ctx, *alg); err != nil {
+			log.Fatalf("generate failed: %v", err)
+		}
+	case "activate":
+		if fs.NArg() != 1 {
+			log.Fatal("activate requires a key id")
+		}
+		if err := ring.Activate(ctx, fs.Arg(0)); err != nil {
+			log.Fatalf("activate failed: %v", err)
+		}
+	case "rotate":
+		if _, err := ring.Rotate(ctx, *alg); err != nil {
+			log.Fatalf("rotate failed: %v", err)
+		}
+	case "prune":
+		n, err := ring.Prune(ctx)
+		if err != nil {
+			log.Fatalf("prune failed: %v", err)
+		}
+		log.Printf("pruned %d keys", n)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	printKeys(ring)
+}
+
+func printKeys(ring *keys.Ring) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KID\tALG\tSTATE\tCREATED\tEXPIRES")
+	for _, k := range ring.Records() {
+		state := "retired"
+		switch {
+		case k.IsPending() && k.ActivateAt != nil:
+			state = "pending until " + k.ActivateAt.Format(time.RFC3339)
+		case k.IsPending():
+			state = "pending"
+		case k.IsActive():
+			state = "active"
+		}
+		expires := "-"
+		if k.ExpiresAt != nil {
+			expires = k.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.ID, k.Algorithm, state, k.CreatedAt.Format(time.RFC3339), expires)
+	}
+	w.Flush()
+}
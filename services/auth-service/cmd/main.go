@@ -7,14 +7,20 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 
 	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/events"
 	"github.com/flowmate/auth-service/internal/handlers"
+	"github.com/flowmate/auth-service/internal/keys"
+	"github.com/flowmate/auth-service/internal/mailer"
 	mid "github.com/flowmate/auth-service/internal/middleware"
+	"github.com/flowmate/auth-service/internal/oauth"
 	"github.com/flowmate/auth-service/internal/repository"
 	"github.com/flowmate/auth-service/internal/routes"
+	"github.com/flowmate/auth-service/internal/secrets"
 	"github.com/flowmate/auth-service/internal/service"
 	"github.com/flowmate/auth-service/pkg/database"
 	redisclient "github.com/flowmate/auth-service/pkg/redis"
@@ -35,11 +41,56 @@ func main() {
 
 	userRepo := repository.NewUserRepository(db)
 	tokenRepo := repository.NewTokenRepository(redis)
+	signingKeyRepo := repository.NewSigningKeyRepository(db)
 
-	authService := service.NewAuthService(userRepo, tokenRepo, cfg)
-	oauthService := service.NewOAuthService(userRepo, tokenRepo, cfg, authService)
+	box, err := secrets.LoadBox(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load encryption key: %v", err)
+	}
+
+	keyRing := keys.NewRing(signingKeyRepo, box, cfg)
+	if err := keyRing.Load(ctx); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	mailTransport, err := mailer.New(cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure mail transport: %v", err)
+	}
+	outbox := mailer.NewOutbox(repository.NewEmailOutboxRepository(db), mailTransport, box)
+
+	mfaService := service.NewMFAService(repository.NewMFARepository(db), userRepo, box)
+	emitter := events.NewLogEmitter()
+	webauthnRepo := repository.NewWebAuthnRepository(db)
+	webauthnService, err := service.NewWebAuthnService(webauthnRepo, userRepo, tokenRepo, emitter, cfg)
+	if err != nil {
+		log.Fatalf("Failed to configure WebAuthn: %v", err)
+	}
+	authService := service.NewAuthService(userRepo, tokenRepo, keyRing, emitter, outbox, secrets.LoadSigner(cfg), mfaService, webauthnService, cfg)
+	// A slow provider must not hold sign-ins, or the goroutines serving
+	// them, indefinitely.
+	oauthProviders := oauth.LoadRegistry(cfg, &http.Client{Timeout: 10 * time.Second})
+	providerTokenService := service.NewProviderTokenService(repository.NewProviderTokenRepository(db), oauthProviders, box)
+	oauthService := service.NewOAuthService(userRepo, tokenRepo, webauthnRepo, oauthProviders, providerTokenService, authService)
+
+	authorizationServer := service.NewAuthorizationServer(repository.NewOAuthClientRepository(db), userRepo, tokenRepo, authService, cfg)
+
+	sessionService := service.NewSessionService(tokenRepo)
+	patService := service.NewPersonalAccessTokenService(repository.NewPersonalAccessTokenRepository(db), userRepo, cfg)
+	userAccessService := service.NewUserAccessService(userRepo, cfg)
 
 	authHandler := handlers.NewAuthHandler(authService, oauthService, cfg)
+	sessionHandler := handlers.NewSessionHandler(sessionService)
+	mfaHandler := handlers.NewMFAHandler(mfaService)
+	identityHandler := handlers.NewIdentityHandler(oauthService, cfg)
+	webauthnHandler := handlers.NewWebAuthnHandler(authService, webauthnService, cfg)
+	oauth2Handler := handlers.NewOAuth2Handler(authService, authorizationServer, patService, cfg)
+	consentHandler := handlers.NewConsentHandler(authorizationServer)
+	oauthClientHandler := handlers.NewOAuthClientHandler(authorizationServer)
+	deviceHandler := handlers.NewDeviceHandler(authorizationServer)
+	patHandler := handlers.NewPersonalAccessTokenHandler(patService)
+	adminHandler := handlers.NewAdminHandler(userAccessService)
+	providerTokenHandler := handlers.NewProviderTokenHandler(providerTokenService)
 
 	app := fiber.New(fiber.Config{
 		ErrorHandler:   customErrorHandler,
@@ -52,14 +103,26 @@ func main() {
 	app.Use(mid.CORS(cfg.CORSOrigins))
 
 	rateLimiter := mid.NewRateLimiter(redis)
-	authMiddleware := mid.NewAuthMiddleware(cfg.JWTSecret)
+	authMiddleware := mid.NewAuthMiddleware(authService, patService, cfg)
 
 	app.Get("/health", handlers.HealthHandler("auth-service"))
-	routes.SetupAuthRoutes(app, authHandler, rateLimiter, authMiddleware)
+	app.Get("/.well-known/jwks.json", handlers.JWKSHandler(keyRing))
+	routes.SetupAuthRoutes(app, authHandler, sessionHandler, mfaHandler, identityHandler, consentHandler, oauthClientHandler, deviceHandler, patHandler, adminHandler, rateLimiter, authMiddleware)
+	routes.SetupWebAuthnRoutes(app, webauthnHandler, authMiddleware)
+	routes.SetupOAuth2Routes(app, oauth2Handler)
+	routes.SetupInternalRoutes(app, providerTokenHandler, authMiddleware)
 
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	go keyRing.Run(ctx)
+	go outbox.Run(ctx)
+	go func() {
+		if err := tokenRepo.MigrateSessionIndex(ctx); err != nil {
+			log.Printf("Session index migration failed: %v", err)
+		}
+	}()
+
 	go func() {
 		sigint := make(chan os.Signal, 1)
 		signal.Notify(sigint, os.Interrupt, syscall.SIGTERM)
@@ -17,24 +17,82 @@ type Config struct {
 	FrontendURL string
 
 	JWTSecret         string
+	JWTSigningAlg     string
+	JWTPrivateKeyFile string
+	JWTKeyID          string
 	JWTExpiryMinutes  int
 	RefreshExpiryDays int
 
+	EncryptionKey            string
+	KeyRotationIntervalHours int
+
+	DenylistFailurePolicy string
+	DenylistTimeoutMS     int
+
 	GitHubClientID     string
 	GitHubClientSecret string
 	GoogleClientID     string
 	GoogleClientSecret string
+	GitHubBaseURL      string
+	GitHubAPIURL       string
+	GoogleAuthURL      string
+	GoogleTokenURL     string
+	GoogleUserInfoURL  string
 	OAuthCallbackURL   string
+	OAuthTokenDelivery string
+	OIDCProviders      []OIDCProviderConfig
+
+	// GatewayClients lists the clients, such as an API gateway ending
+	// sessions on users' behalf, that may revoke tokens issued to anyone.
+	// Other clients may only revoke their own.
+	GatewayClients string
+
+	// IssuerURL is this service's public base URL, used as the issuer of ID
+	// tokens and in the OpenID discovery document. OAuth2Scopes lists the
+	// API scopes registered clients may request besides the OpenID ones.
+	IssuerURL    string
+	OAuth2Scopes string
+	// DefaultUserScopes are the API scopes every user's first-party tokens
+	// carry; an admin can grant a user more. It defaults to OAUTH2_SCOPES.
+	DefaultUserScopes string
+
+	// ServiceTokenExpiryMinutes is the lifetime of client_credentials
+	// tokens. ServiceAudience is the audience this service accepts service
+	// tokens for; other services using the middleware set their own.
+	ServiceTokenExpiryMinutes int
+	ServiceAudience           string
+
+	// DeviceClientIDs lists the first-party public clients, such as the
+	// CLI, allowed to sign users in with the device authorization grant.
+	DeviceClientIDs string
+
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins string
+
+	// Cookie session mode: SessionCookies keeps the refresh token (and,
+	// with AccessTokenCookie, the access token) in HttpOnly cookies instead
+	// of response bodies.
+	SessionCookies    bool
+	AccessTokenCookie bool
+	CookieDomain      string
+	CookieSameSite    string
 
 	CORSOrigins     string
 	BcryptCost      int
 	RateLimitPerMin int
 
-	SMTPHost     string
-	SMTPPort     string
-	SMTPUsername string
-	SMTPPassword string
-	FromEmail    string
+	SMTPHost      string
+	SMTPPort      string
+	SMTPUsername  string
+	SMTPPassword  string
+	FromEmail     string
+	MailTransport string
+	MailFileDir   string
+
+	UnverifiedUserPolicy      string
+	EmailVerificationTTLHours int
+	PasswordResetTTLMinutes   int
 }
 
 func Load() *Config {
@@ -48,24 +106,70 @@ func Load() *Config {
 		FrontendURL: getEnv("FRONTEND_URL", "http://localhost:3000"),
 
 		JWTSecret:         getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		JWTSigningAlg:     getEnv("JWT_SIGNING_ALG", "RS256"),
+		JWTPrivateKeyFile: getEnv("JWT_PRIVATE_KEY_FILE", ""),
+		JWTKeyID:          getEnv("JWT_KEY_ID", ""),
 		JWTExpiryMinutes:  getEnvInt("JWT_EXPIRY_MINUTES", 15),
 		RefreshExpiryDays: getEnvInt("REFRESH_EXPIRY_DAYS", 30),
 
+		EncryptionKey:            getEnv("ENCRYPTION_KEY", ""),
+		KeyRotationIntervalHours: getEnvInt("KEY_ROTATION_INTERVAL_HOURS", 720),
+
+		DenylistFailurePolicy: getEnv("DENYLIST_FAILURE_POLICY", "open"),
+		DenylistTimeoutMS:     getEnvInt("DENYLIST_TIMEOUT_MS", 100),
+
 		GitHubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 		GitHubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
 		GoogleClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
 		GoogleClientSecret: getEnv("GOOGLE_CLIENT_SECRET", ""),
+		GitHubBaseURL:      getEnv("GITHUB_BASE_URL", ""),
+		GitHubAPIURL:       getEnv("GITHUB_API_URL", ""),
+		GoogleAuthURL:      getEnv("GOOGLE_AUTH_URL", ""),
+		GoogleTokenURL:     getEnv("GOOGLE_TOKEN_URL", ""),
+		GoogleUserInfoURL:  getEnv("GOOGLE_USERINFO_URL", ""),
 		OAuthCallbackURL:   getEnv("OAUTH_CALLBACK_URL", "http://localhost:8001/api/v1/auth/oauth"),
+		OAuthTokenDelivery: getEnv("OAUTH_TOKEN_DELIVERY", "code"),
+		OIDCProviders:      loadOIDCProviders(getEnv("OIDC_PROVIDERS", "")),
+
+		GatewayClients: getEnv("OAUTH_GATEWAY_CLIENTS", ""),
+
+		IssuerURL:         strings.TrimRight(getEnv("ISSUER_URL", "http://localhost:8001"), "/"),
+		OAuth2Scopes:      getEnv("OAUTH2_SCOPES", ""),
+		DefaultUserScopes: getEnv("DEFAULT_USER_SCOPES", getEnv("OAUTH2_SCOPES", "")),
+
+		ServiceTokenExpiryMinutes: getEnvInt("SERVICE_TOKEN_EXPIRY_MINUTES", 5),
+		ServiceAudience:           getEnv("SERVICE_AUDIENCE", "auth-service"),
+
+		DeviceClientIDs: getEnv("DEVICE_CLIENT_IDS", "flowmate-cli"),
+
+		WebAuthnRPID:    getEnv("WEBAUTHN_RP_ID", ""),
+		WebAuthnRPName:  getEnv("WEBAUTHN_RP_NAME", "FlowMate"),
+		WebAuthnOrigins: getEnv("WEBAUTHN_ORIGINS", ""),
+
+		SessionCookies:    getEnvBool("SESSION_COOKIES", false),
+		AccessTokenCookie: getEnvBool("ACCESS_TOKEN_COOKIE", false),
+		CookieDomain:      getEnv("COOKIE_DOMAIN", ""),
+		CookieSameSite:    getEnv("COOKIE_SAME_SITE", "Strict"),
 
 		CORSOrigins:     getEnv("CORS_ORIGINS", "http://localhost:3000"),
 		BcryptCost:      getEnvInt("BCRYPT_COST", 12),
 		RateLimitPerMin: getEnvInt("RATE_LIMIT_PER_MIN", 100),
 
-		SMTPHost:     getEnv("SMTP_HOST", ""),
-		SMTPPort:     getEnv("SMTP_PORT", "587"),
-		SMTPUsername: getEnv("SMTP_USERNAME", ""),
-		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
-		FromEmail:    getEnv("FROM_EMAIL", "noreply@flowmate.dev"),
+		SMTPHost:      getEnv("SMTP_HOST", ""),
+		SMTPPort:      getEnv("SMTP_PORT", "587"),
+		SMTPUsername:  getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:  getEnv("SMTP_PASSWORD", ""),
+		FromEmail:     getEnv("FROM_EMAIL", "noreply@flowmate.dev"),
+		MailTransport: getEnv("MAIL_TRANSPORT", ""),
+		MailFileDir:   getEnv("MAIL_FILE_DIR", ""),
+
+		UnverifiedUserPolicy:      getEnv("UNVERIFIED_USER_POLICY", "restrict"),
+		EmailVerificationTTLHours: getEnvInt("EMAIL_VERIFICATION_TTL_HOURS", 24),
+		PasswordResetTTLMinutes:   getEnvInt("PASSWORD_RESET_TTL_MINUTES", 30),
+	}
+
+	if cfg.SessionCookies && os.Getenv("OAUTH_TOKEN_DELIVERY") == "" {
+		cfg.OAuthTokenDelivery = "cookie"
 	}
 
 	if cfg.DatabaseURL == "" {
@@ -93,6 +197,17 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvBool(key string, defaultValue bool) bool {
+	val := getEnv(key, "")
+	if val == "" {
+		return defaultValue
+	}
+	if b, err := strconv.ParseBool(val); err == nil {
+		return b
+	}
+	return defaultValue
+}
+
 func GetAllowedOrigins(origins string) []string {
 	parts := strings.Split(origins, ",")
 	out := make([]string, 0, len(parts))
@@ -104,3 +219,57 @@ func GetAllowedOrigins(origins string) []string {
 	}
 	return out
 }
+
+// OIDCProviderConfig is one OpenID Connect provider registration.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// loadOIDCProviders reads OIDC_PROVIDERS, a comma separated list of provider
+// names, and for each name the OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET
+// and optional _SCOPES variables. Incomplete entries are skipped with a
+// warning.
+func loadOIDCProviders(names string) []OIDCProviderConfig {
+	var out []OIDCProviderConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "github" || name == "google" || !validProviderName(name) {
+			log.Printf("OIDC_PROVIDERS: invalid provider name %q, skipping", name)
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			log.Printf("OIDC provider %q needs %sISSUER and %sCLIENT_ID, skipping", name, prefix, prefix)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func validProviderName(name string) bool {
+	if name == "" || len(name) > 50 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
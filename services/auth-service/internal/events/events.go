@@ -0,0 +1,45 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+const (
+	RefreshTokenReuse     = "refresh_token_reuse"
+	WebAuthnCloneDetected = "webauthn_clone_detected"
+)
+
+type SecurityEvent struct {
+	Type      string            `json:"type"`
+	UserID    string            `json:"user_id,omitempty"`
+	SessionID string            `json:"session_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	Time      time.Time         `json:"time"`
+}
+
+type Emitter interface {
+	Emit(ctx context.Context, event SecurityEvent)
+}
+
+type logEmitter struct{}
+
+// NewLogEmitter writes security events to the service log as single JSON
+// lines so they can be picked up by log-based alerting.
+func NewLogEmitter() Emitter {
+	return logEmitter{}
+}
+
+func (logEmitter) Emit(ctx context.Context, event SecurityEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("security_event marshal failed: %v", err)
+		return
+	}
+	log.Printf("security_event %s", payload)
+}
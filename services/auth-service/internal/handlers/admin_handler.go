@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// AdminHandler serves the endpoints reserved for users with the admin role.
+type AdminHandler struct {
+	access service.UserAccessService
+}
+
+func NewAdminHandler(access service.UserAccessService) *AdminHandler {
+	return &AdminHandler{access: access}
+}
+
+func (h *AdminHandler) GetUserAccess(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid user id")
+	}
+
+	access, err := h.access.Get(c.Context(), userID)
+	if err != nil {
+		return userAccessError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": access})
+}
+
+// UpdateUserAccess replaces the user's roles and scopes. The user's tokens
+// pick them up when next refreshed.
+func (h *AdminHandler) UpdateUserAccess(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid user id")
+	}
+
+	var payload models.UserAccessRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	access, err := h.access.Update(c.Context(), userID, &payload)
+	if err != nil {
+		return userAccessError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": access})
+}
+
+func userAccessError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidUserAccess):
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrUserNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
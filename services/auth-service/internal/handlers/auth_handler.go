@@ -1,19 +1,24 @@
 package handlers
 
 import (
-    "errors"
-    "fmt"
-    "net/http"
-    "net/url"
-    "strings"
-    "time"
-
-    "github.com/gofiber/fiber/v2"
-    "github.com/google/uuid"
-
-    "github.com/flowmate/auth-service/internal/config"
-    "github.com/flowmate/auth-service/internal/models"
-    "github.com/flowmate/auth-service/internal/service"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/keys"
+	mid "github.com/flowmate/auth-service/internal/middleware"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oidc"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
 )
 
 type AuthHandler struct {
@@ -32,14 +37,14 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return fiber.NewError(http.StatusBadRequest, "invalid payload")
 	}
 
-	resp, err := h.auth.Register(c.Context(), &input)
+	resp, err := h.auth.Register(requestContext(c), &input)
 	if err != nil {
 		return fiber.NewError(http.StatusBadRequest, err.Error())
 	}
 
 	return c.Status(http.StatusCreated).JSON(fiber.Map{
 		"success": true,
-		"data":    resp,
+		"data":    deliverSession(c, h.cfg, resp),
 	})
 }
 
@@ -49,36 +54,72 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return fiber.NewError(http.StatusBadRequest, "invalid payload")
 	}
 
-	resp, err := h.auth.Login(c.Context(), &input)
+	resp, err := h.auth.Login(requestContext(c), &input)
 	if err != nil {
 		status := http.StatusBadRequest
 		if errors.Is(err, service.ErrInvalidCredentials) {
 			status = http.StatusUnauthorized
+		} else if errors.Is(err, service.ErrEmailNotVerified) {
+			status = http.StatusForbidden
 		}
 		return fiber.NewError(status, err.Error())
 	}
 
 	return c.Status(http.StatusOK).JSON(fiber.Map{
 		"success": true,
-		"data":    resp,
+		"data":    deliverSession(c, h.cfg, resp),
 	})
 }
 
-func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
-	var payload models.RefreshTokenRequest
-	if err := c.BodyParser(&payload); err != nil {
+func (h *AuthHandler) VerifyMFA(c *fiber.Ctx) error {
+	var payload models.MFAVerifyRequest
+	if err := c.BodyParser(&payload); err != nil || payload.MFAToken == "" || payload.Code == "" {
 		return fiber.NewError(http.StatusBadRequest, "invalid payload")
 	}
 
-	resp, err := h.auth.RefreshToken(c.Context(), payload.RefreshToken)
+	resp, err := h.auth.VerifyMFA(requestContext(c), payload.MFAToken, payload.Code)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidMFAToken) || errors.Is(err, service.ErrInvalidMFACode) {
+			return fiber.NewError(http.StatusUnauthorized, err.Error())
+		}
+		if errors.Is(err, service.ErrEmailNotVerified) {
+			return fiber.NewError(http.StatusForbidden, err.Error())
+		}
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    deliverSession(c, h.cfg, resp),
+	})
+}
+
+func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
+	refreshToken, fromCookie, err := refreshTokenFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if fromCookie && !mid.ValidCSRF(c) {
+		return fiber.NewError(http.StatusForbidden, "invalid CSRF token")
+	}
+
+	resp, err := h.auth.RefreshToken(requestContext(c), refreshToken)
 	if err != nil {
 		status := http.StatusBadRequest
-		if errors.Is(err, service.ErrInvalidToken) {
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenReused) {
 			status = http.StatusUnauthorized
+			if fromCookie {
+				clearSessionCookies(c, h.cfg)
+			}
 		}
 		return fiber.NewError(status, err.Error())
 	}
 
+	if fromCookie {
+		resp = setSessionCookies(c, h.cfg, resp)
+	} else {
+		resp = deliverSession(c, h.cfg, resp)
+	}
 	return c.JSON(fiber.Map{
 		"success": true,
 		"data":    resp,
@@ -86,13 +127,97 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 }
 
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	refreshToken, fromCookie, err := refreshTokenFromRequest(c)
+	if err != nil {
+		return err
+	}
+	if fromCookie {
+		if !mid.ValidCSRF(c) {
+			return fiber.NewError(http.StatusForbidden, "invalid CSRF token")
+		}
+		clearSessionCookies(c, h.cfg)
+	}
+
+	if err := h.auth.Logout(c.Context(), refreshToken); err != nil {
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// refreshTokenFromRequest reads the refresh token from the JSON body, falling
+// back to the refresh cookie set in cookie delivery mode.
+func refreshTokenFromRequest(c *fiber.Ctx) (string, bool, error) {
 	var payload models.RefreshTokenRequest
-	if err := c.BodyParser(&payload); err != nil {
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&payload); err != nil {
+			return "", false, fiber.NewError(http.StatusBadRequest, "invalid payload")
+		}
+	}
+	if payload.RefreshToken != "" {
+		return payload.RefreshToken, false, nil
+	}
+	if cookie := c.Cookies(mid.RefreshTokenCookie); cookie != "" {
+		return cookie, true, nil
+	}
+	return "", false, fiber.NewError(http.StatusBadRequest, "invalid payload")
+}
+
+func (h *AuthHandler) VerifyEmail(c *fiber.Ctx) error {
+	var payload models.VerifyEmailRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Token == "" {
 		return fiber.NewError(http.StatusBadRequest, "invalid payload")
 	}
 
-	if err := h.auth.Logout(c.Context(), payload.RefreshToken); err != nil {
-		return fiber.NewError(http.StatusBadRequest, err.Error())
+	user, err := h.auth.VerifyEmail(c.Context(), payload.Token)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidVerificationToken) {
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": user})
+}
+
+func (h *AuthHandler) ResendVerification(c *fiber.Ctx) error {
+	var payload models.ResendVerificationRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Email == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	if err := h.auth.ResendVerification(c.Context(), payload.Email); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, "unable to send verification email")
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func (h *AuthHandler) ForgotPassword(c *fiber.Ctx) error {
+	var payload models.ForgotPasswordRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Email == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	// The outcome is deliberately not reported; failures are only logged.
+	if err := h.auth.ForgotPassword(c.Context(), payload.Email); err != nil {
+		log.Printf("forgot password: %v", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func (h *AuthHandler) ResetPassword(c *fiber.Ctx) error {
+	var payload models.ResetPasswordRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Token == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	if err := h.auth.ResetPassword(c.Context(), payload.Token, payload.Password); err != nil {
+		if errors.Is(err, service.ErrInvalidResetToken) || errors.Is(err, service.ErrWeakPassword) {
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+		return fiber.NewError(http.StatusInternalServerError, "unable to reset password")
 	}
 
 	return c.JSON(fiber.Map{"success": true})
@@ -117,95 +242,148 @@ func (h *AuthHandler) Me(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"success": true, "data": user})
 }
 
-func (h *AuthHandler) OAuthStart(c *fiber.Ctx) error {
-	provider := c.Params("provider")
-	state := c.Query("state")
-	if state == "" {
-		state = uuid.New().String()
-	}
+// oauthBindingCookie ties an OAuth state to the browser that started the
+// flow, so a callback URL cannot be replayed into another user's session.
+const oauthBindingCookie = "flowmate_oauth_binding"
 
-	var url string
-	switch provider {
-	case "github":
-		url = h.oauth.GetGitHubAuthURL(state)
-	case "google":
-		url = h.oauth.GetGoogleAuthURL(state)
-	default:
-		return fiber.NewError(http.StatusBadRequest, "unsupported provider")
+// GetOAuthAuthURL redirects the browser to the provider named in the path.
+func (h *AuthHandler) GetOAuthAuthURL(c *fiber.Ctx) error {
+	start, err := h.startOAuth(c, c.Params("provider"))
+	if err != nil {
+		return err
 	}
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data": fiber.Map{
-			"url":   url,
-			"state": state,
-		},
-	})
+	return c.Redirect(start.URL, fiber.StatusTemporaryRedirect)
 }
 
-func (h *AuthHandler) OAuthCallback(c *fiber.Ctx) error {
+// HandleOAuthCallback finishes a browser sign-in, or a link started from
+// account settings, and sends the user back to the frontend.
+func (h *AuthHandler) HandleOAuthCallback(c *fiber.Ctx) error {
 	provider := c.Params("provider")
-	code := c.Query("code")
-	if code == "" {
-		return fiber.NewError(http.StatusBadRequest, "missing code")
+	code, state, err := h.verifyOAuthCallback(c, provider)
+	if err != nil {
+		return err
+	}
+
+	if state.LinkUserID != "" {
+		q := url.Values{}
+		if err := h.oauth.CompleteLink(requestContext(c), provider, code, state); err != nil {
+			q.Set("link_error", identityError(err).Error())
+		} else {
+			q.Set("linked", provider)
+		}
+		redirect := strings.TrimRight(h.cfg.FrontendURL, "/") + "/settings/identities?" + q.Encode()
+		return c.Redirect(redirect, fiber.StatusTemporaryRedirect)
 	}
 
-	var resp *models.AuthResponse
-	var err error
+	resp, err := h.oauth.HandleCallback(requestContext(c), provider, code, state)
+	if err != nil {
+		return oauthLoginError(err)
+	}
 
-	switch provider {
-	case "github":
-		resp, err = h.oauth.HandleGitHubCallback(c.Context(), code)
-	case "google":
-		resp, err = h.oauth.HandleGoogleCallback(c.Context(), code)
-	default:
-		return fiber.NewError(http.StatusBadRequest, "unsupported provider")
+	frontend := strings.TrimRight(h.cfg.FrontendURL, "/")
+	if h.cfg.OAuthTokenDelivery == "cookie" && resp.AccessToken != "" {
+		setSessionCookies(c, h.cfg, resp)
+		return c.Redirect(frontend+"/dashboard", fiber.StatusTemporaryRedirect)
 	}
+
+	// Tokens never go in the URL, where they would end up in browser
+	// history, proxy logs and Referer headers. The frontend redeems the
+	// code at POST /auth/oauth/exchange.
+	loginCode, err := h.oauth.IssueLoginCode(requestContext(c), resp)
 	if err != nil {
-		return fiber.NewError(http.StatusBadRequest, err.Error())
+		return fiber.NewError(http.StatusInternalServerError, "failed to complete sign-in")
+	}
+	redirect := frontend + "/oauth/callback?" + url.Values{"code": {loginCode}}.Encode()
+	return c.Redirect(redirect, fiber.StatusTemporaryRedirect)
+}
+
+// ExchangeOAuthCode trades the single-use code from the OAuth redirect for
+// the login result: tokens, or an MFA challenge.
+func (h *AuthHandler) ExchangeOAuthCode(c *fiber.Ctx) error {
+	var payload models.OAuthExchangeRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Code == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	resp, err := h.oauth.ExchangeLoginCode(c.Context(), payload.Code)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidLoginCode) {
+			return fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+		return fiber.NewError(http.StatusInternalServerError, "failed to exchange code")
 	}
 
+	c.Set(fiber.HeaderCacheControl, "no-store")
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data":    resp,
+		"data":    deliverSession(c, h.cfg, resp),
 	})
 }
 
-func (h *AuthHandler) GetGitHubAuthURL(c *fiber.Ctx) error {
-	state := c.Query("state", uuid.New().String())
-	url := h.oauth.GetGitHubAuthURL(state)
-	return c.Redirect(url, fiber.StatusTemporaryRedirect)
+func (h *AuthHandler) startOAuth(c *fiber.Ctx, provider string) (*models.OAuthStart, error) {
+	start, err := h.oauth.StartAuth(requestContext(c), provider)
+	if err != nil {
+		return nil, oauthStartError(err)
+	}
+	setOAuthBinding(c, h.cfg, start.Binding, time.Now().Add(10*time.Minute))
+	return start, nil
 }
 
-func (h *AuthHandler) HandleGitHubCallback(c *fiber.Ctx) error {
+// verifyOAuthCallback checks state and the browser binding before the code
+// is redeemed. The binding cookie is cleared whatever the outcome.
+func (h *AuthHandler) verifyOAuthCallback(c *fiber.Ctx, provider string) (string, *models.OAuthState, error) {
+	binding := c.Cookies(oauthBindingCookie)
+	setOAuthBinding(c, h.cfg, "", time.Unix(0, 0))
+
+	if errParam := c.Query("error"); errParam != "" {
+		return "", nil, fiber.NewError(http.StatusBadRequest, "authorization denied: "+errParam)
+	}
 	code := c.Query("code")
 	if code == "" {
-		return fiber.NewError(http.StatusBadRequest, "missing authorization code")
+		return "", nil, fiber.NewError(http.StatusBadRequest, "missing authorization code")
 	}
-	resp, err := h.oauth.HandleGitHubCallback(c.Context(), code)
+
+	state, err := h.oauth.VerifyState(requestContext(c), provider, c.Query("state"), binding)
 	if err != nil {
-		return fiber.NewError(http.StatusBadRequest, err.Error())
+		if errors.Is(err, service.ErrInvalidOAuthState) {
+			return "", nil, fiber.NewError(http.StatusBadRequest, err.Error())
+		}
+		return "", nil, fiber.NewError(http.StatusInternalServerError, "failed to verify oauth state")
 	}
-	redirect := buildRedirectWithTokens(h.cfg.FrontendURL, resp)
-	return c.Redirect(redirect, fiber.StatusTemporaryRedirect)
+	return code, state, nil
 }
 
-func (h *AuthHandler) GetGoogleAuthURL(c *fiber.Ctx) error {
-	state := c.Query("state", uuid.New().String())
-	url := h.oauth.GetGoogleAuthURL(state)
-	return c.Redirect(url, fiber.StatusTemporaryRedirect)
+func setOAuthBinding(c *fiber.Ctx, cfg *config.Config, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthBindingCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/oauth",
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   cfg.Environment == "production",
+		// Lax lets the cookie ride along on the top-level redirect back
+		// from the provider.
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
 }
 
-func (h *AuthHandler) HandleGoogleCallback(c *fiber.Ctx) error {
-	code := c.Query("code")
-	if code == "" {
-		return fiber.NewError(http.StatusBadRequest, "missing authorization code")
-	}
-	resp, err := h.oauth.HandleGoogleCallback(c.Context(), code)
-	if err != nil {
+func oauthStartError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrUnsupportedProvider):
 		return fiber.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, oidc.ErrDiscovery):
+		return fiber.NewError(http.StatusBadGateway, "identity provider unavailable")
+	case errors.Is(err, repository.ErrUserNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
 	}
-	redirect := buildRedirectWithTokens(h.cfg.FrontendURL, resp)
-	return c.Redirect(redirect, fiber.StatusTemporaryRedirect)
+	return fiber.NewError(http.StatusInternalServerError, "failed to start oauth flow")
+}
+
+func oauthLoginError(err error) error {
+	if errors.Is(err, service.ErrAccountLinkRequired) {
+		return fiber.NewError(http.StatusConflict, err.Error())
+	}
+	return fiber.NewError(http.StatusBadRequest, err.Error())
 }
 
 func HealthHandler(serviceName string) fiber.Handler {
@@ -218,11 +396,9 @@ func HealthHandler(serviceName string) fiber.Handler {
 	}
 }
 
-func buildRedirectWithTokens(frontend string, resp *models.AuthResponse) string {
-	base := strings.TrimRight(frontend, "/")
-	q := url.Values{}
-	q.Set("access_token", resp.AccessToken)
-	q.Set("refresh_token", resp.RefreshToken)
-	q.Set("expires_in", fmt.Sprintf("%d", resp.ExpiresIn))
-	return base + "/dashboard?" + q.Encode()
+func JWKSHandler(keySet keys.KeySet) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", int(keys.JWKSMaxAge.Seconds())))
+		return c.JSON(keySet.JWKS())
+	}
 }
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// ConsentHandler backs the frontend's consent screen and the list of
+// applications the signed-in user has authorized.
+type ConsentHandler struct {
+	server service.AuthorizationServer
+}
+
+func NewConsentHandler(server service.AuthorizationServer) *ConsentHandler {
+	return &ConsentHandler{server: server}
+}
+
+// Get describes a pending authorization request for the consent screen.
+func (h *ConsentHandler) Get(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	prompt, err := h.server.ConsentPrompt(c.Context(), userID, c.Params("id"))
+	if err != nil {
+		return consentError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": prompt})
+}
+
+// Decide approves or denies a pending request. The frontend must send the
+// browser to the returned redirect_to.
+func (h *ConsentHandler) Decide(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var payload models.ConsentDecisionRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	redirect, err := h.server.DecideConsent(c.Context(), userID, c.Params("id"), payload.Approve)
+	if err != nil {
+		return consentError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"redirect_to": redirect}})
+}
+
+func (h *ConsentHandler) List(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	apps, err := h.server.ListAuthorizedApps(c.Context(), userID)
+	if err != nil {
+		return consentError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": apps})
+}
+
+func (h *ConsentHandler) Revoke(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.server.RevokeAuthorizedApp(c.Context(), userID, c.Params("client_id")); err != nil {
+		return consentError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func consentError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrAuthRequestNotFound),
+		errors.Is(err, repository.ErrConsentNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
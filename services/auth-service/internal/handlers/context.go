@@ -1,3 +1,21 @@
 package handlers
 
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
 type ContextUserIDKey struct{}
+
+// requestContext carries the client's IP and user agent into the service
+// layer so new and refreshed sessions record where they were used from.
+func requestContext(c *fiber.Ctx) context.Context {
+	return service.WithClientInfo(c.Context(), models.ClientInfo{
+		IP:        c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+	})
+}
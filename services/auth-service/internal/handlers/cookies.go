@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/config"
+	mid "github.com/flowmate/auth-service/internal/middleware"
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+// deliverSession returns the body to send for a login result. In cookie
+// session mode the tokens go into cookies and are left out of the body.
+func deliverSession(c *fiber.Ctx, cfg *config.Config, resp *models.AuthResponse) *models.AuthResponse {
+	if !cfg.SessionCookies {
+		return resp
+	}
+	return setSessionCookies(c, cfg, resp)
+}
+
+// setSessionCookies stores freshly issued tokens as HttpOnly cookies, along
+// with a new CSRF token, and returns resp without the tokens now held in
+// cookies. The access token only gets a cookie with ACCESS_TOKEN_COOKIE;
+// otherwise the frontend keeps it in memory. Responses without tokens (MFA
+// or verification pending) are returned unchanged.
+func setSessionCookies(c *fiber.Ctx, cfg *config.Config, resp *models.AuthResponse) *models.AuthResponse {
+	if resp.RefreshToken == "" {
+		return resp
+	}
+	body := *resp
+	maxAge := cfg.RefreshExpiryDays * 24 * 60 * 60
+
+	c.Cookie(sessionCookie(cfg, mid.RefreshTokenCookie, resp.RefreshToken, mid.RefreshCookiePath, maxAge, true))
+	body.RefreshToken = ""
+	if cfg.AccessTokenCookie {
+		c.Cookie(sessionCookie(cfg, mid.AccessTokenCookie, resp.AccessToken, "/", resp.ExpiresIn, true))
+		body.AccessToken = ""
+	}
+	if csrf, err := randomCSRFToken(); err == nil {
+		c.Cookie(sessionCookie(cfg, mid.CSRFCookie, csrf, "/", maxAge, false))
+	}
+	return &body
+}
+
+func clearSessionCookies(c *fiber.Ctx, cfg *config.Config) {
+	for name, path := range map[string]string{
+		mid.AccessTokenCookie:  "/",
+		mid.RefreshTokenCookie: mid.RefreshCookiePath,
+		mid.CSRFCookie:         "/",
+	} {
+		cookie := sessionCookie(cfg, name, "", path, 0, name != mid.CSRFCookie)
+		cookie.Expires = time.Unix(0, 0)
+		c.Cookie(cookie)
+	}
+}
+
+func sessionCookie(cfg *config.Config, name, value, path string, maxAge int, httpOnly bool) *fiber.Cookie {
+	sameSite := cookieSameSite(cfg.CookieSameSite)
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   cfg.CookieDomain,
+		MaxAge:   maxAge,
+		HTTPOnly: httpOnly,
+		// Browsers drop SameSite=None cookies that are not Secure.
+		Secure:   cfg.Environment == "production" || sameSite == fiber.CookieSameSiteNoneMode,
+		SameSite: sameSite,
+	}
+}
+
+func cookieSameSite(value string) string {
+	switch strings.ToLower(value) {
+	case "lax":
+		return fiber.CookieSameSiteLaxMode
+	case "none":
+		return fiber.CookieSameSiteNoneMode
+	default:
+		return fiber.CookieSameSiteStrictMode
+	}
+}
+
+func randomCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/config"
+	mid "github.com/flowmate/auth-service/internal/middleware"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// fakeAuth rotates any refresh token. Methods the tests do not use panic.
+type fakeAuth struct {
+	service.AuthService
+}
+
+func (fakeAuth) RefreshToken(context.Context, string) (*models.AuthResponse, error) {
+	return &models.AuthResponse{AccessToken: "access-2", RefreshToken: "refresh-2", ExpiresIn: 900}, nil
+}
+
+func cookiesByName(resp *http.Response) map[string]*http.Cookie {
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	return cookies
+}
+
+func TestSetSessionCookies(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          config.Config
+		wantSecure   bool
+		wantSameSite http.SameSite
+		wantAccess   bool
+	}{
+		{"production", config.Config{Environment: "production"}, true, http.SameSiteStrictMode, false},
+		{"development lax", config.Config{CookieSameSite: "lax"}, false, http.SameSiteLaxMode, false},
+		{"SameSite none is always secure", config.Config{CookieSameSite: "none"}, true, http.SameSiteNoneMode, false},
+		{"access token cookie", config.Config{AccessTokenCookie: true}, false, http.SameSiteStrictMode, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.RefreshExpiryDays = 30
+			cfg.CookieDomain = "example.com"
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return c.JSON(setSessionCookies(c, &cfg, &models.AuthResponse{AccessToken: "access-1", RefreshToken: "refresh-1", ExpiresIn: 900}))
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cookies := cookiesByName(resp)
+
+			refresh := cookies[mid.RefreshTokenCookie]
+			if refresh == nil {
+				t.Fatal("no refresh token cookie")
+			}
+			if refresh.Value != "refresh-1" || refresh.Path != mid.RefreshCookiePath || refresh.Domain != "example.com" || !refresh.HttpOnly || refresh.MaxAge != 30*24*60*60 {
+				t.Errorf("refresh cookie = %+v", refresh)
+			}
+			csrf := cookies[mid.CSRFCookie]
+			if csrf == nil || csrf.Value == "" || csrf.Path != "/" || csrf.HttpOnly {
+				t.Errorf("CSRF cookie = %+v, want a script-readable token on /", csrf)
+			}
+			access := cookies[mid.AccessTokenCookie]
+			if (access != nil) != tc.wantAccess {
+				t.Fatalf("access token cookie = %+v, want set %v", access, tc.wantAccess)
+			}
+			if access != nil && (access.Path != "/" || !access.HttpOnly || access.MaxAge != 900) {
+				t.Errorf("access cookie = %+v", access)
+			}
+			for _, cookie := range []*http.Cookie{refresh, csrf, access} {
+				if cookie == nil {
+					continue
+				}
+				if cookie.Secure != tc.wantSecure || cookie.SameSite != tc.wantSameSite {
+					t.Errorf("%s: Secure = %v, SameSite = %v; want %v, %v", cookie.Name, cookie.Secure, cookie.SameSite, tc.wantSecure, tc.wantSameSite)
+				}
+			}
+
+			var body models.AuthResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.RefreshToken != "" || (tc.wantAccess && body.AccessToken != "") {
+				t.Errorf("body still carries tokens held in cookies: %+v", body)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenCookieRequiresCSRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		csrfHeader string
+		want       int
+	}{
+		{"matching header", "csrf-1", http.StatusOK},
+		{"missing header", "", http.StatusForbidden},
+		{"mismatched header", "csrf-2", http.StatusForbidden},
+	}
+	h := NewAuthHandler(fakeAuth{}, nil, &config.Config{SessionCookies: true, RefreshExpiryDays: 30})
+	app := fiber.New()
+	app.Post(mid.RefreshCookiePath+"/refresh", h.RefreshToken)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, mid.RefreshCookiePath+"/refresh", nil)
+			req.AddCookie(&http.Cookie{Name: mid.RefreshTokenCookie, Value: "refresh-1"})
+			req.AddCookie(&http.Cookie{Name: mid.CSRFCookie, Value: "csrf-1"})
+			if tc.csrfHeader != "" {
+				req.Header.Set(mid.CSRFHeader, tc.csrfHeader)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+			if refresh := cookiesByName(resp)[mid.RefreshTokenCookie]; (refresh != nil) != (tc.want == http.StatusOK) {
+				t.Errorf("refresh cookie = %+v", refresh)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// DeviceHandler backs the frontend page where a signed-in user enters the
+// code shown by the CLI or another device.
+type DeviceHandler struct {
+	server service.AuthorizationServer
+}
+
+func NewDeviceHandler(server service.AuthorizationServer) *DeviceHandler {
+	return &DeviceHandler{server: server}
+}
+
+// Get describes the device waiting for the user_code query parameter.
+func (h *DeviceHandler) Get(c *fiber.Ctx) error {
+	userCode := c.Query("user_code")
+	if userCode == "" {
+		return fiber.NewError(http.StatusBadRequest, "user_code is required")
+	}
+
+	prompt, err := h.server.DevicePrompt(c.Context(), userCode)
+	if err != nil {
+		return deviceError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": prompt})
+}
+
+// Decide approves or denies the device; the device learns the outcome on
+// its next poll.
+func (h *DeviceHandler) Decide(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var payload models.DeviceDecisionRequest
+	if err := c.BodyParser(&payload); err != nil || payload.UserCode == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	if err := h.server.DecideDevice(c.Context(), userID, payload.UserCode, payload.Approve); err != nil {
+		return deviceError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func deviceError(err error) error {
+	if errors.Is(err, service.ErrDeviceCodeNotFound) {
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
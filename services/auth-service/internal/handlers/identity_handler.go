@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// IdentityHandler manages the external providers linked to the signed-in
+// user.
+type IdentityHandler struct {
+	oauth service.OAuthService
+	cfg   *config.Config
+}
+
+func NewIdentityHandler(oauth service.OAuthService, cfg *config.Config) *IdentityHandler {
+	return &IdentityHandler{oauth: oauth, cfg: cfg}
+}
+
+func (h *IdentityHandler) List(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	methods, err := h.oauth.ListSignInMethods(c.Context(), userID)
+	if err != nil {
+		return identityError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": methods})
+}
+
+// Link starts an OAuth flow that attaches the provider account to the
+// caller, or re-consents an already linked one. Optional ?scopes= (comma or
+// space separated) are requested on top of the sign-in scopes. The client
+// must follow the returned URL in the same browser, since the callback is
+// bound to the cookie set here.
+func (h *IdentityHandler) Link(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	start, err := h.oauth.StartLink(requestContext(c), userID, c.Params("provider"), oauth.ParseScopes(c.Query("scopes")))
+	if err != nil {
+		return oauthStartError(err)
+	}
+	setOAuthBinding(c, h.cfg, start.Binding, time.Now().Add(10*time.Minute))
+
+	return c.JSON(fiber.Map{"success": true, "data": start})
+}
+
+func (h *IdentityHandler) Unlink(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.oauth.Unlink(c.Context(), userID, c.Params("provider")); err != nil {
+		return identityError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func identityError(err error) error {
+	switch {
+	case errors.Is(err, repository.ErrIdentityNotFound),
+		errors.Is(err, repository.ErrUserNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	case errors.Is(err, repository.ErrIdentityAlreadyLinked),
+		errors.Is(err, service.ErrProviderAlreadyLinked),
+		errors.Is(err, service.ErrLastSignInMethod):
+		return fiber.NewError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrUnsupportedProvider),
+		errors.Is(err, service.ErrInvalidOAuthState):
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+type MFAHandler struct {
+	mfa service.MFAService
+}
+
+func NewMFAHandler(mfa service.MFAService) *MFAHandler {
+	return &MFAHandler{mfa: mfa}
+}
+
+func (h *MFAHandler) Status(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	status, err := h.mfa.Status(c.Context(), userID)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"success": true, "data": status})
+}
+
+func (h *MFAHandler) EnrollTOTP(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	enrollment, err := h.mfa.EnrollTOTP(c.Context(), userID)
+	if err != nil {
+		return mfaError(err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"success": true, "data": enrollment})
+}
+
+func (h *MFAHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	userID, payload, err := mfaCodeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	codes, err := h.mfa.ConfirmTOTP(c.Context(), userID, payload.Code)
+	if err != nil {
+		return mfaError(err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"success": true, "data": models.RecoveryCodesResponse{RecoveryCodes: codes}})
+}
+
+func (h *MFAHandler) DisableTOTP(c *fiber.Ctx) error {
+	userID, payload, err := mfaCodeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.mfa.DisableTOTP(c.Context(), userID, payload.Code); err != nil {
+		return mfaError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func (h *MFAHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userID, payload, err := mfaCodeRequest(c)
+	if err != nil {
+		return err
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(c.Context(), userID, payload.Code)
+	if err != nil {
+		return mfaError(err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"success": true, "data": models.RecoveryCodesResponse{RecoveryCodes: codes}})
+}
+
+func localUserID(c *fiber.Ctx) (uuid.UUID, error) {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return uuid.Nil, fiber.NewError(http.StatusUnauthorized, "unauthorized")
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, fiber.NewError(http.StatusBadRequest, "invalid user id")
+	}
+	return id, nil
+}
+
+func mfaCodeRequest(c *fiber.Ctx) (uuid.UUID, *models.MFACodeRequest, error) {
+	userID, err := localUserID(c)
+	if err != nil {
+		return uuid.Nil, nil, err
+	}
+	var payload models.MFACodeRequest
+	if err := c.BodyParser(&payload); err != nil || payload.Code == "" {
+		return uuid.Nil, nil, fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+	return userID, &payload, nil
+}
+
+func mfaError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidMFACode):
+		return fiber.NewError(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrMFAAlreadyEnabled),
+		errors.Is(err, service.ErrMFANotEnabled),
+		errors.Is(err, service.ErrMFANotEnrolling):
+		return fiber.NewError(http.StatusConflict, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// OAuth2Handler serves the standards-based token endpoints used by other
+// services and gateways. Errors use the RFC 6749 error body, not the
+// service's usual envelope.
+type OAuth2Handler struct {
+	auth     service.AuthService
+	server   service.AuthorizationServer
+	pats     service.PersonalAccessTokenService
+	gateways map[string]bool
+	cfg      *config.Config
+}
+
+func NewOAuth2Handler(auth service.AuthService, server service.AuthorizationServer, pats service.PersonalAccessTokenService, cfg *config.Config) *OAuth2Handler {
+	gateways := map[string]bool{}
+	for _, id := range oauth.ParseScopes(cfg.GatewayClients) {
+		gateways[id] = true
+	}
+	return &OAuth2Handler{
+		auth:     auth,
+		server:   server,
+		pats:     pats,
+		gateways: gateways,
+		cfg:      cfg,
+	}
+}
+
+// Introspect answers any registered client, but only service clients, which
+// act as resource servers, and OAUTH_GATEWAY_CLIENTS learn about tokens
+// issued to someone else; for other clients such tokens are inactive.
+func (h *OAuth2Handler) Introspect(c *fiber.Ctx) error {
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return h.tokenError(c, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauth2Error(c, http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	var resp *models.IntrospectionResponse
+	if strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+		resp, err = h.pats.Introspect(c.Context(), token)
+	} else {
+		resp, err = h.auth.IntrospectToken(c.Context(), token, c.FormValue("token_type_hint"))
+	}
+	if err != nil {
+		return oauth2Error(c, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+	if resp.Active && resp.ClientID != client.ClientID && !client.Service && !h.gateways[client.ClientID] {
+		resp = &models.IntrospectionResponse{Active: false}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+// Revoke lets a registered client revoke its own tokens, as RFC 7009 is
+// meant for; see AuthService.RevokeToken for tokens issued to others.
+func (h *OAuth2Handler) Revoke(c *fiber.Ctx) error {
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return h.tokenError(c, err)
+	}
+
+	token := c.FormValue("token")
+	if token == "" {
+		return oauth2Error(c, http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	hint := c.FormValue("token_type_hint")
+	if hint != "" && hint != models.TokenTypeHintAccessToken && hint != models.TokenTypeHintRefreshToken {
+		return oauth2Error(c, http.StatusBadRequest, "unsupported_token_type", "")
+	}
+
+	// Personal access tokens are recognised by their prefix, so a leaked one
+	// can be revoked by whoever found it without knowing whose it is.
+	if strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+		err = h.pats.RevokeToken(c.Context(), token)
+	} else {
+		err = h.auth.RevokeToken(c.Context(), client.ClientID, token, hint)
+	}
+	if err != nil {
+		return oauth2Error(c, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+	}
+	return c.SendStatus(http.StatusOK)
+}
+
+// authenticateClient checks the client credentials of a token endpoint
+// request: HTTP Basic, client_id and client_secret, client_id alone for
+// public clients, or a private_key_jwt client assertion.
+func (h *OAuth2Handler) authenticateClient(c *fiber.Ctx) (*models.OAuthClient, error) {
+	auth := &models.ClientAuthentication{
+		AssertionType: c.FormValue("client_assertion_type"),
+		Assertion:     c.FormValue("client_assertion"),
+	}
+	var ok bool
+	auth.ClientID, auth.ClientSecret, ok = basicCredentials(c.Get(fiber.HeaderAuthorization))
+	if !ok {
+		auth.ClientID, auth.ClientSecret = c.FormValue("client_id"), c.FormValue("client_secret")
+	}
+	return h.server.AuthenticateClient(c.Context(), auth)
+}
+
+// basicCredentials decodes an RFC 6749 section 2.3.1 Basic header, where the
+// client ID and secret are form-encoded before being joined.
+func basicCredentials(header string) (string, string, bool) {
+	scheme, encoded, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Basic") {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+	id, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", "", false
+	}
+	secret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func oauth2Error(c *fiber.Ctx, status int, code, description string) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(status).JSON(models.OAuth2Error{Error: code, ErrorDescription: description})
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// Authorize validates the request and sends the browser to the frontend,
+// which holds the user's session, to sign in and consent.
+func (h *OAuth2Handler) Authorize(c *fiber.Ctx) error {
+	var params models.AuthorizeParams
+	if err := c.QueryParser(&params); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid authorization request")
+	}
+
+	requestID, err := h.server.Authorize(c.Context(), &params)
+	if err != nil {
+		var oauthErr *service.OAuth2Error
+		if !errors.As(err, &oauthErr) {
+			if errors.Is(err, service.ErrUnknownClient) || errors.Is(err, service.ErrInvalidRedirectURI) {
+				return fiber.NewError(http.StatusBadRequest, err.Error())
+			}
+			return fiber.NewError(http.StatusInternalServerError, "failed to start authorization")
+		}
+		return c.Redirect(errorRedirect(params.RedirectURI, params.State, h.cfg.IssuerURL, oauthErr), fiber.StatusFound)
+	}
+
+	consent := strings.TrimRight(h.cfg.FrontendURL, "/") + "/oauth/consent?" + url.Values{"request_id": {requestID}}.Encode()
+	return c.Redirect(consent, fiber.StatusFound)
+}
+
+func errorRedirect(redirectURI, state, issuer string, oauthErr *service.OAuth2Error) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	query.Set("error", oauthErr.Code)
+	if oauthErr.Description != "" {
+		query.Set("error_description", oauthErr.Description)
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	query.Set("iss", issuer)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// Token is the RFC 6749 token endpoint for registered clients.
+func (h *OAuth2Handler) Token(c *fiber.Ctx) error {
+	// Device clients are first-party public clients configured in
+	// DEVICE_CLIENT_IDS, not registered ones.
+	if c.FormValue("grant_type") == models.GrantTypeDeviceCode {
+		resp, err := h.server.DeviceToken(requestContext(c), c.FormValue("client_id"), c.FormValue("device_code"))
+		if err != nil {
+			return h.tokenError(c, err)
+		}
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(resp)
+	}
+
+	client, err := h.authenticateClient(c)
+	if err != nil {
+		return h.tokenError(c, err)
+	}
+
+	var resp *models.OAuth2TokenResponse
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		resp, err = h.server.ExchangeCode(requestContext(c), client, c.FormValue("code"), c.FormValue("redirect_uri"), c.FormValue("code_verifier"))
+	case "refresh_token":
+		resp, err = h.server.RefreshToken(requestContext(c), client, c.FormValue("refresh_token"), c.FormValue("scope"))
+	case "client_credentials":
+		resp, err = h.server.ClientCredentials(c.Context(), client, c.FormValue("scope"), c.FormValue("audience"))
+	case "":
+		return oauth2Error(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+	default:
+		return oauth2Error(c, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+	if err != nil {
+		return h.tokenError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+// DeviceAuthorization starts the RFC 8628 device flow. Device clients are
+// public and identify themselves with client_id alone.
+func (h *OAuth2Handler) DeviceAuthorization(c *fiber.Ctx) error {
+	resp, err := h.server.AuthorizeDevice(requestContext(c), c.FormValue("client_id"))
+	if err != nil {
+		return h.tokenError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(resp)
+}
+
+func (h *OAuth2Handler) tokenError(c *fiber.Ctx, err error) error {
+	var oauthErr *service.OAuth2Error
+	if !errors.As(err, &oauthErr) {
+		return oauth2Error(c, http.StatusInternalServerError, "server_error", "")
+	}
+	if oauthErr.Code == "invalid_client" {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="flowmate"`)
+		return oauth2Error(c, http.StatusUnauthorized, oauthErr.Code, oauthErr.Description)
+	}
+	return oauth2Error(c, http.StatusBadRequest, oauthErr.Code, oauthErr.Description)
+}
+
+// UserInfo is the OpenID Connect userinfo endpoint. Errors follow RFC 6750.
+func (h *OAuth2Handler) UserInfo(c *fiber.Ctx) error {
+	token, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok || token == "" {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="flowmate"`)
+		return c.SendStatus(http.StatusUnauthorized)
+	}
+
+	claims, err := h.server.UserInfo(c.Context(), token)
+	if err != nil {
+		var oauthErr *service.OAuth2Error
+		if !errors.As(err, &oauthErr) {
+			return oauth2Error(c, http.StatusInternalServerError, "server_error", "")
+		}
+		status := http.StatusUnauthorized
+		if oauthErr.Code == "insufficient_scope" {
+			status = http.StatusForbidden
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="flowmate", error="`+oauthErr.Code+`"`)
+		return c.SendStatus(status)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(claims)
+}
+
+func (h *OAuth2Handler) Discovery(c *fiber.Ctx) error {
+	doc, err := h.server.Discovery()
+	if err != nil {
+		return fiber.NewError(http.StatusServiceUnavailable, "signing key unavailable")
+	}
+	return c.JSON(doc)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// OAuthClientHandler lets users register applications that sign in with
+// FlowMate.
+type OAuthClientHandler struct {
+	server service.AuthorizationServer
+}
+
+func NewOAuthClientHandler(server service.AuthorizationServer) *OAuthClientHandler {
+	return &OAuthClientHandler{server: server}
+}
+
+// Register creates a client. The secret of a confidential client is only
+// returned here.
+func (h *OAuthClientHandler) Register(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var payload models.OAuthClientRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	client, err := h.server.RegisterClient(c.Context(), userID, &payload)
+	if err != nil {
+		return oauthClientError(err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"success": true, "data": client})
+}
+
+func (h *OAuthClientHandler) List(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	clients, err := h.server.ListClients(c.Context(), userID)
+	if err != nil {
+		return oauthClientError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": clients})
+}
+
+func (h *OAuthClientHandler) Delete(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.server.DeleteClient(c.Context(), userID, c.Params("client_id")); err != nil {
+		return oauthClientError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func oauthClientError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidClientMetadata):
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrOAuthClientNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
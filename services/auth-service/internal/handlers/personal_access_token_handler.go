@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// PersonalAccessTokenHandler lets users manage the tokens their scripts and
+// CI jobs use.
+type PersonalAccessTokenHandler struct {
+	tokens service.PersonalAccessTokenService
+}
+
+func NewPersonalAccessTokenHandler(tokens service.PersonalAccessTokenService) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{tokens: tokens}
+}
+
+// Create returns the new token. It is only shown here.
+func (h *PersonalAccessTokenHandler) Create(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	var payload models.PersonalAccessTokenRequest
+	if err := c.BodyParser(&payload); err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	token, err := h.tokens.Create(c.Context(), userID, &payload)
+	if err != nil {
+		return personalAccessTokenError(err)
+	}
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"success": true, "data": token})
+}
+
+func (h *PersonalAccessTokenHandler) List(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := h.tokens.List(c.Context(), userID)
+	if err != nil {
+		return personalAccessTokenError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": tokens})
+}
+
+func (h *PersonalAccessTokenHandler) Revoke(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid token id")
+	}
+
+	if err := h.tokens.Revoke(c.Context(), userID, id); err != nil {
+		return personalAccessTokenError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func personalAccessTokenError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrInvalidPersonalAccessToken):
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, repository.ErrPersonalAccessTokenNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
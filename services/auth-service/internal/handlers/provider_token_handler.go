@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+// ProviderTokenHandler serves provider access tokens to other FlowMate
+// services. Its routes only admit service tokens granted
+// provider_tokens:read; it is never reachable with a user token.
+type ProviderTokenHandler struct {
+	tokens service.ProviderTokenService
+}
+
+func NewProviderTokenHandler(tokens service.ProviderTokenService) *ProviderTokenHandler {
+	return &ProviderTokenHandler{tokens: tokens}
+}
+
+// Get returns a fresh token for the user's linked provider account. When the
+// grant is missing, too narrow or revoked, the response names the path the
+// user must visit (signed in) to grant it again.
+func (h *ProviderTokenHandler) Get(c *fiber.Ctx) error {
+	userID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusBadRequest, "invalid user id")
+	}
+	provider := c.Params("provider")
+	scopes := oauth.ParseScopes(c.Query("scopes"))
+
+	token, err := h.tokens.GetToken(c.Context(), userID, provider, scopes)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrProviderNotLinked),
+			errors.Is(err, service.ErrInsufficientProviderScope),
+			errors.Is(err, service.ErrProviderReauthRequired):
+			c.Set(fiber.HeaderCacheControl, "no-store")
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"success": false,
+				"error":   err.Error(),
+				"data": fiber.Map{
+					"reauthorize_path": reauthorizePath(provider, scopes),
+				},
+			})
+		case errors.Is(err, service.ErrUnsupportedProvider):
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(http.StatusBadGateway, "failed to obtain provider token")
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{"success": true, "data": token})
+}
+
+func reauthorizePath(provider string, scopes []string) string {
+	path := "/api/v1/user/identities/" + url.PathEscape(provider)
+	if len(scopes) > 0 {
+		path += "?" + url.Values{"scopes": {strings.Join(scopes, " ")}}.Encode()
+	}
+	return path
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+type SessionHandler struct {
+	sessions service.SessionService
+}
+
+func NewSessionHandler(sessions service.SessionService) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+func (h *SessionHandler) List(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return fiber.NewError(http.StatusUnauthorized, "unauthorized")
+	}
+	sessionID, _ := c.Locals("sessionID").(string)
+
+	sessions, err := h.sessions.ListSessions(c.Context(), userID, sessionID)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": sessions})
+}
+
+func (h *SessionHandler) Revoke(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return fiber.NewError(http.StatusUnauthorized, "unauthorized")
+	}
+
+	if err := h.sessions.RevokeSession(c.Context(), userID, c.Params("id")); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return fiber.NewError(http.StatusNotFound, err.Error())
+		}
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func (h *SessionHandler) RevokeOthers(c *fiber.Ctx) error {
+	userID, ok := c.Locals("userID").(string)
+	if !ok || userID == "" {
+		return fiber.NewError(http.StatusUnauthorized, "unauthorized")
+	}
+	sessionID, _ := c.Locals("sessionID").(string)
+
+	revoked, err := h.sessions.RevokeOtherSessions(c.Context(), userID, sessionID)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": fiber.Map{"revoked": revoked}})
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+)
+
+type WebAuthnHandler struct {
+	auth     service.AuthService
+	webauthn service.WebAuthnService
+	cfg      *config.Config
+}
+
+func NewWebAuthnHandler(auth service.AuthService, webauthn service.WebAuthnService, cfg *config.Config) *WebAuthnHandler {
+	return &WebAuthnHandler{auth: auth, webauthn: webauthn, cfg: cfg}
+}
+
+func (h *WebAuthnHandler) BeginRegistration(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	ceremony, err := h.webauthn.BeginRegistration(c.Context(), userID)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": ceremony})
+}
+
+func (h *WebAuthnHandler) FinishRegistration(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+	var payload models.WebAuthnFinishRequest
+	if err := c.BodyParser(&payload); err != nil || payload.CeremonyID == "" || len(payload.Credential) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	credential, err := h.webauthn.FinishRegistration(c.Context(), userID, payload.CeremonyID, payload.Name, payload.Credential)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.Status(http.StatusCreated).JSON(fiber.Map{"success": true, "data": credential})
+}
+
+func (h *WebAuthnHandler) ListCredentials(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := h.webauthn.ListCredentials(c.Context(), userID)
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(fiber.Map{"success": true, "data": credentials})
+}
+
+func (h *WebAuthnHandler) DeleteCredential(c *fiber.Ctx) error {
+	userID, err := localUserID(c)
+	if err != nil {
+		return err
+	}
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(http.StatusNotFound, service.ErrWebAuthnCredentialNotFound.Error())
+	}
+
+	if err := h.webauthn.DeleteCredential(c.Context(), userID, id); err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func (h *WebAuthnHandler) BeginLogin(c *fiber.Ctx) error {
+	ceremony, err := h.webauthn.BeginLogin(c.Context())
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": ceremony})
+}
+
+func (h *WebAuthnHandler) FinishLogin(c *fiber.Ctx) error {
+	var payload models.WebAuthnFinishRequest
+	if err := c.BodyParser(&payload); err != nil || payload.CeremonyID == "" || len(payload.Credential) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	resp, err := h.auth.PasskeyLogin(requestContext(c), payload.CeremonyID, payload.Credential)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": deliverSession(c, h.cfg, resp)})
+}
+
+func (h *WebAuthnHandler) BeginMFA(c *fiber.Ctx) error {
+	var payload models.WebAuthnMFABeginRequest
+	if err := c.BodyParser(&payload); err != nil || payload.MFAToken == "" {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	ceremony, err := h.auth.BeginWebAuthnMFA(c.Context(), payload.MFAToken)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": ceremony})
+}
+
+func (h *WebAuthnHandler) FinishMFA(c *fiber.Ctx) error {
+	var payload models.WebAuthnMFAFinishRequest
+	if err := c.BodyParser(&payload); err != nil || payload.MFAToken == "" || payload.CeremonyID == "" || len(payload.Credential) == 0 {
+		return fiber.NewError(http.StatusBadRequest, "invalid payload")
+	}
+
+	resp, err := h.auth.VerifyWebAuthnMFA(requestContext(c), payload.MFAToken, payload.CeremonyID, payload.Credential)
+	if err != nil {
+		return webauthnError(err)
+	}
+	return c.JSON(fiber.Map{"success": true, "data": deliverSession(c, h.cfg, resp)})
+}
+
+func webauthnError(err error) error {
+	switch {
+	case errors.Is(err, service.ErrWebAuthnFailed),
+		errors.Is(err, service.ErrWebAuthnCloned),
+		errors.Is(err, service.ErrInvalidMFAToken):
+		return fiber.NewError(http.StatusUnauthorized, err.Error())
+	case errors.Is(err, service.ErrWebAuthnCeremonyNotFound):
+		return fiber.NewError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, service.ErrWebAuthnCredentialNotFound):
+		return fiber.NewError(http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrWebAuthnCredentialExists),
+		errors.Is(err, service.ErrLastSignInMethod):
+		return fiber.NewError(http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrEmailNotVerified):
+		return fiber.NewError(http.StatusForbidden, err.Error())
+	}
+	return fiber.NewError(http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,205 @@
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrKeyNotFound          = errors.New("signing key not found")
+)
+
+type Key struct {
+	ID        string
+	Algorithm string
+
+	secret  []byte
+	private crypto.Signer
+}
+
+func NewHMACKey(id string, secret []byte) *Key {
+	key := &Key{ID: id, Algorithm: AlgHS256, secret: secret}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key
+}
+
+func NewPrivateKey(id string, private crypto.Signer) (*Key, error) {
+	var alg string
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("rsa key must be at least 2048 bits, got %d", k.N.BitLen())
+		}
+		alg = AlgRS256
+	case ed25519.PrivateKey:
+		alg = AlgEdDSA
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	key := &Key{ID: id, Algorithm: alg, private: private}
+	if key.ID == "" {
+		key.ID = key.thumbprint()
+	}
+	return key, nil
+}
+
+func Generate(alg string) (*Key, error) {
+	switch alg {
+	case AlgHS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACKey("", secret), nil
+	case AlgRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return NewPrivateKey("", private)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewPrivateKey("", private)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+}
+
+func ParsePrivateKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	return NewPrivateKey(id, signer)
+}
+
+// ParsePrivateKey restores a key serialized with MarshalPrivate.
+func ParsePrivateKey(id, alg string, data []byte) (*Key, error) {
+	if alg == AlgHS256 {
+		return NewHMACKey(id, data), nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse private key: %w", err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	key, err := NewPrivateKey(id, signer)
+	if err != nil {
+		return nil, err
+	}
+	if key.Algorithm != alg {
+		return nil, fmt.Errorf("stored key %s is %s, expected %s", id, key.Algorithm, alg)
+	}
+	return key, nil
+}
+
+func (k *Key) MarshalPrivate() ([]byte, error) {
+	if k.private == nil {
+		return k.secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(k.private)
+}
+
+func (k *Key) SigningMethod() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgRS256:
+		return jwt.SigningMethodRS256
+	case AlgEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+func (k *Key) SignKey() interface{} {
+	if k.private != nil {
+		return k.private
+	}
+	return k.secret
+}
+
+func (k *Key) VerifyKey() interface{} {
+	if k.private != nil {
+		return k.private.Public()
+	}
+	return k.secret
+}
+
+// Public returns nil for HMAC keys, which must never be published.
+func (k *Key) Public() crypto.PublicKey {
+	if k.private == nil {
+		return nil
+	}
+	return k.private.Public()
+}
+
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.SigningMethod(), claims)
+	token.Header["kid"] = k.ID
+	return token.SignedString(k.SignKey())
+}
+
+// thumbprint derives a stable key ID from the key material (RFC 7638 for
+// public keys, a truncated digest for HMAC secrets).
+func (k *Key) thumbprint() string {
+	var input []byte
+	switch k.Algorithm {
+	case AlgRS256:
+		jwk := NewJWK(k)
+		input = []byte(fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, jwk.E, jwk.N))
+	case AlgEdDSA:
+		jwk := NewJWK(k)
+		input = []byte(fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, jwk.X))
+	default:
+		sum := sha256.Sum256(append([]byte("hmac:"), k.secret...))
+		return "hs-" + base64.RawURLEncoding.EncodeToString(sum[:12])
+	}
+	sum := sha256.Sum256(input)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,71 @@
+package keys
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flowmate/auth-service/internal/config"
+)
+
+// JWKSMaxAge is how long verifiers may cache the published key set. New keys
+// are published at least this long before they start signing tokens.
+const JWKSMaxAge = 5 * time.Minute
+
+type KeySet interface {
+	SigningKey() (*Key, error)
+	VerificationKey(kid string) (*Key, error)
+	JWKS() *JWKS
+}
+
+// configuredKey returns the key described by the JWT_* settings. It seeds an
+// empty key ring so existing deployments keep their configured key.
+func configuredKey(cfg *config.Config) (*Key, error) {
+	if cfg.JWTSigningAlg == AlgHS256 {
+		return NewHMACKey(cfg.JWTKeyID, []byte(cfg.JWTSecret)), nil
+	}
+
+	if cfg.JWTPrivateKeyFile != "" {
+		data, err := os.ReadFile(cfg.JWTPrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read JWT private key: %w", err)
+		}
+		key, err := ParsePrivateKeyPEM(cfg.JWTKeyID, data)
+		if err != nil {
+			return nil, err
+		}
+		if key.Algorithm != cfg.JWTSigningAlg {
+			return nil, fmt.Errorf("JWT private key is %s but JWT_SIGNING_ALG is %s", key.Algorithm, cfg.JWTSigningAlg)
+		}
+		return key, nil
+	}
+
+	log.Printf("JWT_PRIVATE_KEY_FILE not set, generating a new %s signing key", cfg.JWTSigningAlg)
+	return Generate(cfg.JWTSigningAlg)
+}
+
+// Keyfunc resolves the verification key from the token's kid header and
+// rejects tokens whose alg does not match the key's algorithm.
+func Keyfunc(set KeySet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrKeyNotFound
+		}
+		key, err := set.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Algorithm {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.VerifyKey(), nil
+	}
+}
+
+func ValidMethods() []string {
+	return []string{AlgHS256, AlgRS256, AlgEdDSA}
+}
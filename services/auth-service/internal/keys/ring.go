@@ -0,0 +1,302 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+)
+
+const (
+	ringRefreshInterval = time.Minute
+	retiredKeyLeeway    = time.Minute
+	// unknownKidReloadInterval limits how often a token with an unknown kid
+	// may make the ring reload, so made-up key IDs cannot hammer Postgres.
+	unknownKidReloadInterval = 10 * time.Second
+	ringReloadTimeout        = 2 * time.Second
+)
+
+// Ring is a KeySet backed by the signing_keys table. Exactly one key signs at
+// a time; pending keys are published ahead of activation and retired keys are
+// kept for verification until the last token they signed has expired.
+type Ring struct {
+	repo repository.SigningKeyRepository
+	box  *secrets.Box
+	cfg  *config.Config
+
+	mu      sync.RWMutex
+	records []*models.SigningKey
+	keys    map[string]*Key
+	signing *Key
+
+	// reloadMu serializes reloads for unknown kids; checkedAt is the last.
+	reloadMu  sync.Mutex
+	checkedAt time.Time
+}
+
+func NewRing(repo repository.SigningKeyRepository, box *secrets.Box, cfg *config.Config) *Ring {
+	return &Ring{repo: repo, box: box, cfg: cfg, keys: map[string]*Key{}}
+}
+
+// Load reads the ring from Postgres, seeding it from the configured key when
+// no key has been activated yet.
+func (r *Ring) Load(ctx context.Context) error {
+	if err := r.reload(ctx); err != nil {
+		return err
+	}
+	if r.active() != nil {
+		return nil
+	}
+
+	if pending := r.pending(); pending != nil {
+		return r.Activate(ctx, pending.ID)
+	}
+
+	key, err := configuredKey(r.cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := r.store(ctx, key, nil); err != nil && !errors.Is(err, repository.ErrPendingKeyExists) {
+		return err
+	}
+	if err := r.reload(ctx); err != nil {
+		return err
+	}
+	if pending := r.pending(); pending != nil {
+		return r.Activate(ctx, pending.ID)
+	}
+	return nil
+}
+
+// Generate creates a pending key that is published in the JWKS but does not
+// sign tokens until it is activated.
+func (r *Ring) Generate(ctx context.Context, alg string) (*models.SigningKey, error) {
+	return r.generate(ctx, alg, nil)
+}
+
+func (r *Ring) generate(ctx context.Context, alg string, activateAt *time.Time) (*models.SigningKey, error) {
+	key, err := Generate(alg)
+	if err != nil {
+		return nil, err
+	}
+	record, err := r.store(ctx, key, activateAt)
+	if err != nil {
+		return nil, err
+	}
+	return record, r.reload(ctx)
+}
+
+func (r *Ring) Activate(ctx context.Context, kid string) error {
+	expiresAt := time.Now().Add(time.Duration(r.cfg.JWTExpiryMinutes)*time.Minute + retiredKeyLeeway)
+	if err := r.repo.Activate(ctx, kid, expiresAt); err != nil {
+		return err
+	}
+	log.Printf("signing key %s activated", kid)
+	return r.reload(ctx)
+}
+
+// Rotate generates a pending key scheduled to start signing once JWKS caches
+// have expired. Run activates it on every instance's behalf; until then the
+// current key keeps signing.
+func (r *Ring) Rotate(ctx context.Context, alg string) (*models.SigningKey, error) {
+	activateAt := time.Now().Add(JWKSMaxAge)
+	return r.generate(ctx, alg, &activateAt)
+}
+
+func (r *Ring) Prune(ctx context.Context) (int64, error) {
+	n, err := r.repo.DeleteExpired(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return n, r.reload(ctx)
+}
+
+func (r *Ring) Records() []*models.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*models.SigningKey(nil), r.records...)
+}
+
+// Run keeps the ring in sync with other instances and, when
+// KEY_ROTATION_INTERVAL_HOURS is set, rotates the signing key on schedule.
+func (r *Ring) Run(ctx context.Context) {
+	ticker := time.NewTicker(ringRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.tick(ctx); err != nil {
+				log.Printf("signing key maintenance failed: %v", err)
+			}
+		}
+	}
+}
+
+func (r *Ring) tick(ctx context.Context) error {
+	if _, err := r.Prune(ctx); err != nil {
+		return err
+	}
+
+	if pending := r.pending(); pending != nil && pending.ActivateAt != nil {
+		if time.Now().Before(*pending.ActivateAt) {
+			return nil
+		}
+		return r.Activate(ctx, pending.ID)
+	}
+
+	interval := time.Duration(r.cfg.KeyRotationIntervalHours) * time.Hour
+	active := r.active()
+	if interval <= 0 || active == nil || time.Since(*active.ActivatedAt) < interval {
+		return nil
+	}
+
+	pending := r.pending()
+	if pending == nil {
+		activateAt := time.Now().Add(JWKSMaxAge)
+		_, err := r.generate(ctx, r.cfg.JWTSigningAlg, &activateAt)
+		if errors.Is(err, repository.ErrPendingKeyExists) {
+			return r.reload(ctx)
+		}
+		return err
+	}
+	if time.Since(pending.CreatedAt) >= JWKSMaxAge {
+		return r.Activate(ctx, pending.ID)
+	}
+	return nil
+}
+
+func (r *Ring) SigningKey() (*Key, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.signing == nil {
+		return nil, ErrKeyNotFound
+	}
+	return r.signing, nil
+}
+
+// VerificationKey reloads the ring when kid is unknown, so a key another
+// instance activated before this one's next refresh is still accepted.
+func (r *Ring) VerificationKey(kid string) (*Key, error) {
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(r.checkedAt) < unknownKidReloadInterval {
+		return nil, ErrKeyNotFound
+	}
+	r.checkedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ringReloadTimeout)
+	defer cancel()
+	if err := r.reload(ctx); err != nil {
+		log.Printf("reloading signing keys for kid %q failed: %v", kid, err)
+		return nil, ErrKeyNotFound
+	}
+	if key, ok := r.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (r *Ring) lookup(kid string) (*Key, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	key, ok := r.keys[kid]
+	return key, ok
+}
+
+func (r *Ring) JWKS() *JWKS {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	set := &JWKS{Keys: []JWK{}}
+	for _, record := range r.records {
+		if jwk := NewJWK(r.keys[record.ID]); jwk != nil {
+			set.Keys = append(set.Keys, *jwk)
+		}
+	}
+	return set
+}
+
+func (r *Ring) store(ctx context.Context, key *Key, activateAt *time.Time) (*models.SigningKey, error) {
+	raw, err := key.MarshalPrivate()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := r.box.Seal(raw)
+	if err != nil {
+		return nil, err
+	}
+	record := &models.SigningKey{ID: key.ID, Algorithm: key.Algorithm, PrivateKey: sealed, ActivateAt: activateAt}
+	if err := r.repo.Create(ctx, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *Ring) reload(ctx context.Context) error {
+	records, err := r.repo.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make(map[string]*Key, len(records))
+	var signing *Key
+	for _, record := range records {
+		raw, err := r.box.Open(record.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("could not decrypt signing key %s: %w", record.ID, err)
+		}
+		key, err := ParsePrivateKey(record.ID, record.Algorithm, raw)
+		if err != nil {
+			return err
+		}
+		loaded[record.ID] = key
+		if record.IsActive() {
+			signing = key
+		}
+	}
+
+	r.mu.Lock()
+	r.records = records
+	r.keys = loaded
+	r.signing = signing
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Ring) active() *models.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, record := range r.records {
+		if record.IsActive() {
+			return record
+		}
+	}
+	return nil
+}
+
+func (r *Ring) pending() *models.SigningKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, record := range r.records {
+		if record.IsPending() {
+			return record
+		}
+	}
+	return nil
+}
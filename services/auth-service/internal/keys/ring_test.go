@@ -0,0 +1,266 @@
+package keys
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+)
+
+// memoryKeys is an in-memory signing_keys table. elapsed moves its clock
+// forward, as Postgres' NOW() would move.
+type memoryKeys struct {
+	mu      sync.Mutex
+	records map[string]*models.SigningKey
+	elapsed time.Duration
+	lists   int
+}
+
+func (r *memoryKeys) now() time.Time {
+	return time.Now().Add(r.elapsed)
+}
+
+func (r *memoryKeys) Create(_ context.Context, key *models.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, record := range r.records {
+		if record.IsPending() {
+			return repository.ErrPendingKeyExists
+		}
+	}
+	key.CreatedAt = r.now()
+	copied := *key
+	r.records[key.ID] = &copied
+	return nil
+}
+
+func (r *memoryKeys) List(context.Context) ([]*models.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lists++
+	var keys []*models.SigningKey
+	for _, record := range r.records {
+		if record.ExpiresAt == nil || record.ExpiresAt.After(r.now()) {
+			copied := *record
+			keys = append(keys, &copied)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (r *memoryKeys) Activate(_ context.Context, id string, retiredKeysExpireAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key, ok := r.records[id]
+	if !ok {
+		return repository.ErrSigningKeyNotFound
+	}
+	now := r.now()
+	for _, record := range r.records {
+		if record.IsActive() && record.ID != id {
+			record.RetiredAt = &now
+			expiresAt := retiredKeysExpireAt
+			record.ExpiresAt = &expiresAt
+		}
+	}
+	if key.ActivatedAt == nil {
+		key.ActivatedAt = &now
+	}
+	key.RetiredAt, key.ExpiresAt = nil, nil
+	return nil
+}
+
+func (r *memoryKeys) DeleteExpired(context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var n int64
+	for id, record := range r.records {
+		if record.ExpiresAt != nil && !record.ExpiresAt.After(r.now()) {
+			delete(r.records, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// schedule moves a pending key's activation time.
+func (r *memoryKeys) schedule(id string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records[id].ActivateAt = &at
+}
+
+func newTestRing(t *testing.T, repo *memoryKeys) *Ring {
+	t.Helper()
+	box, err := secrets.NewBox(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ring := NewRing(repo, box, &config.Config{JWTSigningAlg: AlgEdDSA, JWTExpiryMinutes: 15})
+	if err := ring.Load(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return ring
+}
+
+func signingKID(t *testing.T, ring *Ring) string {
+	t.Helper()
+	key, err := ring.SigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key.ID
+}
+
+func published(ring *Ring, kid string) bool {
+	for _, jwk := range ring.JWKS().Keys {
+		if jwk.KeyID == kid {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRingLoadSeedsSigningKey(t *testing.T) {
+	repo := &memoryKeys{records: map[string]*models.SigningKey{}}
+	ring := newTestRing(t, repo)
+	kid := signingKID(t, ring)
+
+	// A second instance starting later signs with the same key.
+	if got := signingKID(t, newTestRing(t, repo)); got != kid {
+		t.Errorf("second instance signs with %s, want %s", got, kid)
+	}
+	if !published(ring, kid) {
+		t.Errorf("signing key %s not in the JWKS", kid)
+	}
+}
+
+func TestRingRotation(t *testing.T) {
+	repo := &memoryKeys{records: map[string]*models.SigningKey{}}
+	ring := newTestRing(t, repo)
+	ctx := context.Background()
+	old := signingKID(t, ring)
+
+	next, err := ring.Rotate(ctx, AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.Rotate(ctx, AlgEdDSA); !errors.Is(err, repository.ErrPendingKeyExists) {
+		t.Errorf("second rotation: err = %v, want %v", err, repository.ErrPendingKeyExists)
+	}
+
+	// The next key is published a JWKS cache lifetime before it signs.
+	if got := signingKID(t, ring); got != old {
+		t.Fatalf("signing with %s before activation, want %s", got, old)
+	}
+	if !published(ring, next.ID) || !published(ring, old) {
+		t.Fatalf("JWKS = %+v, want both %s and %s", ring.JWKS(), old, next.ID)
+	}
+	if err := ring.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := signingKID(t, ring); got != old {
+		t.Fatalf("activated %s before its time", got)
+	}
+
+	repo.schedule(next.ID, time.Now().Add(-time.Second))
+	if err := ring.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := signingKID(t, ring); got != next.ID {
+		t.Fatalf("signing with %s after activation, want %s", got, next.ID)
+	}
+
+	// The retired key verifies the tokens it signed until they expire.
+	if _, err := ring.VerificationKey(old); err != nil {
+		t.Fatalf("retired key: %v", err)
+	}
+	repo.elapsed = 15*time.Minute + retiredKeyLeeway + time.Second
+	if err := ring.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if published(ring, old) {
+		t.Error("expired key still published")
+	}
+	if _, err := ring.VerificationKey(old); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expired key: err = %v, want %v", err, ErrKeyNotFound)
+	}
+}
+
+func TestRingScheduledRotation(t *testing.T) {
+	repo := &memoryKeys{records: map[string]*models.SigningKey{}}
+	ring := newTestRing(t, repo)
+	ring.cfg.KeyRotationIntervalHours = 24
+	ctx := context.Background()
+	old := signingKID(t, ring)
+
+	if err := ring.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ring.pending() != nil {
+		t.Fatal("rotated before the interval passed")
+	}
+
+	repo.mu.Lock()
+	activatedAt := time.Now().Add(-25 * time.Hour)
+	repo.records[old].ActivatedAt = &activatedAt
+	repo.mu.Unlock()
+	if err := ring.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := ring.tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pending := ring.pending()
+	if pending == nil || pending.ActivateAt == nil || !pending.ActivateAt.After(time.Now()) {
+		t.Fatalf("pending = %+v, want a key scheduled for later", pending)
+	}
+	if got := signingKID(t, ring); got != old {
+		t.Errorf("scheduled key signs before its time")
+	}
+}
+
+func TestRingReloadsOnUnknownKID(t *testing.T) {
+	repo := &memoryKeys{records: map[string]*models.SigningKey{}}
+	ring := newTestRing(t, repo)
+	other := newTestRing(t, repo)
+	ctx := context.Background()
+
+	// Another instance rotates and activates before this one refreshes.
+	next, err := other.Generate(ctx, AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Activate(ctx, next.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ring.VerificationKey(next.ID); err != nil {
+		t.Fatalf("key activated elsewhere: %v", err)
+	}
+
+	// Made-up key IDs reload at most once per interval.
+	lists := repo.lists
+	for i := 0; i < 3; i++ {
+		if _, err := ring.VerificationKey("made-up"); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("err = %v, want %v", err, ErrKeyNotFound)
+		}
+	}
+	if repo.lists != lists {
+		t.Errorf("unknown kids reloaded the ring %d times within the interval", repo.lists-lists)
+	}
+	ring.checkedAt = time.Now().Add(-unknownKidReloadInterval)
+	if _, err := ring.VerificationKey("made-up"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("err = %v, want %v", err, ErrKeyNotFound)
+	}
+	if repo.lists != lists+1 {
+		t.Errorf("ring reloaded %d times after the interval, want 1", repo.lists-lists)
+	}
+}
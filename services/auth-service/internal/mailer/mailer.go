@@ -0,0 +1,133 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+
+	"github.com/flowmate/auth-service/internal/config"
+)
+
+// Message is a rendered email. HTML is optional; when set the message is sent
+// as multipart/alternative with Text as the fallback part.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// New returns the transport selected by MAIL_TRANSPORT. Without an explicit
+// choice it uses SMTP when SMTP_HOST is configured and prints messages to
+// stdout otherwise, so local development needs no mail server. Production
+// refuses that fallback, which would log live reset links.
+func New(cfg *config.Config) (Mailer, error) {
+	transport := cfg.MailTransport
+	if transport == "" {
+		switch {
+		case cfg.SMTPHost != "":
+			transport = "smtp"
+		case cfg.Environment == "production":
+			return nil, errors.New("SMTP_HOST or MAIL_TRANSPORT is required in production")
+		default:
+			transport = "stdout"
+		}
+	}
+
+	switch transport {
+	case "smtp":
+		if cfg.SMTPHost == "" {
+			return nil, fmt.Errorf("MAIL_TRANSPORT=smtp requires SMTP_HOST")
+		}
+		return &smtpMailer{
+			addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+			host:     cfg.SMTPHost,
+			username: cfg.SMTPUsername,
+			password: cfg.SMTPPassword,
+			from:     cfg.FromEmail,
+		}, nil
+	case "file":
+		if cfg.MailFileDir == "" {
+			return nil, fmt.Errorf("MAIL_TRANSPORT=file requires MAIL_FILE_DIR")
+		}
+		return NewFileMailer(cfg.MailFileDir, cfg.FromEmail)
+	case "stdout":
+		log.Println("Outgoing email will be printed to stdout instead of sent")
+		return NewWriterMailer(os.Stdout, cfg.FromEmail), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", transport)
+	}
+}
+
+type smtpMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// Send talks SMTP itself rather than using smtp.SendMail so that the
+// context deadline bounds the whole exchange, not just the dial.
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	if err := m.send(ctx, msg); err != nil {
+		return fmt.Errorf("smtp send to %s failed: %w", msg.To, err)
+	}
+	return nil
+}
+
+func (m *smtpMailer) send(ctx context.Context, msg *Message) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", m.addr)
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+			return err
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(m.from); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg.Bytes(m.from, m.host)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
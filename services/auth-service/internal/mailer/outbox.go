@@ -0,0 +1,153 @@
+package mailer
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+)
+
+const (
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 20
+	outboxSendTimeout  = 30 * time.Second
+	outboxMaxAttempts  = 8
+	outboxRetention    = 7 * 24 * time.Hour
+
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = time.Hour
+)
+
+// Outbox is a Mailer that only records messages in Postgres; Run delivers
+// them through the underlying transport in the background. Requests never
+// wait on the mail server, and messages survive restarts and outages.
+//
+// Bodies carry live verification and reset links, so they are sealed with
+// the box while queued and cleared once the message is sent or given up on.
+type Outbox struct {
+	repo      repository.EmailOutboxRepository
+	transport Mailer
+	box       *secrets.Box
+}
+
+func NewOutbox(repo repository.EmailOutboxRepository, transport Mailer, box *secrets.Box) *Outbox {
+	return &Outbox{repo: repo, transport: transport, box: box}
+}
+
+func (o *Outbox) Send(ctx context.Context, msg *Message) error {
+	text, err := o.box.Seal([]byte(msg.Text))
+	if err != nil {
+		return err
+	}
+	html, err := o.box.Seal([]byte(msg.HTML))
+	if err != nil {
+		return err
+	}
+	return o.repo.Enqueue(ctx, &models.OutboxEmail{
+		Recipient: msg.To,
+		Subject:   msg.Subject,
+		TextBody:  text,
+		HTMLBody:  html,
+	})
+}
+
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	lastPrune := time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := o.deliver(ctx); err != nil {
+				log.Printf("email outbox delivery failed: %v", err)
+			}
+			if time.Since(lastPrune) >= time.Hour {
+				if _, err := o.repo.DeleteSentBefore(ctx, time.Now().Add(-outboxRetention)); err != nil {
+					log.Printf("email outbox prune failed: %v", err)
+				}
+				lastPrune = time.Now()
+			}
+		}
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context) error {
+	// The lease outlasts every send in the batch, so a slow batch is never
+	// picked up a second time by another instance.
+	lease := time.Now().Add(outboxBatchSize*outboxSendTimeout + time.Minute)
+	emails, err := o.repo.ClaimDue(ctx, outboxBatchSize, lease)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range emails {
+		msg, err := o.open(email)
+		if err != nil {
+			log.Printf("email outbox: could not decrypt %s: %v", email.ID, err)
+			if err := o.repo.MarkFailed(ctx, email.ID, email.Attempts, err.Error()); err != nil {
+				log.Printf("email outbox: could not mark %s failed: %v", email.ID, err)
+			}
+			continue
+		}
+
+		sendCtx, cancel := context.WithTimeout(ctx, outboxSendTimeout)
+		err = o.transport.Send(sendCtx, msg)
+		cancel()
+
+		if err == nil {
+			if err := o.repo.MarkSent(ctx, email.ID); err != nil {
+				log.Printf("email outbox: could not mark %s sent: %v", email.ID, err)
+			}
+			continue
+		}
+
+		attempts := email.Attempts + 1
+		if attempts >= outboxMaxAttempts {
+			log.Printf("email outbox: giving up on %s after %d attempts: %v", email.ID, attempts, err)
+			if err := o.repo.MarkFailed(ctx, email.ID, attempts, err.Error()); err != nil {
+				log.Printf("email outbox: could not mark %s failed: %v", email.ID, err)
+			}
+			continue
+		}
+		if err := o.repo.MarkRetry(ctx, email.ID, attempts, time.Now().Add(backoff(attempts)), err.Error()); err != nil {
+			log.Printf("email outbox: could not reschedule %s: %v", email.ID, err)
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) open(email *models.OutboxEmail) (*Message, error) {
+	text, err := o.box.Open(email.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	html, err := o.box.Open(email.HTMLBody)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		To:      email.Recipient,
+		Subject: email.Subject,
+		Text:    string(text),
+		HTML:    string(html),
+	}, nil
+}
+
+// backoff doubles the delay after every failed attempt: 30s, 1m, 2m, ... up
+// to an hour.
+func backoff(attempts int) time.Duration {
+	d := outboxBaseBackoff
+	for i := 1; i < attempts && d < outboxMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > outboxMaxBackoff {
+		d = outboxMaxBackoff
+	}
+	return d
+}
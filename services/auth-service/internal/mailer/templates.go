@@ -0,0 +1,87 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Each message type has a <name>.txt.tmpl, which also defines the "subject"
+// template, and an optional <name>.html.tmpl.
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+)
+
+type VerifyEmailData struct {
+	Username     string
+	Link         string
+	ExpiresHours int
+}
+
+type PasswordResetData struct {
+	Username       string
+	Link           string
+	ExpiresMinutes int
+}
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+var (
+	textTemplates = map[string]*texttemplate.Template{}
+	htmlTemplates = map[string]*htmltemplate.Template{}
+)
+
+func init() {
+	entries, err := fs.Glob(templateFS, "templates/*.tmpl")
+	if err != nil {
+		panic(err)
+	}
+	for _, path := range entries {
+		file := strings.TrimPrefix(path, "templates/")
+		switch {
+		case strings.HasSuffix(file, ".txt.tmpl"):
+			name := strings.TrimSuffix(file, ".txt.tmpl")
+			textTemplates[name] = texttemplate.Must(texttemplate.New(file).ParseFS(templateFS, path))
+		case strings.HasSuffix(file, ".html.tmpl"):
+			name := strings.TrimSuffix(file, ".html.tmpl")
+			htmlTemplates[name] = htmltemplate.Must(htmltemplate.New(file).ParseFS(templateFS, path))
+		}
+	}
+}
+
+// Render builds a message addressed to to from the named templates.
+func Render(name, to string, data interface{}) (*Message, error) {
+	text, ok := textTemplates[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, fmt.Errorf("render %s subject: %w", name, err)
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("render %s text: %w", name, err)
+	}
+
+	msg := &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimLeft(body.String(), "\n"),
+	}
+
+	if html, ok := htmlTemplates[name]; ok {
+		var out bytes.Buffer
+		if err := html.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("render %s html: %w", name, err)
+		}
+		msg.HTML = out.String()
+	}
+	return msg, nil
+}
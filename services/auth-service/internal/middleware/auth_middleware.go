@@ -1,51 +1,113 @@
 package middleware
 
 import (
+	"context"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/service"
+	"github.com/flowmate/auth-service/pkg/authz"
 )
 
+// TokenValidator verifies an access token, including its signature, expiry
+// and revocation status. service.AuthService satisfies it.
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, tokenString string) (*models.Claims, error)
+}
+
+// PersonalAccessTokenValidator resolves personal access tokens, which are
+// opaque and looked up rather than verified.
+// service.PersonalAccessTokenService satisfies it.
+type PersonalAccessTokenValidator interface {
+	Validate(ctx context.Context, token string) (*models.Claims, error)
+}
+
+// AuthMiddleware is authz.Middleware with what only the auth service itself
+// accepts: revocation checks, personal access tokens and the access token
+// cookie.
 type AuthMiddleware struct {
-	jwtSecret string
+	*authz.Middleware
+	cfg *config.Config
 }
 
-func NewAuthMiddleware(jwtSecret string) *AuthMiddleware {
-	return &AuthMiddleware{jwtSecret: jwtSecret}
+// NewAuthMiddleware accepts personal access tokens alongside JWTs when pats
+// is not nil.
+func NewAuthMiddleware(validator TokenValidator, pats PersonalAccessTokenValidator, cfg *config.Config) *AuthMiddleware {
+	return &AuthMiddleware{
+		Middleware: authz.New(&tokenValidator{validator: validator, pats: pats}, authz.Config{
+			Audience: cfg.ServiceAudience,
+			Token:    requestToken,
+		}),
+		cfg: cfg,
+	}
 }
 
 func (m *AuthMiddleware) Protect() fiber.Handler {
+	protect := m.Middleware.Protect()
 	return func(c *fiber.Ctx) error {
-		authHeader := c.Get("Authorization")
-		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing authorization header"})
-		}
+		// Personal access tokens record where they were last used from.
+		c.SetUserContext(service.WithClientInfo(c.UserContext(), models.ClientInfo{
+			IP:        c.IP(),
+			UserAgent: c.Get(fiber.HeaderUserAgent),
+		}))
+		return protect(c)
+	}
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid authorization header format"})
+// requestToken prefers the Authorization header; the cookie is only used by
+// browsers running in cookie session mode, which also need the CSRF header.
+func requestToken(c *fiber.Ctx) (string, error) {
+	if c.Get("Authorization") == "" && c.Cookies(AccessTokenCookie) != "" {
+		if !ValidCSRF(c) {
+			return "", fiber.NewError(fiber.StatusForbidden, "Invalid CSRF token")
 		}
+		return c.Cookies(AccessTokenCookie), nil
+	}
+	return authz.BearerToken(c)
+}
 
-		tokenString := parts[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(m.jwtSecret), nil
-		})
-		if err != nil || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
-		}
+// tokenValidator sends personal access tokens, recognised by their prefix,
+// to pats and everything else to validator.
+type tokenValidator struct {
+	validator TokenValidator
+	pats      PersonalAccessTokenValidator
+}
+
+func (v *tokenValidator) Validate(ctx context.Context, token string) (*models.Claims, error) {
+	if v.pats != nil && strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+		return v.pats.Validate(ctx, token)
+	}
+	return v.validator.ValidateToken(ctx, token)
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token claims"})
+// FirstPartyOnly must run after Protect. It refuses tokens issued to OAuth
+// clients, service tokens included, and personal access tokens, which must
+// not manage the user's account whatever their scopes.
+func (m *AuthMiddleware) FirstPartyOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if clientID, _ := c.Locals("clientID").(string); clientID != "" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Tokens issued to OAuth clients cannot access this resource"})
+		}
+		if pat, _ := c.Locals("personalAccessToken").(bool); pat {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Personal access tokens cannot access this resource"})
 		}
+		return c.Next()
+	}
+}
 
-		c.Locals("userID", claims["user_id"])
-		c.Locals("email", claims["email"])
-		c.Locals("username", claims["username"])
+// RequireVerifiedEmail must run after Protect. It rejects accounts that have
+// not confirmed their address unless UNVERIFIED_USER_POLICY is "allow".
+func (m *AuthMiddleware) RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if m.cfg.UnverifiedUserPolicy == "allow" {
+			return c.Next()
+		}
+		if verified, _ := c.Locals("emailVerified").(bool); !verified {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "Email address not verified"})
+		}
 		return c.Next()
 	}
 }
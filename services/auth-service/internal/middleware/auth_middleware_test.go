@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/pkg/authz"
+)
+
+// staticValidator accepts only its own token.
+type staticValidator string
+
+func (v staticValidator) ValidateToken(_ context.Context, token string) (*models.Claims, error) {
+	if token != string(v) {
+		return nil, authz.ErrInvalidToken
+	}
+	return &models.Claims{UserID: "user-1", Principal: models.PrincipalUser, Subject: "user-1"}, nil
+}
+
+func newProtectedApp() *fiber.App {
+	auth := NewAuthMiddleware(staticValidator("access-token"), nil, &config.Config{})
+	app := fiber.New()
+	app.All("/resource", auth.Protect(), func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+	return app
+}
+
+func TestProtectCookieCSRF(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		bearer     string
+		cookie     string
+		csrfCookie string
+		csrfHeader string
+		want       int
+	}{
+		{"cookie with matching header", http.MethodPost, "", "access-token", "csrf-1", "csrf-1", http.StatusNoContent},
+		{"cookie without header", http.MethodPost, "", "access-token", "csrf-1", "", http.StatusForbidden},
+		{"cookie with mismatched header", http.MethodPost, "", "access-token", "csrf-1", "csrf-2", http.StatusForbidden},
+		{"cookie without CSRF cookie", http.MethodPost, "", "access-token", "", "csrf-1", http.StatusForbidden},
+		{"cookie on a safe method", http.MethodGet, "", "access-token", "", "", http.StatusNoContent},
+		{"bearer skips CSRF", http.MethodPost, "access-token", "", "", "", http.StatusNoContent},
+		{"bearer wins over cookie", http.MethodPost, "access-token", "stale-token", "csrf-1", "csrf-2", http.StatusNoContent},
+		{"invalid bearer is not rescued by cookie", http.MethodPost, "stale-token", "access-token", "csrf-1", "csrf-1", http.StatusUnauthorized},
+	}
+	app := newProtectedApp()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, "/resource", nil)
+			if tc.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.bearer)
+			}
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: tc.cookie})
+			}
+			if tc.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tc.csrfCookie})
+			}
+			if tc.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tc.csrfHeader)
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
+
+// stubPATs accepts any personal access token.
+type stubPATs struct{}
+
+func (stubPATs) Validate(_ context.Context, token string) (*models.Claims, error) {
+	return &models.Claims{ID: token, Principal: models.PrincipalUser, PersonalAccessToken: true}, nil
+}
+
+func TestTokenValidatorRoutesByPrefix(t *testing.T) {
+	pat := models.PersonalAccessTokenPrefix + "secret"
+	tests := []struct {
+		name    string
+		pats    PersonalAccessTokenValidator
+		token   string
+		wantPAT bool
+		wantErr bool
+	}{
+		{"personal access token", stubPATs{}, pat, true, false},
+		{"JWT", stubPATs{}, "access-token", false, false},
+		{"personal access tokens not accepted", nil, pat, false, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &tokenValidator{validator: staticValidator("access-token"), pats: tc.pats}
+			claims, err := v.Validate(context.Background(), tc.token)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tc.wantErr)
+			}
+			if err == nil && claims.PersonalAccessToken != tc.wantPAT {
+				t.Errorf("personal access token = %v, want %v", claims.PersonalAccessToken, tc.wantPAT)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Session cookies set when tokens are delivered as cookies instead of in
+// response bodies. Both are HttpOnly so scripts never see the tokens.
+const (
+	AccessTokenCookie  = "flowmate_access_token"
+	RefreshTokenCookie = "flowmate_refresh_token"
+
+	// RefreshCookiePath limits the refresh cookie to the auth endpoints
+	// that consume it.
+	RefreshCookiePath = "/api/v1/auth"
+
+	// CSRFCookie holds the double-submit token. It is readable by scripts
+	// so the frontend can echo it in CSRFHeader; a cross-site page can make
+	// the browser send the cookie but cannot read it.
+	CSRFCookie = "flowmate_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// ValidCSRF reports whether a request authenticated by cookie may proceed.
+// Safe methods always may; anything else must echo the CSRF cookie in the
+// CSRF header.
+func ValidCSRF(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+		return true
+	}
+	cookie := c.Cookies(CSRFCookie)
+	header := c.Get(CSRFHeader)
+	if cookie == "" || header == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) == 1
+}
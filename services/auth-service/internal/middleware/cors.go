@@ -9,7 +9,7 @@ func CORS(origins string) fiber.Handler {
 	return cors.New(cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization," + CSRFHeader,
 		AllowCredentials: true,
 		MaxAge:           300,
 	})
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// GrantTypeDeviceCode is the RFC 8628 grant_type polled at /oauth2/token.
+const GrantTypeDeviceCode = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceDenied is recorded in place of a user ID when the user refuses.
+const DeviceDenied = "denied"
+
+// DeviceAuthorization is a pending device login: the device polls with the
+// device code while the user enters the user code in the web app. IP and
+// UserAgent describe the device, so the user can tell it is theirs.
+//
+// UserID or Denied is set once the user has decided.
+type DeviceAuthorization struct {
+	ClientID  string    `json:"client_id"`
+	UserCode  string    `json:"user_code"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserID    string    `json:"-"`
+	Denied    bool      `json:"-"`
+}
+
+// DeviceAuthorizationResponse is the RFC 8628 section 3.2 response.
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DevicePrompt is shown to the user before they approve a device.
+type DevicePrompt struct {
+	UserCode  string    `json:"user_code"`
+	ClientID  string    `json:"client_id"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type DeviceDecisionRequest struct {
+	UserCode string `json:"user_code" validate:"required"`
+	Approve  bool   `json:"approve"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity is an external provider account linked to a user. Profile keeps
+// the provider's raw profile (or ID token claims) as last seen.
+type Identity struct {
+	ID       uuid.UUID       `json:"-" db:"id"`
+	UserID   uuid.UUID       `json:"-" db:"user_id"`
+	Provider string          `json:"provider" db:"provider"`
+	Subject  string          `json:"subject" db:"subject"`
+	Email    *string         `json:"email,omitempty" db:"email"`
+	Profile  json.RawMessage `json:"-" db:"profile"`
+	LinkedAt time.Time       `json:"linked_at" db:"linked_at"`
+}
+
+// SignInMethods lists every way a user can sign in, so clients can tell
+// which methods are safe to remove.
+type SignInMethods struct {
+	HasPassword bool        `json:"has_password"`
+	Passkeys    int         `json:"passkeys"`
+	Identities  []*Identity `json:"identities"`
+}
+
+func (m *SignInMethods) Count() int {
+	n := len(m.Identities) + m.Passkeys
+	if m.HasPassword {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scopes defined by OpenID Connect. Clients may also request the API scopes
+// listed in OAUTH2_SCOPES.
+const (
+	ScopeOpenID        = "openid"
+	ScopeProfile       = "profile"
+	ScopeEmail         = "email"
+	ScopeOfflineAccess = "offline_access"
+)
+
+// ScopeAccountRead lets a delegated token read the user's profile at
+// GET /api/v1/user/me. Every user holds it.
+const ScopeAccountRead = "account:read"
+
+// ScopeProviderTokensRead lets a service token fetch users' provider tokens
+// from the internal API. Only service clients can be registered with it.
+const ScopeProviderTokensRead = "provider_tokens:read"
+
+// OAuthClient is an application registered to use FlowMate as its
+// authorization server. Public clients (SPAs, mobile and desktop apps) have
+// no secret and rely on PKCE alone. RedirectURIs, Scopes and Audiences are
+// space separated.
+//
+// Service clients are backend services registered by operators. They have
+// no owner and no redirect URIs, use only the client_credentials grant and
+// authenticate with a secret or, when JWKS is set, with private_key_jwt.
+type OAuthClient struct {
+	ClientID         string     `db:"client_id"`
+	ClientSecretHash *string    `db:"client_secret_hash"`
+	Name             string     `db:"name"`
+	RedirectURIs     string     `db:"redirect_uris"`
+	Scopes           string     `db:"scopes"`
+	Public           bool       `db:"public"`
+	OwnerID          *uuid.UUID `db:"owner_id"`
+	CreatedAt        time.Time  `db:"created_at"`
+	Service          bool       `db:"service"`
+	Audiences        string     `db:"audiences"`
+	JWKS             *string    `db:"jwks"`
+}
+
+// AllowsRedirect reports whether uri is registered for the client. Redirect
+// URIs are compared exactly.
+func (c *OAuthClient) AllowsRedirect(uri string) bool {
+	for _, registered := range strings.Fields(c.RedirectURIs) {
+		if registered == uri {
+			return true
+		}
+	}
+	return false
+}
+
+type OAuthClientRequest struct {
+	Name         string   `json:"name" validate:"required,max=100"`
+	RedirectURIs []string `json:"redirect_uris" validate:"required"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+// ServiceClientRequest registers a service client. A client with JWKS, a
+// JSON Web Key Set of its public keys, authenticates with private_key_jwt and
+// gets no secret.
+type ServiceClientRequest struct {
+	Name      string
+	Scopes    []string
+	Audiences []string
+	JWKS      string
+}
+
+// OAuthClientResponse describes a registered client. ClientSecret is only
+// set in the response to registration; it cannot be retrieved later.
+type OAuthClientResponse struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	Service      bool      `json:"service,omitempty"`
+	Audiences    []string  `json:"audiences,omitempty"`
+	AuthMethod   string    `json:"token_endpoint_auth_method"`
+}
+
+func (c *OAuthClient) ToResponse() *OAuthClientResponse {
+	return &OAuthClientResponse{
+		ClientID:     c.ClientID,
+		Name:         c.Name,
+		RedirectURIs: strings.Fields(c.RedirectURIs),
+		Scopes:       strings.Fields(c.Scopes),
+		Public:       c.Public,
+		CreatedAt:    c.CreatedAt,
+		Service:      c.Service,
+		Audiences:    strings.Fields(c.Audiences),
+		AuthMethod:   c.AuthMethod(),
+	}
+}
+
+// Token endpoint authentication methods (RFC 7591 section 2).
+const (
+	AuthMethodNone              = "none"
+	AuthMethodClientSecretBasic = "client_secret_basic"
+	AuthMethodPrivateKeyJWT     = "private_key_jwt"
+)
+
+func (c *OAuthClient) AuthMethod() string {
+	switch {
+	case c.Public:
+		return AuthMethodNone
+	case c.JWKS != nil:
+		return AuthMethodPrivateKeyJWT
+	default:
+		return AuthMethodClientSecretBasic
+	}
+}
+
+// ClientAuthentication is what a client presents at the token endpoint:
+// a secret, or a signed client assertion (RFC 7523).
+type ClientAuthentication struct {
+	ClientID      string
+	ClientSecret  string
+	AssertionType string
+	Assertion     string
+}
+
+// OAuthConsent records the scopes a user has granted a client, so returning
+// users are not asked again for the same access.
+type OAuthConsent struct {
+	UserID     uuid.UUID `db:"user_id"`
+	ClientID   string    `db:"client_id"`
+	ClientName string    `db:"client_name"`
+	Scopes     string    `db:"scopes"`
+	GrantedAt  time.Time `db:"granted_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+type AuthorizedAppResponse struct {
+	ClientID  string    `json:"client_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	GrantedAt time.Time `json:"granted_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c *OAuthConsent) ToResponse() *AuthorizedAppResponse {
+	return &AuthorizedAppResponse{
+		ClientID:  c.ClientID,
+		Name:      c.ClientName,
+		Scopes:    strings.Fields(c.Scopes),
+		GrantedAt: c.GrantedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+// AuthorizeParams are the query parameters of /oauth2/authorize.
+type AuthorizeParams struct {
+	ResponseType        string `query:"response_type"`
+	ClientID            string `query:"client_id"`
+	RedirectURI         string `query:"redirect_uri"`
+	Scope               string `query:"scope"`
+	State               string `query:"state"`
+	CodeChallenge       string `query:"code_challenge"`
+	CodeChallengeMethod string `query:"code_challenge_method"`
+	Nonce               string `query:"nonce"`
+	Prompt              string `query:"prompt"`
+}
+
+// AuthorizationRequest is a validated /oauth2/authorize request waiting for
+// the user to sign in to the frontend and consent.
+type AuthorizationRequest struct {
+	ClientID      string   `json:"client_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	State         string   `json:"state,omitempty"`
+	CodeChallenge string   `json:"code_challenge"`
+	Nonce         string   `json:"nonce,omitempty"`
+	ForceConsent  bool     `json:"force_consent,omitempty"`
+}
+
+// ConsentPrompt is what the frontend needs to render the consent screen.
+// ConsentRequired is false when the user already granted every scope, in
+// which case the frontend may approve without asking.
+type ConsentPrompt struct {
+	RequestID       string   `json:"request_id"`
+	ClientID        string   `json:"client_id"`
+	ClientName      string   `json:"client_name"`
+	Scopes          []string `json:"scopes"`
+	ConsentRequired bool     `json:"consent_required"`
+}
+
+type ConsentDecisionRequest struct {
+	Approve bool `json:"approve"`
+}
+
+// AuthorizationCode is issued once the user approves a request and redeemed
+// at the token endpoint.
+type AuthorizationCode struct {
+	ClientID      string   `json:"client_id"`
+	UserID        string   `json:"user_id"`
+	RedirectURI   string   `json:"redirect_uri"`
+	Scopes        []string `json:"scopes"`
+	CodeChallenge string   `json:"code_challenge"`
+	Nonce         string   `json:"nonce,omitempty"`
+}
+
+// OAuth2TokenResponse is the RFC 6749 section 5.1 token response.
+type OAuth2TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+}
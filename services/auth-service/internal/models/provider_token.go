@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ProviderToken is a provider access token kept for FlowMate integrations.
+// AccessToken and RefreshToken are sealed with the service encryption key.
+type ProviderToken struct {
+	IdentityID   uuid.UUID  `db:"identity_id"`
+	AccessToken  string     `db:"access_token"`
+	RefreshToken *string    `db:"refresh_token"`
+	Scopes       string     `db:"scopes"`
+	ExpiresAt    *time.Time `db:"expires_at"`
+	UpdatedAt    time.Time  `db:"updated_at"`
+}
+
+type ProviderTokenResponse struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Scopes      []string   `json:"scopes"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/flowmate/auth-service/internal/useragent"
+)
+
+// ClientInfo describes the client a session was created or last used from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+type SessionResponse struct {
+	ID         string         `json:"id"`
+	CreatedAt  time.Time      `json:"created_at"`
+	LastUsedAt time.Time      `json:"last_used_at"`
+	IP         string         `json:"ip"`
+	UserAgent  useragent.Info `json:"user_agent"`
+	// ClientID is set for sessions held by an OAuth client on the user's
+	// behalf.
+	ClientID string `json:"client_id,omitempty"`
+	Current  bool   `json:"current"`
+}
+
+func (f *TokenFamily) ToSessionResponse(currentSessionID string) *SessionResponse {
+	return &SessionResponse{
+		ID:         f.ID,
+		CreatedAt:  f.CreatedAt,
+		LastUsedAt: f.LastUsedAt,
+		IP:         f.IP,
+		UserAgent:  useragent.Parse(f.UserAgent),
+		ClientID:   f.ClientID,
+		Current:    f.ID == currentSessionID,
+	}
+}
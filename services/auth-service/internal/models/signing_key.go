@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SigningKey is a key of the signing ring. ActivateAt schedules a pending
+// key; pending keys without it wait for an explicit activation or the next
+// scheduled rotation.
+type SigningKey struct {
+	ID          string     `json:"id" db:"id"`
+	Algorithm   string     `json:"algorithm" db:"algorithm"`
+	PrivateKey  string     `json:"-" db:"private_key"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	ActivateAt  *time.Time `json:"activate_at" db:"activate_at"`
+	ActivatedAt *time.Time `json:"activated_at" db:"activated_at"`
+	RetiredAt   *time.Time `json:"retired_at" db:"retired_at"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+}
+
+func (k *SigningKey) IsPending() bool {
+	return k.ActivatedAt == nil
+}
+
+func (k *SigningKey) IsActive() bool {
+	return k.ActivatedAt != nil && k.RetiredAt == nil
+}
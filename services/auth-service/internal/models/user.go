@@ -1,41 +1,60 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/pkg/authz"
 )
 
 type User struct {
-	ID           uuid.UUID `json:"id" db:"id"`
-	Email        string    `json:"email" db:"email"`
-	Username     string    `json:"username" db:"username"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	AvatarURL    *string   `json:"avatar_url" db:"avatar_url"`
-	GitHubID     *string   `json:"github_id,omitempty" db:"github_id"`
-	GoogleID     *string   `json:"google_id,omitempty" db:"google_id"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+	ID              uuid.UUID  `json:"id" db:"id"`
+	Email           string     `json:"email" db:"email"`
+	Username        string     `json:"username" db:"username"`
+	PasswordHash    string     `json:"-" db:"password_hash"`
+	AvatarURL       *string    `json:"avatar_url" db:"avatar_url"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" db:"email_verified_at"`
+	// Roles and Scopes are space separated. Scopes are granted on top of
+	// DEFAULT_USER_SCOPES, which every user has.
+	Roles     string    `json:"-" db:"roles"`
+	Scopes    string    `json:"-" db:"scopes"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type UserResponse struct {
-	ID        uuid.UUID `json:"id"`
-	Email     string    `json:"email"`
-	Username  string    `json:"username"`
-	AvatarURL *string   `json:"avatar_url"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            uuid.UUID `json:"id"`
+	Email         string    `json:"email"`
+	Username      string    `json:"username"`
+	AvatarURL     *string   `json:"avatar_url"`
+	EmailVerified bool      `json:"email_verified"`
+	Roles         []string  `json:"roles"`
+	CreatedAt     time.Time `json:"created_at"`
 }
 
 func (u *User) ToResponse() *UserResponse {
 	return &UserResponse{
-		ID:        u.ID,
-		Email:     u.Email,
-		Username:  u.Username,
-		AvatarURL: u.AvatarURL,
-		CreatedAt: u.CreatedAt,
+		ID:            u.ID,
+		Email:         u.Email,
+		Username:      u.Username,
+		AvatarURL:     u.AvatarURL,
+		EmailVerified: u.IsEmailVerified(),
+		Roles:         strings.Fields(u.Roles),
+		CreatedAt:     u.CreatedAt,
 	}
 }
 
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 type RegisterRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Username string `json:"username" validate:"required,min=3,max=50"`
@@ -49,9 +68,35 @@ type LoginRequest struct {
 
 type AuthResponse struct {
 	User         *UserResponse `json:"user"`
-	AccessToken  string        `json:"access_token"`
-	RefreshToken string        `json:"refresh_token"`
-	ExpiresIn    int           `json:"expires_in"`
+	AccessToken  string        `json:"access_token,omitempty"`
+	RefreshToken string        `json:"refresh_token,omitempty"`
+	ExpiresIn    int           `json:"expires_in,omitempty"`
+	// EmailVerificationRequired is set instead of tokens when the
+	// unverified-user policy does not allow the account to sign in yet.
+	EmailVerificationRequired bool `json:"email_verification_required,omitempty"`
+	// MFARequired is set instead of tokens when the password was correct but
+	// a second factor is still needed; MFAToken identifies the pending login
+	// at POST /auth/mfa/verify.
+	MFARequired bool     `json:"mfa_required,omitempty"`
+	MFAToken    string   `json:"mfa_token,omitempty"`
+	MFAMethods  []string `json:"mfa_methods,omitempty"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8,max=100"`
 }
 
 type RefreshTokenRequest struct {
@@ -60,15 +105,44 @@ type RefreshTokenRequest struct {
 
 type OAuthCallbackRequest struct {
 	Code     string `json:"code" validate:"required"`
-	Provider string `json:"provider" validate:"required,oneof=github google"`
+	Provider string `json:"provider" validate:"required"`
+}
+
+type OAuthExchangeRequest struct {
+	Code string `json:"code" validate:"required"`
 }
 
-type Claims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
-	Username string `json:"username"`
+// OAuthStart is the result of starting a provider login. Binding must be
+// stored in the browser (as an HttpOnly cookie) and presented on callback.
+type OAuthStart struct {
+	URL     string `json:"url"`
+	State   string `json:"state"`
+	Binding string `json:"-"`
 }
 
+// OAuthState is kept server side between the redirect to the provider and
+// the callback.
+type OAuthState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"code_verifier"`
+	BindingHash  string `json:"binding_hash"`
+	Nonce        string `json:"nonce,omitempty"`
+	// LinkUserID is set when a signed-in user is linking this provider to
+	// their account rather than signing in.
+	LinkUserID string `json:"link_user_id,omitempty"`
+	// Scopes were requested on top of the provider's sign-in scopes.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// Claims are a verified token's, as defined by pkg/authz so that other
+// services share them.
+type Claims = authz.Claims
+
+const (
+	PrincipalUser    = authz.PrincipalUser
+	PrincipalService = authz.PrincipalService
+)
+
 type TokenPair struct {
 	AccessToken  string
 	RefreshToken string
@@ -78,5 +152,42 @@ type TokenPair struct {
 type RefreshTokenData struct {
 	UserID    string    `json:"user_id"`
 	Email     string    `json:"email"`
+	FamilyID  string    `json:"family_id,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
 	ExpiresAt time.Time `json:"expires_at"`
+	// ClientID and Scopes bind refresh tokens issued to OAuth clients; such
+	// tokens can only be redeemed by that client at /oauth2/token.
+	ClientID string   `json:"client_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+}
+
+// TokenFamily is the chain of refresh tokens issued for one login session.
+// Only CurrentToken may be redeemed; presenting an earlier one revokes the
+// whole family.
+type TokenFamily struct {
+	ID           string
+	UserID       string
+	CurrentToken string
+	IP           string
+	UserAgent    string
+	ClientID     string
+	CreatedAt    time.Time
+	LastUsedAt   time.Time
+}
+
+// UserAccessRequest replaces a user's roles and the scopes granted on top of
+// DEFAULT_USER_SCOPES.
+type UserAccessRequest struct {
+	Roles  []string `json:"roles"`
+	Scopes []string `json:"scopes"`
+}
+
+// UserAccessResponse shows the stored roles and scopes, and the scopes the
+// user's tokens end up with.
+type UserAccessResponse struct {
+	UserID          uuid.UUID `json:"user_id"`
+	Roles           []string  `json:"roles"`
+	Scopes          []string  `json:"scopes"`
+	EffectiveScopes []string  `json:"effective_scopes"`
 }
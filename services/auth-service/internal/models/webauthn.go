@@ -0,0 +1,66 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebAuthnCredential is a registered passkey or security key. Flags holds the
+// raw authenticator data flags from registration, which later assertions are
+// checked against.
+type WebAuthnCredential struct {
+	ID              uuid.UUID  `db:"id"`
+	UserID          uuid.UUID  `db:"user_id"`
+	CredentialID    []byte     `db:"credential_id"`
+	PublicKey       []byte     `db:"public_key"`
+	AttestationType string     `db:"attestation_type"`
+	Transports      string     `db:"transports"`
+	AAGUID          []byte     `db:"aaguid"`
+	SignCount       int64      `db:"sign_count"`
+	Flags           int16      `db:"flags"`
+	Name            string     `db:"name"`
+	CreatedAt       time.Time  `db:"created_at"`
+	LastUsedAt      *time.Time `db:"last_used_at"`
+}
+
+type WebAuthnCredentialResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func (c *WebAuthnCredential) ToResponse() *WebAuthnCredentialResponse {
+	return &WebAuthnCredentialResponse{
+		ID:         c.ID,
+		Name:       c.Name,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+// WebAuthnCeremony is handed to the browser to start a registration or
+// assertion. Options is passed to navigator.credentials.create/get as is;
+// CeremonyID must be sent back with the result.
+type WebAuthnCeremony struct {
+	CeremonyID string      `json:"ceremony_id"`
+	Options    interface{} `json:"options"`
+}
+
+type WebAuthnFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Name       string          `json:"name,omitempty"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+type WebAuthnMFABeginRequest struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type WebAuthnMFAFinishRequest struct {
+	MFAToken   string          `json:"mfa_token" validate:"required"`
+	CeremonyID string          `json:"ceremony_id" validate:"required"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
@@ -0,0 +1,180 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultGitHubBaseURL = "https://github.com"
+	DefaultGitHubAPIURL  = "https://api.github.com"
+)
+
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// BaseURL serves /login/oauth/*; APIURL serves /user. Both can point at
+	// GitHub Enterprise or a local stand-in.
+	BaseURL string
+	APIURL  string
+}
+
+type gitHubProvider struct {
+	cfg    GitHubConfig
+	client *http.Client
+}
+
+func NewGitHubProvider(cfg GitHubConfig, client *http.Client) Provider {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultGitHubBaseURL
+	}
+	if cfg.APIURL == "" {
+		cfg.APIURL = DefaultGitHubAPIURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &gitHubProvider{cfg: cfg, client: client}
+}
+
+func (p *gitHubProvider) Name() string {
+	return "github"
+}
+
+func (p *gitHubProvider) AuthCodeURL(_ context.Context, params AuthParams) (string, error) {
+	q := url.Values{
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {joinScopes("user:email", params.Scopes)},
+		"state":                 {params.State},
+		"code_challenge":        {CodeChallenge(params.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return fmt.Sprintf("%s/login/oauth/authorize?%s", p.cfg.BaseURL, q.Encode()), nil
+}
+
+func (p *gitHubProvider) Exchange(ctx context.Context, code string, params AuthParams) (*Identity, error) {
+	form := url.Values{
+		"client_id":     {p.cfg.ClientID},
+		"client_secret": {p.cfg.ClientSecret},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {params.CodeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.BaseURL+"/login/oauth/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		Error        string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("%w: github: %s", ErrTokenRequest, tokenResp.Error)
+	}
+
+	identity, err := p.userInfo(ctx, tokenResp.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	identity.Token = &Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		Scope:        tokenResp.Scope,
+		Expiry:       expiryFromSeconds(tokenResp.ExpiresIn),
+	}
+	return identity, nil
+}
+
+func (p *gitHubProvider) userInfo(ctx context.Context, accessToken string) (*Identity, error) {
+	var profile json.RawMessage
+	if err := p.getJSON(ctx, "/user", accessToken, &profile); err != nil {
+		return nil, err
+	}
+	var user struct {
+		ID        int64  `json:"id"`
+		Login     string `json:"login"`
+		Email     string `json:"email"`
+		AvatarURL string `json:"avatar_url"`
+	}
+	if err := json.Unmarshal(profile, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == 0 {
+		return nil, fmt.Errorf("github: profile has no id")
+	}
+
+	identity := &Identity{
+		Provider:  p.Name(),
+		Subject:   strconv.FormatInt(user.ID, 10),
+		Email:     user.Email,
+		Username:  user.Login,
+		AvatarURL: user.AvatarURL,
+		Profile:   profile,
+	}
+
+	// The profile email may be empty or unverified; /user/emails says which.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := p.getJSON(ctx, "/user/emails", accessToken, &emails); err == nil && len(emails) > 0 {
+		if identity.Email == "" {
+			identity.Email = emails[0].Email
+			for _, e := range emails {
+				if e.Primary {
+					identity.Email = e.Email
+				}
+			}
+		}
+		for _, e := range emails {
+			if e.Email == identity.Email {
+				identity.EmailVerified = e.Verified
+			}
+		}
+	}
+	return identity, nil
+}
+
+func (p *gitHubProvider) getJSON(ctx context.Context, path, accessToken string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.APIURL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("github %s: status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,185 @@
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	DefaultGoogleAuthURL     = "https://accounts.google.com/o/oauth2/v2/auth"
+	DefaultGoogleTokenURL    = "https://oauth2.googleapis.com/token"
+	DefaultGoogleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+)
+
+type GoogleConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	UserInfoURL  string
+}
+
+type googleProvider struct {
+	cfg    GoogleConfig
+	client *http.Client
+}
+
+func NewGoogleProvider(cfg GoogleConfig, client *http.Client) Provider {
+	if cfg.AuthURL == "" {
+		cfg.AuthURL = DefaultGoogleAuthURL
+	}
+	if cfg.TokenURL == "" {
+		cfg.TokenURL = DefaultGoogleTokenURL
+	}
+	if cfg.UserInfoURL == "" {
+		cfg.UserInfoURL = DefaultGoogleUserInfoURL
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &googleProvider{cfg: cfg, client: client}
+}
+
+func (p *googleProvider) Name() string {
+	return "google"
+}
+
+func (p *googleProvider) AuthCodeURL(_ context.Context, params AuthParams) (string, error) {
+	q := url.Values{
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"response_type":         {"code"},
+		"scope":                 {joinScopes("email profile", params.Scopes)},
+		"state":                 {params.State},
+		"code_challenge":        {CodeChallenge(params.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+		// Offline access yields a refresh token so FlowMate integrations
+		// keep working after the hour-long access token expires; granted
+		// scopes accumulate across consents.
+		"access_type":            {"offline"},
+		"include_granted_scopes": {"true"},
+	}
+	if params.ForceConsent {
+		q.Set("prompt", "consent")
+	}
+	return fmt.Sprintf("%s?%s", p.cfg.AuthURL, q.Encode()), nil
+}
+
+func (p *googleProvider) Exchange(ctx context.Context, code string, params AuthParams) (*Identity, error) {
+	token, err := p.token(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {params.CodeVerifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := p.userInfo(ctx, token.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	identity.Token = token
+	return identity, nil
+}
+
+// Refresh renews an access token. Google does not rotate refresh tokens, so
+// the returned RefreshToken is usually empty.
+func (p *googleProvider) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	return p.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+}
+
+func (p *googleProvider) token(ctx context.Context, form url.Values) (*Token, error) {
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+		Error        string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return nil, err
+	}
+	if tokenResp.Error == "invalid_grant" {
+		return nil, ErrInvalidGrant
+	}
+	if tokenResp.AccessToken == "" {
+		return nil, fmt.Errorf("%w: google: %s", ErrTokenRequest, tokenResp.Error)
+	}
+
+	return &Token{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		Scope:        tokenResp.Scope,
+		Expiry:       expiryFromSeconds(tokenResp.ExpiresIn),
+	}, nil
+}
+
+func (p *googleProvider) userInfo(ctx context.Context, accessToken string) (*Identity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.UserInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("google userinfo: status %d", resp.StatusCode)
+	}
+
+	var profile json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&profile); err != nil {
+		return nil, err
+	}
+	var user struct {
+		ID            string `json:"id"`
+		Email         string `json:"email"`
+		VerifiedEmail bool   `json:"verified_email"`
+		Picture       string `json:"picture"`
+	}
+	if err := json.Unmarshal(profile, &user); err != nil {
+		return nil, err
+	}
+	if user.ID == "" {
+		return nil, fmt.Errorf("google: profile has no id")
+	}
+
+	return &Identity{
+		Provider:      p.Name(),
+		Subject:       user.ID,
+		Email:         user.Email,
+		EmailVerified: user.VerifiedEmail,
+		Username:      user.Email,
+		AvatarURL:     user.Picture,
+		Profile:       profile,
+	}, nil
+}
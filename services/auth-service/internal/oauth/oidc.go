@@ -0,0 +1,73 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/flowmate/auth-service/internal/oidc"
+)
+
+type oidcProvider struct {
+	p *oidc.Provider
+}
+
+// NewOIDCProvider adapts an OpenID Connect relying party. The identity comes
+// from the verified ID token, so no userinfo call is made.
+func NewOIDCProvider(p *oidc.Provider) Provider {
+	return &oidcProvider{p: p}
+}
+
+func (o *oidcProvider) Name() string {
+	return o.p.Name()
+}
+
+func (o *oidcProvider) AuthCodeURL(ctx context.Context, params AuthParams) (string, error) {
+	return o.p.AuthCodeURL(ctx, params.State, params.Nonce, CodeChallenge(params.CodeVerifier), params.Scopes...)
+}
+
+func (o *oidcProvider) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	token, err := o.p.Refresh(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidGrant) {
+			return nil, ErrInvalidGrant
+		}
+		return nil, err
+	}
+	return &Token{
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Scope:        token.Scope,
+		Expiry:       expiryFromSeconds(token.ExpiresIn),
+	}, nil
+}
+
+func (o *oidcProvider) Exchange(ctx context.Context, code string, params AuthParams) (*Identity, error) {
+	token, err := o.p.Exchange(ctx, code, params.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := o.p.VerifyIDToken(ctx, token.IDToken, params.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	username := claims.PreferredUsername
+	if username == "" {
+		username = claims.Email
+	}
+	return &Identity{
+		Provider:      o.Name(),
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+		Username:      username,
+		AvatarURL:     claims.Picture,
+		Profile:       claims.Raw,
+		Token: &Token{
+			AccessToken:  token.AccessToken,
+			RefreshToken: token.RefreshToken,
+			Scope:        token.Scope,
+			Expiry:       expiryFromSeconds(token.ExpiresIn),
+		},
+	}, nil
+}
@@ -0,0 +1,131 @@
+// Package oauth holds the external sign-in providers. Each provider turns an
+// authorization code into an Identity; the registry maps the provider name
+// used in routes to its implementation.
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrTokenRequest = errors.New("provider token request failed")
+	// ErrInvalidGrant means the code or refresh token was rejected, e.g.
+	// because the user revoked access at the provider.
+	ErrInvalidGrant = errors.New("provider rejected the grant")
+)
+
+// AuthParams are generated per login attempt and kept server side between
+// the redirect and the callback.
+type AuthParams struct {
+	State        string
+	CodeVerifier string
+	// Nonce is bound into OpenID Connect ID tokens; plain OAuth providers
+	// ignore it.
+	Nonce string
+	// Scopes are requested on top of the provider's sign-in scopes.
+	Scopes []string
+	// ForceConsent asks the provider to show its consent screen again, which
+	// is how Google hands out a new refresh token.
+	ForceConsent bool
+}
+
+// Token is what the provider returned from the code exchange.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	Scope        string
+	Expiry       time.Time
+}
+
+// Identity is the provider's view of the user who signed in.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	AvatarURL     string
+	// Profile is the raw profile document (or ID token claims) as returned
+	// by the provider.
+	Profile json.RawMessage
+	Token   *Token
+}
+
+// Provider is one configured sign-in provider.
+type Provider interface {
+	Name() string
+	// AuthCodeURL returns the provider's authorization URL. PKCE (S256) is
+	// always used.
+	AuthCodeURL(ctx context.Context, params AuthParams) (string, error)
+	// Exchange redeems the code and fetches the signed-in identity.
+	Exchange(ctx context.Context, code string, params AuthParams) (*Identity, error)
+}
+
+// Refresher is implemented by providers whose access tokens expire and can
+// be renewed with a refresh token.
+type Refresher interface {
+	Refresh(ctx context.Context, refreshToken string) (*Token, error)
+}
+
+// Registry looks providers up by name.
+type Registry struct {
+	providers map[string]Provider
+}
+
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names returns the configured provider names in sorted order.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CodeChallenge derives the RFC 7636 S256 challenge for a verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ParseScopes splits a granted scope string; GitHub separates scopes with
+// commas, everyone else with spaces.
+func ParseScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
+
+func joinScopes(base string, extra []string) string {
+	if len(extra) == 0 {
+		return base
+	}
+	return base + " " + strings.Join(extra, " ")
+}
+
+func expiryFromSeconds(seconds int) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
@@ -0,0 +1,53 @@
+package oauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/oidc"
+)
+
+// LoadRegistry builds the registry from configuration. GitHub and Google are
+// registered when their client ID is set; every OIDC_PROVIDERS entry is
+// added by name. Callbacks land on OAUTH_CALLBACK_URL/<name>/callback.
+// Every provider, OIDC discovery and JWKS fetches included, uses client,
+// which should have a timeout.
+func LoadRegistry(cfg *config.Config, client *http.Client) *Registry {
+	callback := func(name string) string {
+		return fmt.Sprintf("%s/%s/callback", strings.TrimRight(cfg.OAuthCallbackURL, "/"), name)
+	}
+
+	var providers []Provider
+	if cfg.GitHubClientID != "" {
+		providers = append(providers, NewGitHubProvider(GitHubConfig{
+			ClientID:     cfg.GitHubClientID,
+			ClientSecret: cfg.GitHubClientSecret,
+			RedirectURL:  callback("github"),
+			BaseURL:      cfg.GitHubBaseURL,
+			APIURL:       cfg.GitHubAPIURL,
+		}, client))
+	}
+	if cfg.GoogleClientID != "" {
+		providers = append(providers, NewGoogleProvider(GoogleConfig{
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  callback("google"),
+			AuthURL:      cfg.GoogleAuthURL,
+			TokenURL:     cfg.GoogleTokenURL,
+			UserInfoURL:  cfg.GoogleUserInfoURL,
+		}, client))
+	}
+	for _, p := range cfg.OIDCProviders {
+		providers = append(providers, NewOIDCProvider(oidc.NewProvider(oidc.Config{
+			Name:         p.Name,
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+			RedirectURL:  callback(p.Name),
+		}, client)))
+	}
+	return NewRegistry(providers...)
+}
@@ -0,0 +1,117 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// clockSkew is tolerated on exp, nbf and iat.
+const clockSkew = time.Minute
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNonceMismatch  = errors.New("id token nonce mismatch")
+)
+
+// Claims are the standard ID token claims mapped onto FlowMate users.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string  `json:"nonce"`
+	AuthorizedParty   string  `json:"azp"`
+	Email             string  `json:"email"`
+	EmailVerified     boolish `json:"email_verified"`
+	Name              string  `json:"name"`
+	PreferredUsername string  `json:"preferred_username"`
+	Picture           string  `json:"picture"`
+
+	// Raw is the verified token payload, including claims not mapped above.
+	Raw json.RawMessage `json:"-"`
+}
+
+// boolish accepts both true and "true"; some providers (AWS Cognito, older
+// Azure AD) send email_verified as a string.
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	case "false", "null", "":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// VerifyIDToken checks the token signature against the provider JWKS and
+// validates iss, aud, azp, exp, iat and nonce per OpenID Connect Core §3.1.3.7.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	d, err := p.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	token, err := jwt.ParseWithClaims(rawIDToken, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.keys.Key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingAlgs(d.SigningAlgs)),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: azp does not match client", ErrInvalidIDToken)
+	}
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrNonceMismatch
+	}
+
+	if parts := strings.Split(token.Raw, "."); len(parts) == 3 {
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			claims.Raw = payload
+		}
+	}
+	return &claims, nil
+}
+
+// signingAlgs keeps the asymmetric algorithms the provider advertises. HMAC
+// and "none" are never accepted.
+func signingAlgs(advertised []string) []string {
+	supported := map[string]bool{
+		"RS256": true, "RS384": true, "RS512": true,
+		"PS256": true, "PS384": true, "PS512": true,
+		"ES256": true, "ES384": true, "ES512": true,
+		"EdDSA": true,
+	}
+	var out []string
+	for _, alg := range advertised {
+		if supported[alg] {
+			out = append(out, alg)
+		}
+	}
+	if len(out) == 0 {
+		// RS256 is mandatory for OpenID providers.
+		out = []string{"RS256"}
+	}
+	return out
+}
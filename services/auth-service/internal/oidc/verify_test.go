@@ -0,0 +1,310 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testClientID = "flowmate"
+
+// testIssuer is an OpenID provider serving discovery and a JWKS whose keys
+// can be rotated mid-test.
+type testIssuer struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PrivateKey
+	jwksFetch int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	iss := &testIssuer{keys: map[string]*rsa.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                iss.URL,
+			AuthorizationEndpoint: iss.URL + "/authorize",
+			TokenEndpoint:         iss.URL + "/token",
+			JWKSURI:               iss.URL + "/jwks",
+			SigningAlgs:           []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		iss.jwksFetch++
+		var keys []jwk
+		for kid, key := range iss.keys {
+			keys = append(keys, jwk{
+				KeyType: "RSA",
+				KeyID:   kid,
+				Use:     "sig",
+				N:       base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	iss.addKey(t, "key-1")
+	return iss
+}
+
+func (iss *testIssuer) fetches() int {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	return iss.jwksFetch
+}
+
+func (iss *testIssuer) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys[kid] = key
+}
+
+// claims are valid for the test provider; tests override what they check.
+func (iss *testIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   iss.URL,
+		"sub":   "user-1",
+		"aud":   testClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "nonce-1",
+		"email": "user@example.com",
+	}
+}
+
+func (iss *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func (iss *testIssuer) provider() *Provider {
+	return NewProvider(Config{Name: "test", Issuer: iss.URL, ClientID: testClientID}, iss.Client())
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+
+	claims, err := p.VerifyIDToken(context.Background(), iss.sign(t, "key-1", iss.claims()), "nonce-1")
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "user@example.com" {
+		t.Errorf("claims = %+v", claims)
+	}
+	if len(claims.Raw) == 0 {
+		t.Error("raw payload not kept")
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+		// noNonce verifies as if no nonce had been sent with the request.
+		noNonce bool
+		want    error
+	}{
+		{
+			name: "hmac signed with the public key",
+			token: func() string {
+				iss.mu.Lock()
+				pub := iss.keys["key-1"].PublicKey
+				iss.mu.Unlock()
+				token := jwt.NewWithClaims(jwt.SigningMethodHS256, iss.claims())
+				token.Header["kid"] = "key-1"
+				signed, _ := token.SignedString(pub.N.Bytes())
+				return signed
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name: "algorithm not advertised",
+			token: func() string {
+				token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, iss.claims())
+				token.Header["kid"] = "key-1"
+				signed, _ := token.SignedString(edKey)
+				return signed
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name: "unsigned",
+			token: func() string {
+				signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, iss.claims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+				return signed
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name:  "wrong issuer",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "iss", "https://attacker.example")) },
+			want:  ErrInvalidIDToken,
+		},
+		{
+			name:  "wrong audience",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "aud", "someone-else")) },
+			want:  ErrInvalidIDToken,
+		},
+		{
+			name: "several audiences without azp",
+			token: func() string {
+				return iss.sign(t, "key-1", with(iss.claims(), "aud", []string{testClientID, "someone-else"}))
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name: "several audiences with another azp",
+			token: func() string {
+				claims := with(iss.claims(), "aud", []string{testClientID, "someone-else"})
+				return iss.sign(t, "key-1", with(claims, "azp", "someone-else"))
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return iss.sign(t, "key-1", with(iss.claims(), "exp", time.Now().Add(-time.Hour).Unix()))
+			},
+			want: ErrInvalidIDToken,
+		},
+		{
+			name:  "no expiry",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "exp", nil)) },
+			want:  ErrInvalidIDToken,
+		},
+		{
+			name:  "no subject",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "sub", nil)) },
+			want:  ErrInvalidIDToken,
+		},
+		{
+			name:  "nonce mismatch",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "nonce", "nonce-2")) },
+			want:  ErrNonceMismatch,
+		},
+		{
+			name:  "nonce missing from the token",
+			token: func() string { return iss.sign(t, "key-1", with(iss.claims(), "nonce", nil)) },
+			want:  ErrNonceMismatch,
+		},
+		{
+			name:    "no nonce expected",
+			token:   func() string { return iss.sign(t, "key-1", with(iss.claims(), "nonce", nil)) },
+			noNonce: true,
+			want:    ErrNonceMismatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce := "nonce-1"
+			if tt.noNonce {
+				nonce = ""
+			}
+			_, err := p.VerifyIDToken(context.Background(), tt.token(), nonce)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAcceptsMatchingAZP(t *testing.T) {
+	iss := newTestIssuer(t)
+	claims := with(iss.claims(), "aud", []string{testClientID, "someone-else"})
+	claims["azp"] = testClientID
+
+	if _, err := iss.provider().VerifyIDToken(context.Background(), iss.sign(t, "key-1", claims), "nonce-1"); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestVerifyIDTokenRefetchesKeysForUnknownKid(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+
+	if _, err := p.VerifyIDToken(ctx, iss.sign(t, "key-1", iss.claims()), "nonce-1"); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+
+	iss.addKey(t, "key-2")
+	rotated := iss.sign(t, "key-2", iss.claims())
+
+	// Right after a fetch an unknown kid does not reach the provider.
+	if _, err := p.VerifyIDToken(ctx, rotated, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+	if n := iss.fetches(); n != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", n)
+	}
+
+	p.keys.mu.Lock()
+	p.keys.fetchedAt = time.Now().Add(-jwksRefreshInterval)
+	p.keys.mu.Unlock()
+
+	if _, err := p.VerifyIDToken(ctx, rotated, "nonce-1"); err != nil {
+		t.Fatalf("token signed with the rotated key rejected: %v", err)
+	}
+	if n := iss.fetches(); n != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", n)
+	}
+	// Known keys are served from the cache.
+	if _, err := p.VerifyIDToken(ctx, iss.sign(t, "key-1", iss.claims()), "nonce-1"); err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if n := iss.fetches(); n != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", n)
+	}
+}
+
+// with returns claims with name set to value, or removed when value is nil.
+func with(claims jwt.MapClaims, name string, value interface{}) jwt.MapClaims {
+	if value == nil {
+		delete(claims, name)
+	} else {
+		claims[name] = value
+	}
+	return claims
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+type EmailOutboxRepository interface {
+	Enqueue(ctx context.Context, email *models.OutboxEmail) error
+	ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]*models.OutboxEmail, error)
+	MarkSent(ctx context.Context, id uuid.UUID) error
+	MarkRetry(ctx context.Context, id uuid.UUID, attempts int, nextAttemptAt time.Time, lastError string) error
+	MarkFailed(ctx context.Context, id uuid.UUID, attempts int, lastError string) error
+	DeleteSentBefore(ctx context.Context, before time.Time) (int64, error)
+}
+
+type emailOutboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewEmailOutboxRepository(db *sqlx.DB) EmailOutboxRepository {
+	return &emailOutboxRepository{db: db}
+}
+
+func (r *emailOutboxRepository) Enqueue(ctx context.Context, email *models.OutboxEmail) error {
+	query := `
+		INSERT INTO email_outbox (id, recipient, subject, text_body, html_body, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+
+	email.ID = uuid.New()
+	email.CreatedAt = time.Now()
+	email.NextAttemptAt = email.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, query,
+		email.ID, email.Recipient, email.Subject, email.TextBody, email.HTMLBody, email.NextAttemptAt, email.CreatedAt,
+	)
+	return err
+}
+
+// ClaimDue leases up to limit due messages by pushing their next attempt to
+// leaseUntil. SKIP LOCKED lets several instances drain the outbox without
+// sending the same message twice; a message whose sender dies mid-delivery
+// becomes due again when the lease runs out.
+func (r *emailOutboxRepository) ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]*models.OutboxEmail, error) {
+	var emails []*models.OutboxEmail
+	query := `
+		UPDATE email_outbox
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM email_outbox
+			WHERE sent_at IS NULL AND failed_at IS NULL AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *
+	`
+
+	if err := r.db.SelectContext(ctx, &emails, query, leaseUntil, limit); err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// MarkSent and MarkFailed clear the bodies: the links in them must not
+// outlive delivery in the database.
+func (r *emailOutboxRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE email_outbox
+		SET sent_at = NOW(), attempts = attempts + 1, last_error = NULL, text_body = '', html_body = ''
+		WHERE id = $1
+	`, id)
+	return err
+}
+
+func (r *emailOutboxRepository) MarkRetry(ctx context.Context, id uuid.UUID, attempts int, nextAttemptAt time.Time, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE email_outbox
+		SET attempts = $1, next_attempt_at = $2, last_error = $3
+		WHERE id = $4
+	`, attempts, nextAttemptAt, lastError, id)
+	return err
+}
+
+func (r *emailOutboxRepository) MarkFailed(ctx context.Context, id uuid.UUID, attempts int, lastError string) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE email_outbox
+		SET attempts = $1, failed_at = NOW(), last_error = $2, text_body = '', html_body = ''
+		WHERE id = $3
+	`, attempts, lastError, id)
+	return err
+}
+
+func (r *emailOutboxRepository) DeleteSentBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM email_outbox WHERE sent_at IS NOT NULL AND sent_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
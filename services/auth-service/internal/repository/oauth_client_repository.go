@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+var (
+	ErrOAuthClientNotFound = errors.New("oauth client not found")
+	ErrConsentNotFound     = errors.New("consent not found")
+)
+
+// OAuthClientRepository stores the applications registered with FlowMate's
+// authorization server and the consent users have given them.
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *models.OAuthClient) error
+	GetByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	ListByOwner(ctx context.Context, ownerID uuid.UUID) ([]*models.OAuthClient, error)
+	Delete(ctx context.Context, ownerID uuid.UUID, clientID string) error
+	// ListService and DeleteService manage service clients, which have no
+	// owner.
+	ListService(ctx context.Context) ([]*models.OAuthClient, error)
+	DeleteService(ctx context.Context, clientID string) error
+
+	GetConsent(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error)
+	// SaveConsent replaces the scopes the user has granted the client.
+	SaveConsent(ctx context.Context, userID uuid.UUID, clientID, scopes string) error
+	ListConsents(ctx context.Context, userID uuid.UUID) ([]*models.OAuthConsent, error)
+	DeleteConsent(ctx context.Context, userID uuid.UUID, clientID string) error
+}
+
+type oauthClientRepository struct {
+	db *sqlx.DB
+}
+
+func NewOAuthClientRepository(db *sqlx.DB) OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(ctx context.Context, client *models.OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (client_id, client_secret_hash, name, redirect_uris, scopes, public, owner_id, created_at, service, audiences, jwks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	client.CreatedAt = time.Now()
+	_, err := r.db.ExecContext(ctx, query,
+		client.ClientID,
+		client.ClientSecretHash,
+		client.Name,
+		client.RedirectURIs,
+		client.Scopes,
+		client.Public,
+		client.OwnerID,
+		client.CreatedAt,
+		client.Service,
+		client.Audiences,
+		client.JWKS,
+	)
+	return err
+}
+
+func (r *oauthClientRepository) GetByClientID(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	var client models.OAuthClient
+	err := r.db.GetContext(ctx, &client, `SELECT * FROM oauth_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (r *oauthClientRepository) ListByOwner(ctx context.Context, ownerID uuid.UUID) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	query := `SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY created_at`
+
+	if err := r.db.SelectContext(ctx, &clients, query, ownerID); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *oauthClientRepository) Delete(ctx context.Context, ownerID uuid.UUID, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_clients WHERE client_id = $1 AND owner_id = $2`, clientID, ownerID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (r *oauthClientRepository) ListService(ctx context.Context) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	query := `SELECT * FROM oauth_clients WHERE service ORDER BY created_at`
+
+	if err := r.db.SelectContext(ctx, &clients, query); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+func (r *oauthClientRepository) DeleteService(ctx context.Context, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_clients WHERE client_id = $1 AND service`, clientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+const consentColumns = `c.user_id, c.client_id, o.name AS client_name, c.scopes, c.granted_at, c.updated_at`
+
+func (r *oauthClientRepository) GetConsent(ctx context.Context, userID uuid.UUID, clientID string) (*models.OAuthConsent, error) {
+	var consent models.OAuthConsent
+	query := `
+		SELECT ` + consentColumns + ` FROM oauth_consents c
+		JOIN oauth_clients o ON o.client_id = c.client_id
+		WHERE c.user_id = $1 AND c.client_id = $2
+	`
+
+	err := r.db.GetContext(ctx, &consent, query, userID, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrConsentNotFound
+		}
+		return nil, err
+	}
+	return &consent, nil
+}
+
+func (r *oauthClientRepository) SaveConsent(ctx context.Context, userID uuid.UUID, clientID, scopes string) error {
+	query := `
+		INSERT INTO oauth_consents (user_id, client_id, scopes, granted_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (user_id, client_id) DO UPDATE SET
+			scopes = EXCLUDED.scopes,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query, userID, clientID, scopes)
+	return err
+}
+
+func (r *oauthClientRepository) ListConsents(ctx context.Context, userID uuid.UUID) ([]*models.OAuthConsent, error) {
+	var consents []*models.OAuthConsent
+	query := `
+		SELECT ` + consentColumns + ` FROM oauth_consents c
+		JOIN oauth_clients o ON o.client_id = c.client_id
+		WHERE c.user_id = $1 ORDER BY c.granted_at
+	`
+
+	if err := r.db.SelectContext(ctx, &consents, query, userID); err != nil {
+		return nil, err
+	}
+	return consents, nil
+}
+
+func (r *oauthClientRepository) DeleteConsent(ctx context.Context, userID uuid.UUID, clientID string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrConsentNotFound
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+var ErrProviderTokenNotFound = errors.New("provider token not found")
+
+type ProviderTokenRepository interface {
+	// Save stores the token for the identity (provider, subject). A nil
+	// refresh token keeps the one already stored, since providers usually
+	// issue it only on first consent.
+	Save(ctx context.Context, provider, subject string, token *models.ProviderToken) error
+	// SaveForIdentity updates the stored token after a refresh, with the
+	// same nil refresh token rule as Save.
+	SaveForIdentity(ctx context.Context, token *models.ProviderToken) error
+	GetByUser(ctx context.Context, userID uuid.UUID, provider string) (*models.ProviderToken, error)
+}
+
+type providerTokenRepository struct {
+	db *sqlx.DB
+}
+
+func NewProviderTokenRepository(db *sqlx.DB) ProviderTokenRepository {
+	return &providerTokenRepository{db: db}
+}
+
+func (r *providerTokenRepository) Save(ctx context.Context, provider, subject string, token *models.ProviderToken) error {
+	query := `
+		INSERT INTO provider_tokens (identity_id, access_token, refresh_token, scopes, expires_at, updated_at)
+		SELECT id, $3, $4, $5, $6, NOW() FROM user_identities WHERE provider = $1 AND subject = $2
+		ON CONFLICT (identity_id) DO UPDATE SET
+			access_token = EXCLUDED.access_token,
+			refresh_token = COALESCE(EXCLUDED.refresh_token, provider_tokens.refresh_token),
+			scopes = EXCLUDED.scopes,
+			expires_at = EXCLUDED.expires_at,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query, provider, subject, token.AccessToken, token.RefreshToken, token.Scopes, token.ExpiresAt)
+	return err
+}
+
+func (r *providerTokenRepository) SaveForIdentity(ctx context.Context, token *models.ProviderToken) error {
+	query := `
+		UPDATE provider_tokens SET
+			access_token = $2,
+			refresh_token = COALESCE($3, refresh_token),
+			scopes = $4,
+			expires_at = $5,
+			updated_at = NOW()
+		WHERE identity_id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, token.IdentityID, token.AccessToken, token.RefreshToken, token.Scopes, token.ExpiresAt)
+	return err
+}
+
+func (r *providerTokenRepository) GetByUser(ctx context.Context, userID uuid.UUID, provider string) (*models.ProviderToken, error) {
+	var token models.ProviderToken
+	query := `
+		SELECT t.* FROM provider_tokens t
+		JOIN user_identities i ON i.id = t.identity_id
+		WHERE i.user_id = $1 AND i.provider = $2
+	`
+
+	err := r.db.GetContext(ctx, &token, query, userID, provider)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrProviderTokenNotFound
+		}
+		return nil, err
+	}
+	return &token, nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+var (
+	ErrSigningKeyNotFound = errors.New("signing key not found")
+	ErrPendingKeyExists   = errors.New("a pending signing key already exists")
+)
+
+type SigningKeyRepository interface {
+	Create(ctx context.Context, key *models.SigningKey) error
+	List(ctx context.Context) ([]*models.SigningKey, error)
+	Activate(ctx context.Context, id string, retiredKeysExpireAt time.Time) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type signingKeyRepository struct {
+	db *sqlx.DB
+}
+
+func NewSigningKeyRepository(db *sqlx.DB) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+func (r *signingKeyRepository) Create(ctx context.Context, key *models.SigningKey) error {
+	query := `
+		INSERT INTO signing_keys (id, algorithm, private_key, created_at, activate_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	key.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query, key.ID, key.Algorithm, key.PrivateKey, key.CreatedAt, key.ActivateAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "idx_signing_keys_single_pending") {
+			return ErrPendingKeyExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *signingKeyRepository) List(ctx context.Context) ([]*models.SigningKey, error) {
+	var keys []*models.SigningKey
+	query := `
+		SELECT * FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	if err := r.db.SelectContext(ctx, &keys, query); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Activate switches signing to the given key. The previously active key is
+// retired but stays valid for verification until retiredKeysExpireAt.
+func (r *signingKeyRepository) Activate(ctx context.Context, id string, retiredKeysExpireAt time.Time) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.GetContext(ctx, &current, `SELECT id FROM signing_keys WHERE id = $1 FOR UPDATE`, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrSigningKeyNotFound
+		}
+		return err
+	}
+
+	now := time.Now()
+	_, err = tx.ExecContext(ctx, `
+		UPDATE signing_keys
+		SET retired_at = $1, expires_at = $2
+		WHERE activated_at IS NOT NULL AND retired_at IS NULL AND id <> $3
+	`, now, retiredKeysExpireAt, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE signing_keys
+		SET activated_at = COALESCE(activated_at, $1), retired_at = NULL, expires_at = NULL
+		WHERE id = $2
+	`, now, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *signingKeyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM signing_keys WHERE expires_at IS NOT NULL AND expires_at <= NOW()`)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
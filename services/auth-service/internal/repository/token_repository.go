@@ -3,19 +3,71 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strconv"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/flowmate/auth-service/internal/models"
 )
 
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrTokenFamilyNotFound  = errors.New("token family not found")
+	ErrResetTokenNotFound   = errors.New("password reset token not found")
+	ErrMFAChallengeNotFound = errors.New("mfa challenge not found")
+	ErrCeremonyNotFound     = errors.New("webauthn ceremony not found")
+	ErrOAuthStateNotFound   = errors.New("oauth state not found")
+	ErrLoginCodeNotFound    = errors.New("login code not found")
+	ErrAuthRequestNotFound  = errors.New("authorization request not found")
+	ErrAuthCodeNotFound     = errors.New("authorization code not found")
+	ErrDeviceCodeNotFound   = errors.New("device code not found")
+	ErrUserCodeInUse        = errors.New("user code already in use")
+)
+
 type TokenRepository interface {
 	StoreRefreshToken(ctx context.Context, token string, data *models.RefreshTokenData, expiry time.Duration) error
 	GetRefreshToken(ctx context.Context, token string) (*models.RefreshTokenData, error)
+	RotateRefreshToken(ctx context.Context, oldToken, newToken string, data *models.RefreshTokenData, expiry time.Duration) error
+	GetRotatedTokenFamily(ctx context.Context, token string) (string, error)
+	GetTokenFamily(ctx context.Context, familyID string) (*models.TokenFamily, error)
+	ListUserTokenFamilies(ctx context.Context, userID string) ([]*models.TokenFamily, error)
+	RevokeTokenFamily(ctx context.Context, familyID string) error
 	DeleteRefreshToken(ctx context.Context, token string) error
+	// DeleteUserTokens ends all of the user's sessions, client sessions
+	// without a refresh token included.
 	DeleteUserTokens(ctx context.Context, userID string) error
+	MigrateSessionIndex(ctx context.Context) error
+	TrackAccessToken(ctx context.Context, sessionID, jti string, expiresAt time.Time) error
+	TrackClientSession(ctx context.Context, userID, clientID, sessionID string, expiresAt time.Time) error
+	RevokeClientSessions(ctx context.Context, userID, clientID string) error
+	RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	StorePasswordResetToken(ctx context.Context, tokenHash, userID string, expiry time.Duration) error
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error)
+	StoreMFAChallenge(ctx context.Context, tokenHash, userID string, expiry time.Duration) error
+	AttemptMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (string, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) error
+	StoreWebAuthnCeremony(ctx context.Context, ceremonyID string, data []byte, expiry time.Duration) error
+	ConsumeWebAuthnCeremony(ctx context.Context, ceremonyID string) ([]byte, error)
+	StoreOAuthState(ctx context.Context, stateHash string, data *models.OAuthState, expiry time.Duration) error
+	ConsumeOAuthState(ctx context.Context, stateHash string) (*models.OAuthState, error)
+	StoreLoginCode(ctx context.Context, codeHash string, resp *models.AuthResponse, expiry time.Duration) error
+	ConsumeLoginCode(ctx context.Context, codeHash string) (*models.AuthResponse, error)
+	StoreAuthorizationRequest(ctx context.Context, requestID string, req *models.AuthorizationRequest, expiry time.Duration) error
+	GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error)
+	ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error)
+	StoreAuthorizationCode(ctx context.Context, codeHash string, code *models.AuthorizationCode, expiry time.Duration) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	UseClientAssertion(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error)
+	StoreDeviceAuthorization(ctx context.Context, deviceCodeHash string, auth *models.DeviceAuthorization, expiry time.Duration) error
+	GetDeviceAuthorization(ctx context.Context, userCode string) (string, *models.DeviceAuthorization, error)
+	DecideDeviceAuthorization(ctx context.Context, deviceCodeHash, userCode, decision string) error
+	PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, interval, slowDown time.Duration) (*models.DeviceAuthorization, bool, error)
 }
 
 type tokenRepository struct {
@@ -26,21 +78,198 @@ func NewTokenRepository(redis *redis.Client) TokenRepository {
 	return &tokenRepository{redis: redis}
 }
 
+const (
+	refreshTokenPrefix   = "refresh_token:"
+	tokenFamilyPrefix    = "refresh_family:"
+	userSessionsPrefix   = "user_sessions:"
+	sessionJTIsPrefix    = "session_jtis:"
+	clientSessionsPrefix = "client_sessions:"
+	revokedJTIPrefix     = "revoked_jti:"
+
+	passwordResetPrefix     = "password_reset:"
+	userPasswordResetPrefix = "password_reset_user:"
+	mfaChallengePrefix      = "mfa_challenge:"
+	webauthnCeremonyPrefix  = "webauthn_ceremony:"
+	oauthStatePrefix        = "oauth_state:"
+	loginCodePrefix         = "login_code:"
+	authRequestPrefix       = "oauth2_request:"
+	authCodePrefix          = "oauth2_code:"
+	clientAssertionPrefix   = "client_assertion:"
+	deviceCodePrefix        = "device_code:"
+	deviceUserCodePrefix    = "device_user_code:"
+	deviceGrantPrefix       = "device_grant:"
+	devicePollPrefix        = "device_poll:"
+
+	sessionIndexMigratedKey = "session_index:migrated"
+)
+
+func refreshTokenKey(token string) string {
+	return refreshTokenPrefix + token
+}
+
+func rotatedTokenKey(token string) string {
+	return fmt.Sprintf("refresh_token_rotated:%s", token)
+}
+
+func tokenFamilyKey(familyID string) string {
+	return tokenFamilyPrefix + familyID
+}
+
+// userSessionsKey holds the IDs of a user's token families so per-user
+// operations never have to scan the whole keyspace.
+func userSessionsKey(userID string) string {
+	return userSessionsPrefix + userID
+}
+
+func clientSessionsKey(userID string) string {
+	return clientSessionsPrefix + userID
+}
+
+// rotateScript consumes the old token and installs its successor in one step,
+// so a token can only ever be rotated once. The old token is replaced by a
+// tombstone pointing at its family for reuse detection.
+var rotateScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[1], 'EX', ARGV[3])
+redis.call('SET', KEYS[3], ARGV[2], 'EX', ARGV[3])
+redis.call('HSET', KEYS[4], 'user_id', ARGV[4], 'current_token', ARGV[5], 'last_used_at', ARGV[6], 'ip', ARGV[7], 'user_agent', ARGV[8])
+redis.call('HSETNX', KEYS[4], 'created_at', ARGV[6])
+redis.call('EXPIRE', KEYS[4], ARGV[3])
+redis.call('SADD', KEYS[5], ARGV[1])
+redis.call('EXPIRE', KEYS[5], ARGV[3])
+return 1
+`)
+
+// denylistSessionLua is shared by the scripts that end sessions: every access
+// token still outstanding for the session is denylisted until it expires.
+const denylistSessionLua = `
+local function denylistSession(sid, now)
+	local jtisKey = '` + sessionJTIsPrefix + `' .. sid
+	local entries = redis.call('ZRANGEBYSCORE', jtisKey, '(' .. now, '+inf', 'WITHSCORES')
+	for i = 1, #entries, 2 do
+		redis.call('SET', '` + revokedJTIPrefix + `' .. entries[i], 1, 'EX', tonumber(entries[i + 1]) - now)
+	end
+	redis.call('DEL', jtisKey)
+end
+`
+
+// ARGV: family id, refresh token prefix, user sessions prefix, now
+var revokeFamilyScript = redis.NewScript(denylistSessionLua + `
+local family = redis.call('HMGET', KEYS[1], 'current_token', 'user_id')
+if family[1] then
+	redis.call('DEL', ARGV[2] .. family[1])
+end
+if family[2] then
+	redis.call('SREM', ARGV[3] .. family[2], ARGV[1])
+end
+redis.call('DEL', KEYS[1])
+denylistSession(ARGV[1], tonumber(ARGV[4]))
+return 1
+`)
+
+// deleteTokenScript removes a single token. If it is the live token of its
+// family the family ends with it and is dropped from the user's index.
+// ARGV: token, family prefix, user sessions prefix, now
+var deleteTokenScript = redis.NewScript(denylistSessionLua + `
+local raw = redis.call('GET', KEYS[1])
+redis.call('DEL', KEYS[1])
+if not raw then
+	return 0
+end
+local ok, data = pcall(cjson.decode, raw)
+if not ok or type(data.family_id) ~= 'string' or data.family_id == '' then
+	return 1
+end
+local familyKey = ARGV[2] .. data.family_id
+if redis.call('HGET', familyKey, 'current_token') == ARGV[1] then
+	redis.call('DEL', familyKey)
+	redis.call('SREM', ARGV[3] .. data.user_id, data.family_id)
+	denylistSession(data.family_id, tonumber(ARGV[4]))
+end
+return 1
+`)
+
+// endClientSessionsLua ends the sessions of client grants that came without
+// a refresh token, which have no family to revoke. They are kept per user as
+// "<session id> <client id>" scored by when their access token expires.
+const endClientSessionsLua = denylistSessionLua + `
+local function endClientSessions(key, clientID, now)
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', now)
+	for _, member in ipairs(redis.call('ZRANGE', key, 0, -1)) do
+		local sid, client = string.match(member, '^(%S+) (.*)$')
+		if sid and (clientID == '' or client == clientID) then
+			denylistSession(sid, now)
+			redis.call('ZREM', key, member)
+		end
+	end
+end
+`
+
+// ARGV: client id, now
+var revokeClientSessionsScript = redis.NewScript(endClientSessionsLua + `
+endClientSessions(KEYS[1], ARGV[1], tonumber(ARGV[2]))
+return 1
+`)
+
+// ARGV: refresh token prefix, family prefix, now
+var deleteUserTokensScript = redis.NewScript(endClientSessionsLua + `
+local families = redis.call('SMEMBERS', KEYS[1])
+for _, id in ipairs(families) do
+	local familyKey = ARGV[2] .. id
+	local current = redis.call('HGET', familyKey, 'current_token')
+	if current then
+		redis.call('DEL', ARGV[1] .. current)
+	end
+	redis.call('DEL', familyKey)
+	denylistSession(id, tonumber(ARGV[3]))
+end
+redis.call('DEL', KEYS[1])
+endClientSessions(KEYS[2], '', tonumber(ARGV[3]))
+return #families
+`)
+
 func (r *tokenRepository) StoreRefreshToken(ctx context.Context, token string, data *models.RefreshTokenData, expiry time.Duration) error {
-	key := fmt.Sprintf("refresh_token:%s", token)
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	return r.redis.Set(ctx, key, jsonData, expiry).Err()
+
+	_, err = r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, refreshTokenKey(token), jsonData, expiry)
+		if data.FamilyID != "" {
+			familyKey := tokenFamilyKey(data.FamilyID)
+			now := time.Now().Unix()
+			fields := []interface{}{
+				"user_id", data.UserID,
+				"current_token", token,
+				"last_used_at", now,
+				"ip", data.IP,
+				"user_agent", data.UserAgent,
+			}
+			if data.ClientID != "" {
+				fields = append(fields, "client_id", data.ClientID)
+			}
+			pipe.HSet(ctx, familyKey, fields...)
+			pipe.HSetNX(ctx, familyKey, "created_at", now)
+			pipe.Expire(ctx, familyKey, expiry)
+			// The index must outlive the longest-lived family it holds.
+			pipe.SAdd(ctx, userSessionsKey(data.UserID), data.FamilyID)
+			pipe.ExpireNX(ctx, userSessionsKey(data.UserID), expiry)
+			pipe.ExpireGT(ctx, userSessionsKey(data.UserID), expiry)
+		}
+		return nil
+	})
+	return err
 }
 
 func (r *tokenRepository) GetRefreshToken(ctx context.Context, token string) (*models.RefreshTokenData, error) {
-	key := fmt.Sprintf("refresh_token:%s", token)
-	val, err := r.redis.Get(ctx, key).Result()
+	val, err := r.redis.Get(ctx, refreshTokenKey(token)).Result()
 	if err != nil {
 		if err == redis.Nil {
-			return nil, fmt.Errorf("refresh token not found")
+			return nil, ErrRefreshTokenNotFound
 		}
 		return nil, err
 	}
@@ -52,26 +281,585 @@ func (r *tokenRepository) GetRefreshToken(ctx context.Context, token string) (*m
 	return &data, nil
 }
 
+func (r *tokenRepository) RotateRefreshToken(ctx context.Context, oldToken, newToken string, data *models.RefreshTokenData, expiry time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	keys := []string{
+		refreshTokenKey(oldToken),
+		rotatedTokenKey(oldToken),
+		refreshTokenKey(newToken),
+		tokenFamilyKey(data.FamilyID),
+		userSessionsKey(data.UserID),
+	}
+	rotated, err := rotateScript.Run(ctx, r.redis, keys,
+		data.FamilyID, jsonData, int(expiry.Seconds()), data.UserID, newToken, time.Now().Unix(), data.IP, data.UserAgent,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if rotated == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+func (r *tokenRepository) GetRotatedTokenFamily(ctx context.Context, token string) (string, error) {
+	familyID, err := r.redis.Get(ctx, rotatedTokenKey(token)).Result()
+	if err != nil {
+		if err == redis.Nil {
+			return "", ErrRefreshTokenNotFound
+		}
+		return "", err
+	}
+	return familyID, nil
+}
+
+func (r *tokenRepository) GetTokenFamily(ctx context.Context, familyID string) (*models.TokenFamily, error) {
+	fields, err := r.redis.HGetAll(ctx, tokenFamilyKey(familyID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrTokenFamilyNotFound
+	}
+	return familyFromHash(familyID, fields), nil
+}
+
+func (r *tokenRepository) ListUserTokenFamilies(ctx context.Context, userID string) ([]*models.TokenFamily, error) {
+	ids, err := r.redis.SMembers(ctx, userSessionsKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return []*models.TokenFamily{}, nil
+	}
+
+	pipe := r.redis.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, tokenFamilyKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	families := make([]*models.TokenFamily, 0, len(ids))
+	var expired []interface{}
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			expired = append(expired, ids[i])
+			continue
+		}
+		families = append(families, familyFromHash(ids[i], fields))
+	}
+	if len(expired) > 0 {
+		// Families expire on their own; drop them from the index as we find them.
+		r.redis.SRem(ctx, userSessionsKey(userID), expired...)
+	}
+	return families, nil
+}
+
+func (r *tokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	return revokeFamilyScript.Run(ctx, r.redis, []string{tokenFamilyKey(familyID)},
+		familyID, refreshTokenPrefix, userSessionsPrefix, time.Now().Unix(),
+	).Err()
+}
+
 func (r *tokenRepository) DeleteRefreshToken(ctx context.Context, token string) error {
-	key := fmt.Sprintf("refresh_token:%s", token)
-	return r.redis.Del(ctx, key).Err()
+	return deleteTokenScript.Run(ctx, r.redis, []string{refreshTokenKey(token)},
+		token, tokenFamilyPrefix, userSessionsPrefix, time.Now().Unix(),
+	).Err()
 }
 
 func (r *tokenRepository) DeleteUserTokens(ctx context.Context, userID string) error {
-	iter := r.redis.Scan(ctx, 0, "refresh_token:*", 0).Iterator()
+	return deleteUserTokensScript.Run(ctx, r.redis, []string{userSessionsKey(userID), clientSessionsKey(userID)},
+		refreshTokenPrefix, tokenFamilyPrefix, time.Now().Unix(),
+	).Err()
+}
+
+// TrackAccessToken records an issued access token against its session so the
+// token can be denylisted when the session is revoked.
+func (r *tokenRepository) TrackAccessToken(ctx context.Context, sessionID, jti string, expiresAt time.Time) error {
+	key := sessionJTIsPrefix + sessionID
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: jti})
+		pipe.ExpireAt(ctx, key, expiresAt)
+		return nil
+	})
+	return err
+}
+
+// TrackClientSession records the session of a client grant that has no
+// refresh token until its access token expires, so the user can still end
+// it by revoking the app or resetting their password.
+func (r *tokenRepository) TrackClientSession(ctx context.Context, userID, clientID, sessionID string, expiresAt time.Time) error {
+	key := clientSessionsKey(userID)
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(time.Now().Unix(), 10))
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(expiresAt.Unix()), Member: sessionID + " " + clientID})
+		pipe.ExpireNX(ctx, key, time.Until(expiresAt))
+		pipe.ExpireGT(ctx, key, time.Until(expiresAt))
+		return nil
+	})
+	return err
+}
+
+// RevokeClientSessions ends the client's sessions tracked by
+// TrackClientSession, denylisting their access tokens.
+func (r *tokenRepository) RevokeClientSessions(ctx context.Context, userID, clientID string) error {
+	return revokeClientSessionsScript.Run(ctx, r.redis, []string{clientSessionsKey(userID)},
+		clientID, time.Now().Unix(),
+	).Err()
+}
+
+func (r *tokenRepository) RevokeAccessToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+	return r.redis.Set(ctx, revokedJTIPrefix+jti, 1, ttl).Err()
+}
+
+func (r *tokenRepository) IsAccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := r.redis.Exists(ctx, revokedJTIPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// storeResetScript replaces any outstanding reset token for the user, so only
+// the most recently emailed link works.
+var storeResetScript = redis.NewScript(`
+local previous = redis.call('GET', KEYS[2])
+if previous then
+  redis.call('DEL', ARGV[3] .. previous)
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+redis.call('SET', KEYS[2], ARGV[4], 'PX', ARGV[2])
+return 1
+`)
+
+// consumeResetScript redeems a reset token exactly once.
+var consumeResetScript = redis.NewScript(`
+local userID = redis.call('GET', KEYS[1])
+if not userID then
+  return false
+end
+redis.call('DEL', KEYS[1])
+local pointer = ARGV[1] .. userID
+if redis.call('GET', pointer) == ARGV[2] then
+  redis.call('DEL', pointer)
+end
+return userID
+`)
+
+// StorePasswordResetToken keeps only a hash of the token, so a Redis dump
+// cannot be used to reset passwords.
+func (r *tokenRepository) StorePasswordResetToken(ctx context.Context, tokenHash, userID string, expiry time.Duration) error {
+	return storeResetScript.Run(ctx, r.redis,
+		[]string{passwordResetPrefix + tokenHash, userPasswordResetPrefix + userID},
+		userID, expiry.Milliseconds(), passwordResetPrefix, tokenHash,
+	).Err()
+}
+
+func (r *tokenRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	userID, err := consumeResetScript.Run(ctx, r.redis,
+		[]string{passwordResetPrefix + tokenHash},
+		userPasswordResetPrefix, tokenHash,
+	).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrResetTokenNotFound
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+// attemptChallengeScript counts a verification attempt against a pending MFA
+// login and drops the challenge once it has been guessed at too often.
+var attemptChallengeScript = redis.NewScript(`
+local userID = redis.call('HGET', KEYS[1], 'user_id')
+if not userID then
+  return false
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) > tonumber(ARGV[1]) then
+  redis.call('DEL', KEYS[1])
+  return false
+end
+return userID
+`)
+
+func (r *tokenRepository) StoreMFAChallenge(ctx context.Context, tokenHash, userID string, expiry time.Duration) error {
+	key := mfaChallengePrefix + tokenHash
+	_, err := r.redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "user_id", userID, "attempts", 0)
+		pipe.Expire(ctx, key, expiry)
+		return nil
+	})
+	return err
+}
+
+// AttemptMFAChallenge returns the user a pending MFA login belongs to,
+// counting the call as one attempt.
+func (r *tokenRepository) AttemptMFAChallenge(ctx context.Context, tokenHash string, maxAttempts int) (string, error) {
+	userID, err := attemptChallengeScript.Run(ctx, r.redis,
+		[]string{mfaChallengePrefix + tokenHash}, maxAttempts,
+	).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrMFAChallengeNotFound
+		}
+		return "", err
+	}
+	return userID, nil
+}
+
+func (r *tokenRepository) DeleteMFAChallenge(ctx context.Context, tokenHash string) error {
+	return r.redis.Del(ctx, mfaChallengePrefix+tokenHash).Err()
+}
+
+func (r *tokenRepository) StoreWebAuthnCeremony(ctx context.Context, ceremonyID string, data []byte, expiry time.Duration) error {
+	return r.redis.Set(ctx, webauthnCeremonyPrefix+ceremonyID, data, expiry).Err()
+}
+
+// ConsumeWebAuthnCeremony returns and deletes the ceremony so each challenge
+// can be answered only once.
+func (r *tokenRepository) ConsumeWebAuthnCeremony(ctx context.Context, ceremonyID string) ([]byte, error) {
+	data, err := r.redis.GetDel(ctx, webauthnCeremonyPrefix+ceremonyID).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrCeremonyNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (r *tokenRepository) StoreOAuthState(ctx context.Context, stateHash string, data *models.OAuthState, expiry time.Duration) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, oauthStatePrefix+stateHash, jsonData, expiry).Err()
+}
+
+// ConsumeOAuthState returns and deletes the state so a callback URL cannot be
+// replayed.
+func (r *tokenRepository) ConsumeOAuthState(ctx context.Context, stateHash string) (*models.OAuthState, error) {
+	data, err := r.redis.GetDel(ctx, oauthStatePrefix+stateHash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrOAuthStateNotFound
+		}
+		return nil, err
+	}
+
+	var state models.OAuthState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (r *tokenRepository) StoreLoginCode(ctx context.Context, codeHash string, resp *models.AuthResponse, expiry time.Duration) error {
+	jsonData, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, loginCodePrefix+codeHash, jsonData, expiry).Err()
+}
+
+// ConsumeLoginCode returns and deletes the login result, so each code can be
+// exchanged once.
+func (r *tokenRepository) ConsumeLoginCode(ctx context.Context, codeHash string) (*models.AuthResponse, error) {
+	data, err := r.redis.GetDel(ctx, loginCodePrefix+codeHash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrLoginCodeNotFound
+		}
+		return nil, err
+	}
+
+	var resp models.AuthResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (r *tokenRepository) StoreAuthorizationRequest(ctx context.Context, requestID string, req *models.AuthorizationRequest, expiry time.Duration) error {
+	jsonData, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, authRequestPrefix+requestID, jsonData, expiry).Err()
+}
+
+// GetAuthorizationRequest reads a pending request without consuming it, so
+// the consent screen can be rendered before the user decides.
+func (r *tokenRepository) GetAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	return r.authorizationRequest(r.redis.Get(ctx, authRequestPrefix+requestID))
+}
+
+func (r *tokenRepository) ConsumeAuthorizationRequest(ctx context.Context, requestID string) (*models.AuthorizationRequest, error) {
+	return r.authorizationRequest(r.redis.GetDel(ctx, authRequestPrefix+requestID))
+}
+
+func (r *tokenRepository) authorizationRequest(cmd *redis.StringCmd) (*models.AuthorizationRequest, error) {
+	data, err := cmd.Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrAuthRequestNotFound
+		}
+		return nil, err
+	}
+
+	var req models.AuthorizationRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+func (r *tokenRepository) StoreAuthorizationCode(ctx context.Context, codeHash string, code *models.AuthorizationCode, expiry time.Duration) error {
+	jsonData, err := json.Marshal(code)
+	if err != nil {
+		return err
+	}
+	return r.redis.Set(ctx, authCodePrefix+codeHash, jsonData, expiry).Err()
+}
+
+// ConsumeAuthorizationCode returns and deletes the code, so each code can be
+// redeemed once.
+func (r *tokenRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	data, err := r.redis.GetDel(ctx, authCodePrefix+codeHash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrAuthCodeNotFound
+		}
+		return nil, err
+	}
+
+	var code models.AuthorizationCode
+	if err := json.Unmarshal(data, &code); err != nil {
+		return nil, err
+	}
+	return &code, nil
+}
+
+// UseClientAssertion records a private_key_jwt assertion ID until the
+// assertion expires. It returns false if the client already used the ID.
+func (r *tokenRepository) UseClientAssertion(ctx context.Context, clientID, jti string, expiry time.Duration) (bool, error) {
+	return r.redis.SetNX(ctx, clientAssertionPrefix+clientID+":"+jti, 1, expiry).Result()
+}
+
+// StoreDeviceAuthorization saves a new device authorization, indexed by its
+// user code as well. It fails with ErrUserCodeInUse if another pending
+// authorization has the same user code.
+func (r *tokenRepository) StoreDeviceAuthorization(ctx context.Context, deviceCodeHash string, auth *models.DeviceAuthorization, expiry time.Duration) error {
+	jsonData, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+
+	ok, err := r.redis.SetNX(ctx, deviceUserCodePrefix+auth.UserCode, deviceCodeHash, expiry).Result()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrUserCodeInUse
+	}
+	return r.redis.Set(ctx, deviceCodePrefix+deviceCodeHash, jsonData, expiry).Err()
+}
+
+// GetDeviceAuthorization looks up an undecided authorization by user code
+// and returns it with its device code hash.
+func (r *tokenRepository) GetDeviceAuthorization(ctx context.Context, userCode string) (string, *models.DeviceAuthorization, error) {
+	deviceCodeHash, err := r.redis.Get(ctx, deviceUserCodePrefix+userCode).Result()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil, ErrDeviceCodeNotFound
+		}
+		return "", nil, err
+	}
+
+	data, err := r.redis.Get(ctx, deviceCodePrefix+deviceCodeHash).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", nil, ErrDeviceCodeNotFound
+		}
+		return "", nil, err
+	}
+
+	var auth models.DeviceAuthorization
+	if err := json.Unmarshal(data, &auth); err != nil {
+		return "", nil, err
+	}
+	return deviceCodeHash, &auth, nil
+}
+
+// decideDeviceScript records the user's decision once and retires the user
+// code, so it cannot be approved again.
+var decideDeviceScript = redis.NewScript(`
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl <= 0 then
+  return 0
+end
+if not redis.call('SET', KEYS[2], ARGV[1], 'NX', 'PX', ttl) then
+  return 0
+end
+redis.call('DEL', KEYS[3])
+return 1
+`)
+
+// DecideDeviceAuthorization records decision, the approving user's ID or
+// models.DeviceDenied.
+func (r *tokenRepository) DecideDeviceAuthorization(ctx context.Context, deviceCodeHash, userCode, decision string) error {
+	decided, err := decideDeviceScript.Run(ctx, r.redis,
+		[]string{deviceCodePrefix + deviceCodeHash, deviceGrantPrefix + deviceCodeHash, deviceUserCodePrefix + userCode},
+		decision,
+	).Int()
+	if err != nil {
+		return err
+	}
+	if decided == 0 {
+		return ErrDeviceCodeNotFound
+	}
+	return nil
+}
+
+// pollDeviceScript returns the authorization and, once decided, the decision,
+// deleting the authorization so the decision is delivered once. Undecided
+// polls arriving sooner than the current interval after the previous one
+// lengthen the interval and are flagged for slow_down (RFC 8628 section
+// 3.5). Times are in milliseconds.
+var pollDeviceScript = redis.NewScript(`
+local data = redis.call('GET', KEYS[1])
+if not data then
+  return false
+end
+local decision = redis.call('GET', KEYS[2])
+if decision then
+  redis.call('DEL', KEYS[1], KEYS[2], KEYS[3])
+  return {data, decision, 0}
+end
+
+local now = tonumber(ARGV[1])
+local interval = tonumber(redis.call('HGET', KEYS[3], 'interval') or ARGV[2])
+local last = tonumber(redis.call('HGET', KEYS[3], 'last') or '0')
+local slow = 0
+if now - last < interval then
+  interval = interval + tonumber(ARGV[3])
+  slow = 1
+end
+redis.call('HSET', KEYS[3], 'interval', interval, 'last', now)
+redis.call('PEXPIRE', KEYS[3], redis.call('PTTL', KEYS[1]))
+return {data, '', slow}
+`)
+
+// PollDeviceAuthorization is called for each token request of the polling
+// device. The bool result asks the device to slow down.
+func (r *tokenRepository) PollDeviceAuthorization(ctx context.Context, deviceCodeHash string, interval, slowDown time.Duration) (*models.DeviceAuthorization, bool, error) {
+	result, err := pollDeviceScript.Run(ctx, r.redis,
+		[]string{deviceCodePrefix + deviceCodeHash, deviceGrantPrefix + deviceCodeHash, devicePollPrefix + deviceCodeHash},
+		time.Now().UnixMilli(), interval.Milliseconds(), slowDown.Milliseconds(),
+	).Slice()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, false, ErrDeviceCodeNotFound
+		}
+		return nil, false, err
+	}
+	if len(result) != 3 {
+		return nil, false, fmt.Errorf("unexpected device poll result %v", result)
+	}
+
+	data, _ := result[0].(string)
+	var auth models.DeviceAuthorization
+	if err := json.Unmarshal([]byte(data), &auth); err != nil {
+		return nil, false, err
+	}
+	switch decision, _ := result[1].(string); decision {
+	case "":
+	case models.DeviceDenied:
+		auth.Denied = true
+	default:
+		auth.UserID = decision
+	}
+	slow, _ := result[2].(int64)
+	return &auth, slow == 1, nil
+}
+
+// MigrateSessionIndex indexes refresh tokens issued before the per-user
+// session index existed, giving family-less tokens a family of their own.
+// It runs once per Redis instance and is safe to repeat.
+func (r *tokenRepository) MigrateSessionIndex(ctx context.Context) error {
+	done, err := r.redis.Exists(ctx, sessionIndexMigratedKey).Result()
+	if err != nil || done == 1 {
+		return err
+	}
+
+	migrated := 0
+	iter := r.redis.Scan(ctx, 0, refreshTokenPrefix+"*", 0).Iterator()
 	for iter.Next(ctx) {
 		key := iter.Val()
-		val, err := r.redis.Get(ctx, key).Result()
+		token := key[len(refreshTokenPrefix):]
+
+		data, err := r.GetRefreshToken(ctx, token)
 		if err != nil {
 			continue
 		}
-		var data models.RefreshTokenData
-		if err := json.Unmarshal([]byte(val), &data); err != nil {
+		ttl, err := r.redis.TTL(ctx, key).Result()
+		if err != nil || ttl <= 0 {
 			continue
 		}
-		if data.UserID == userID {
-			r.redis.Del(ctx, key)
+		if data.FamilyID == "" {
+			data.FamilyID = uuid.New().String()
+		}
+		if err := r.StoreRefreshToken(ctx, token, data, ttl); err != nil {
+			return err
 		}
+		migrated++
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("session index migration indexed %d refresh tokens", migrated)
+	return r.redis.Set(ctx, sessionIndexMigratedKey, time.Now().Unix(), 0).Err()
+}
+
+func familyFromHash(familyID string, fields map[string]string) *models.TokenFamily {
+	family := &models.TokenFamily{
+		ID:           familyID,
+		UserID:       fields["user_id"],
+		CurrentToken: fields["current_token"],
+		IP:           fields["ip"],
+		UserAgent:    fields["user_agent"],
+		ClientID:     fields["client_id"],
+	}
+	if ts, err := parseUnix(fields["created_at"]); err == nil {
+		family.CreatedAt = ts
+	}
+	if ts, err := parseUnix(fields["last_used_at"]); err == nil {
+		family.LastUsedAt = ts
+	} else {
+		family.LastUsedAt = family.CreatedAt
+	}
+	return family
+}
+
+func parseUnix(value string) (time.Time, error) {
+	sec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
 	}
-	return iter.Err()
+	return time.Unix(sec, 0), nil
 }
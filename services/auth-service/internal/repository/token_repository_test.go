@@ -0,0 +1,258 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+const testExpiry = time.Hour
+
+func newTestTokenRepository(t *testing.T) (TokenRepository, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewTokenRepository(client), mr
+}
+
+func refreshData(userID, familyID string) *models.RefreshTokenData {
+	return &models.RefreshTokenData{
+		UserID:    userID,
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(testExpiry),
+	}
+}
+
+// startFamily stores the first token of a family and an access token issued
+// alongside it.
+func startFamily(t *testing.T, repo TokenRepository, userID, familyID, token, jti string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := repo.StoreRefreshToken(ctx, token, refreshData(userID, familyID), testExpiry); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.TrackAccessToken(ctx, familyID, jti, time.Now().Add(15*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertRevoked(t *testing.T, repo TokenRepository, jti string, want bool) {
+	t.Helper()
+	revoked, err := repo.IsAccessTokenRevoked(context.Background(), jti)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != want {
+		t.Errorf("access token %s revoked = %v, want %v", jti, revoked, want)
+	}
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	repo, _ := newTestTokenRepository(t)
+	ctx := context.Background()
+	startFamily(t, repo, "user-1", "family-1", "token-1", "jti-1")
+
+	if err := repo.RotateRefreshToken(ctx, "token-1", "token-2", refreshData("user-1", "family-1"), testExpiry); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	if _, err := repo.GetRefreshToken(ctx, "token-1"); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("old token still redeemable: %v", err)
+	}
+	if _, err := repo.GetRefreshToken(ctx, "token-2"); err != nil {
+		t.Errorf("new token: %v", err)
+	}
+	family, err := repo.GetTokenFamily(ctx, "family-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if family.CurrentToken != "token-2" || family.UserID != "user-1" {
+		t.Errorf("family = %+v", family)
+	}
+	// The old token leaves a tombstone so its reuse can be traced.
+	if familyID, err := repo.GetRotatedTokenFamily(ctx, "token-1"); err != nil || familyID != "family-1" {
+		t.Errorf("rotated token family = %q, %v", familyID, err)
+	}
+
+	// A token is rotated at most once.
+	err = repo.RotateRefreshToken(ctx, "token-1", "token-3", refreshData("user-1", "family-1"), testExpiry)
+	if !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Fatalf("second rotation: err = %v, want %v", err, ErrRefreshTokenNotFound)
+	}
+	if _, err := repo.GetRefreshToken(ctx, "token-3"); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("token from a failed rotation was stored: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenConcurrently(t *testing.T) {
+	repo, _ := newTestTokenRepository(t)
+	startFamily(t, repo, "user-1", "family-1", "token-1", "jti-1")
+
+	const racers = 10
+	var wg sync.WaitGroup
+	errs := make([]error, racers)
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			next := fmt.Sprintf("token-2-%d", i)
+			errs[i] = repo.RotateRefreshToken(context.Background(), "token-1", next, refreshData("user-1", "family-1"), testExpiry)
+		}(i)
+	}
+	wg.Wait()
+
+	won := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, ErrRefreshTokenNotFound):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d rotations succeeded, want 1", won)
+	}
+}
+
+func TestRevokeTokenFamily(t *testing.T) {
+	repo, _ := newTestTokenRepository(t)
+	ctx := context.Background()
+	startFamily(t, repo, "user-1", "family-1", "token-1", "jti-1")
+	startFamily(t, repo, "user-1", "family-2", "token-a", "jti-a")
+	if err := repo.RotateRefreshToken(ctx, "token-1", "token-2", refreshData("user-1", "family-1"), testExpiry); err != nil {
+		t.Fatal(err)
+	}
+
+	// What the service does when token-1 is replayed.
+	familyID, err := repo.GetRotatedTokenFamily(ctx, "token-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.RevokeTokenFamily(ctx, familyID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := repo.GetRefreshToken(ctx, "token-2"); !errors.Is(err, ErrRefreshTokenNotFound) {
+		t.Errorf("current token survived revocation: %v", err)
+	}
+	if _, err := repo.GetTokenFamily(ctx, "family-1"); !errors.Is(err, ErrTokenFamilyNotFound) {
+		t.Errorf("family survived revocation: %v", err)
+	}
+	assertRevoked(t, repo, "jti-1", true)
+
+	// Other sessions are untouched.
+	families, err := repo.ListUserTokenFamilies(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 1 || families[0].ID != "family-2" {
+		t.Errorf("families = %+v, want only family-2", families)
+	}
+	assertRevoked(t, repo, "jti-a", false)
+}
+
+func TestDeleteRefreshToken(t *testing.T) {
+	repo, _ := newTestTokenRepository(t)
+	ctx := context.Background()
+	startFamily(t, repo, "user-1", "family-1", "token-1", "jti-1")
+	if err := repo.RotateRefreshToken(ctx, "token-1", "token-2", refreshData("user-1", "family-1"), testExpiry); err != nil {
+		t.Fatal(err)
+	}
+
+	// A superseded token no longer speaks for the family.
+	if err := repo.DeleteRefreshToken(ctx, "token-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTokenFamily(ctx, "family-1"); err != nil {
+		t.Fatalf("family ended by a superseded token: %v", err)
+	}
+
+	if err := repo.DeleteRefreshToken(ctx, "token-2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.GetTokenFamily(ctx, "family-1"); !errors.Is(err, ErrTokenFamilyNotFound) {
+		t.Errorf("family survived logout: %v", err)
+	}
+	assertRevoked(t, repo, "jti-1", true)
+	families, err := repo.ListUserTokenFamilies(ctx, "user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 0 {
+		t.Errorf("families = %+v, want none", families)
+	}
+}
+
+func TestDeleteUserTokens(t *testing.T) {
+	repo, mr := newTestTokenRepository(t)
+	ctx := context.Background()
+	startFamily(t, repo, "user-1", "family-1", "token-1", "jti-1")
+	startFamily(t, repo, "user-1", "family-2", "token-2", "jti-2")
+	startFamily(t, repo, "user-2", "family-3", "token-3", "jti-3")
+
+	// A client session without a refresh token.
+	expiresAt := time.Now().Add(15 * time.Minute)
+	if err := repo.TrackClientSession(ctx, "user-1", "client-1", "session-1", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.TrackAccessToken(ctx, "session-1", "jti-client", expiresAt); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repo.DeleteUserTokens(ctx, "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{"token-1", "token-2"} {
+		if _, err := repo.GetRefreshToken(ctx, token); !errors.Is(err, ErrRefreshTokenNotFound) {
+			t.Errorf("%s survived: %v", token, err)
+		}
+	}
+	for _, jti := range []string{"jti-1", "jti-2", "jti-client"} {
+		assertRevoked(t, repo, jti, true)
+	}
+	if mr.Exists(userSessionsKey("user-1")) || mr.Exists(clientSessionsKey("user-1")) {
+		t.Error("user-1 session indexes survived")
+	}
+
+	if _, err := repo.GetRefreshToken(ctx, "token-3"); err != nil {
+		t.Errorf("another user's token was deleted: %v", err)
+	}
+	assertRevoked(t, repo, "jti-3", false)
+}
+
+func TestRevokeClientSessions(t *testing.T) {
+	repo, _ := newTestTokenRepository(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(15 * time.Minute)
+	sessions := []struct{ session, client, jti string }{
+		{"session-1", "client-1", "jti-1"},
+		{"session-2", "client-2", "jti-2"},
+		{"session-3", "client-1", "jti-3"},
+	}
+	for _, s := range sessions {
+		if err := repo.TrackClientSession(ctx, "user-1", s.client, s.session, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.TrackAccessToken(ctx, s.session, s.jti, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := repo.RevokeClientSessions(ctx, "user-1", "client-1"); err != nil {
+		t.Fatal(err)
+	}
+	assertRevoked(t, repo, "jti-1", true)
+	assertRevoked(t, repo, "jti-2", false)
+	assertRevoked(t, repo, "jti-3", true)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,6 +17,9 @@ var (
 	ErrUserNotFound          = errors.New("user not found")
 	ErrEmailAlreadyExists    = errors.New("email already exists")
 	ErrUsernameAlreadyExists = errors.New("username already exists")
+	ErrIdentityNotFound      = errors.New("identity not linked")
+	ErrIdentityAlreadyLinked = errors.New("identity already linked to an account")
+	ErrLastSignInMethod      = errors.New("cannot remove the last sign-in method; add a password, passkey or another provider first")
 )
 
 type UserRepository interface {
@@ -23,9 +27,20 @@ type UserRepository interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	GetByUsername(ctx context.Context, username string) (*models.User, error)
-	GetByGitHubID(ctx context.Context, githubID string) (*models.User, error)
-	GetByGoogleID(ctx context.Context, googleID string) (*models.User, error)
+	// GetByIdentity finds the user linked to a provider account.
+	GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error)
+	CreateWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) error
+	ListIdentities(ctx context.Context, userID uuid.UUID) ([]*models.Identity, error)
+	LinkIdentity(ctx context.Context, identity *models.Identity) error
+	UpdateIdentityProfile(ctx context.Context, identity *models.Identity) error
+	// UnlinkIdentity fails with ErrLastSignInMethod rather than leave the
+	// user no way to sign in.
+	UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error
 	Update(ctx context.Context, user *models.User) error
+	MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) error
+	// UpdateAccess replaces the user's roles and scopes. Update leaves them
+	// alone, so profile changes cannot grant access.
+	UpdateAccess(ctx context.Context, id uuid.UUID, roles, scopes string) error
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
@@ -38,17 +53,44 @@ func NewUserRepository(db *sqlx.DB) UserRepository {
 }
 
 func (r *userRepository) Create(ctx context.Context, user *models.User) error {
+	return insertUser(ctx, r.db, user)
+}
+
+// CreateWithIdentity creates the user and its first provider identity in one
+// transaction, so a failed link never leaves an account nobody can sign in to.
+func (r *userRepository) CreateWithIdentity(ctx context.Context, user *models.User, identity *models.Identity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	identity.UserID = user.ID
+	if err := insertIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func insertUser(ctx context.Context, q sqlx.QueryerContext, user *models.User) error {
 	query := `
-		INSERT INTO users (id, email, username, password_hash, avatar_url, github_id, google_id, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, email, username, password_hash, avatar_url, email_verified_at, roles, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at
 	`
 
 	user.ID = uuid.New()
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
+	if user.Roles == "" {
+		user.Roles = models.RoleUser
+	}
 
-	err := r.db.QueryRowContext(
+	err := q.QueryRowxContext(
 		ctx,
 		query,
 		user.ID,
@@ -56,8 +98,9 @@ func (r *userRepository) Create(ctx context.Context, user *models.User) error {
 		user.Username,
 		user.PasswordHash,
 		user.AvatarURL,
-		user.GitHubID,
-		user.GoogleID,
+		user.EmailVerifiedAt,
+		user.Roles,
+		user.Scopes,
 		user.CreatedAt,
 		user.UpdatedAt,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
@@ -120,11 +163,15 @@ func (r *userRepository) GetByUsername(ctx context.Context, username string) (*m
 	return &user, nil
 }
 
-func (r *userRepository) GetByGitHubID(ctx context.Context, githubID string) (*models.User, error) {
+func (r *userRepository) GetByIdentity(ctx context.Context, provider, subject string) (*models.User, error) {
 	var user models.User
-	query := `SELECT * FROM users WHERE github_id = $1`
+	query := `
+		SELECT u.* FROM users u
+		JOIN user_identities i ON i.user_id = u.id
+		WHERE i.provider = $1 AND i.subject = $2
+	`
 
-	err := r.db.GetContext(ctx, &user, query, githubID)
+	err := r.db.GetContext(ctx, &user, query, provider, subject)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
@@ -135,27 +182,135 @@ func (r *userRepository) GetByGitHubID(ctx context.Context, githubID string) (*m
 	return &user, nil
 }
 
-func (r *userRepository) GetByGoogleID(ctx context.Context, googleID string) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE google_id = $1`
+func (r *userRepository) ListIdentities(ctx context.Context, userID uuid.UUID) ([]*models.Identity, error) {
+	query := `SELECT * FROM user_identities WHERE user_id = $1 ORDER BY linked_at`
+
+	identities := []*models.Identity{}
+	if err := r.db.SelectContext(ctx, &identities, query, userID); err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// LinkIdentity attaches a provider account to identity.UserID. It fails with
+// ErrIdentityAlreadyLinked when the account belongs to another user or the
+// user already has an account from that provider.
+func (r *userRepository) LinkIdentity(ctx context.Context, identity *models.Identity) error {
+	return insertIdentity(ctx, r.db, identity)
+}
+
+// UpdateIdentityProfile refreshes the stored email and profile after a
+// sign-in.
+func (r *userRepository) UpdateIdentityProfile(ctx context.Context, identity *models.Identity) error {
+	query := `
+		UPDATE user_identities SET email = $3, profile = $4
+		WHERE provider = $1 AND subject = $2
+	`
+	_, err := r.db.ExecContext(ctx, query, identity.Provider, identity.Subject, identity.Email, profileJSON(identity.Profile))
+	return err
+}
+
+func (r *userRepository) UnlinkIdentity(ctx context.Context, userID uuid.UUID, provider string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	methods, err := lockSignInMethods(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrIdentityNotFound
+	}
+	if methods-int(n) < 1 {
+		return ErrLastSignInMethod
+	}
+	return tx.Commit()
+}
 
-	err := r.db.GetContext(ctx, &user, query, googleID)
+// lockSignInMethods locks the user's row until tx ends and counts the ways
+// they can sign in: a password, passkeys and linked identities. Everything
+// that removes one takes the lock first, so concurrent removals cannot
+// together take away the last.
+func lockSignInMethods(ctx context.Context, tx *sqlx.Tx, userID uuid.UUID) (int, error) {
+	var hasPassword bool
+	err := tx.GetContext(ctx, &hasPassword, `SELECT COALESCE(password_hash, '') <> '' FROM users WHERE id = $1 FOR UPDATE`, userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrUserNotFound
+			return 0, ErrUserNotFound
 		}
-		return nil, err
+		return 0, err
 	}
 
-	return &user, nil
+	var methods int
+	err = tx.GetContext(ctx, &methods, `
+		SELECT (SELECT COUNT(*) FROM user_identities WHERE user_id = $1)
+		     + (SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1)
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+	if hasPassword {
+		methods++
+	}
+	return methods, nil
+}
+
+func insertIdentity(ctx context.Context, q sqlx.QueryerContext, identity *models.Identity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, provider, subject, email, profile, linked_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, linked_at
+	`
+
+	identity.ID = uuid.New()
+	identity.LinkedAt = time.Now()
+
+	err := q.QueryRowxContext(
+		ctx,
+		query,
+		identity.ID,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+		profileJSON(identity.Profile),
+		identity.LinkedAt,
+	).Scan(&identity.ID, &identity.LinkedAt)
+
+	if err != nil {
+		if strings.Contains(err.Error(), "user_identities_provider_subject_key") ||
+			strings.Contains(err.Error(), "user_identities_user_id_provider_key") {
+			return ErrIdentityAlreadyLinked
+		}
+		return err
+	}
+	return nil
+}
+
+func profileJSON(profile []byte) []byte {
+	if len(profile) == 0 {
+		return []byte("{}")
+	}
+	return profile
 }
 
 func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users 
-		SET email = $1, username = $2, password_hash = $3, avatar_url = $4, 
-		    github_id = $5, google_id = $6, updated_at = $7
-		WHERE id = $8
+		SET email = $1, username = $2, password_hash = $3, avatar_url = $4,
+		    email_verified_at = $5, updated_at = $6
+		WHERE id = $7
 	`
 
 	user.UpdatedAt = time.Now()
@@ -167,8 +322,7 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 		user.Username,
 		user.PasswordHash,
 		user.AvatarURL,
-		user.GitHubID,
-		user.GoogleID,
+		user.EmailVerifiedAt,
 		user.UpdatedAt,
 		user.ID,
 	)
@@ -176,6 +330,38 @@ func (r *userRepository) Update(ctx context.Context, user *models.User) error {
 	return err
 }
 
+// MarkEmailVerified only succeeds while the address still matches, so a link
+// sent before an email change cannot verify the new address.
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id uuid.UUID, email string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, NOW()), updated_at = NOW()
+		WHERE id = $1 AND email = $2
+	`
+
+	res, err := r.db.ExecContext(ctx, query, id, email)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) UpdateAccess(ctx context.Context, id uuid.UUID, roles, scopes string) error {
+	query := `UPDATE users SET roles = $1, scopes = $2, updated_at = NOW() WHERE id = $3`
+
+	res, err := r.db.ExecContext(ctx, query, roles, scopes, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 func (r *userRepository) Delete(ctx context.Context, id uuid.UUID) error {
 	query := `DELETE FROM users WHERE id = $1`
 	_, err := r.db.ExecContext(ctx, query, id)
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+)
+
+type WebAuthnRepository interface {
+	Create(ctx context.Context, credential *models.WebAuthnCredential) error
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.WebAuthnCredential, error)
+	CountByUser(ctx context.Context, userID uuid.UUID) (int, error)
+	UpdateUsage(ctx context.Context, credentialID []byte, signCount int64, flags int16) error
+	Delete(ctx context.Context, userID, id uuid.UUID) error
+}
+
+type webAuthnRepository struct {
+	db *sqlx.DB
+}
+
+func NewWebAuthnRepository(db *sqlx.DB) WebAuthnRepository {
+	return &webAuthnRepository{db: db}
+}
+
+func (r *webAuthnRepository) Create(ctx context.Context, credential *models.WebAuthnCredential) error {
+	query := `
+		INSERT INTO webauthn_credentials (id, user_id, credential_id, public_key, attestation_type, transports, aaguid, sign_count, flags, name, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	credential.ID = uuid.New()
+	credential.CreatedAt = time.Now()
+
+	_, err := r.db.ExecContext(ctx, query,
+		credential.ID,
+		credential.UserID,
+		credential.CredentialID,
+		credential.PublicKey,
+		credential.AttestationType,
+		credential.Transports,
+		credential.AAGUID,
+		credential.SignCount,
+		credential.Flags,
+		credential.Name,
+		credential.CreatedAt,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "webauthn_credentials_credential_id_key") {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *webAuthnRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]*models.WebAuthnCredential, error) {
+	var credentials []*models.WebAuthnCredential
+	query := `SELECT * FROM webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+
+	if err := r.db.SelectContext(ctx, &credentials, query, userID); err != nil {
+		return nil, err
+	}
+	return credentials, nil
+}
+
+func (r *webAuthnRepository) CountByUser(ctx context.Context, userID uuid.UUID) (int, error) {
+	var n int
+	err := r.db.GetContext(ctx, &n, `SELECT COUNT(*) FROM webauthn_credentials WHERE user_id = $1`, userID)
+	return n, err
+}
+
+// UpdateUsage stores the counter from a successful assertion. The counter
+// only moves forward, so two concurrent logins cannot roll it back.
+func (r *webAuthnRepository) UpdateUsage(ctx context.Context, credentialID []byte, signCount int64, flags int16) error {
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE webauthn_credentials
+		SET sign_count = GREATEST(sign_count, $1), flags = $2, last_used_at = NOW()
+		WHERE credential_id = $3
+	`, signCount, flags, credentialID)
+	return err
+}
+
+// Delete fails with ErrLastSignInMethod rather than leave the user no way to
+// sign in.
+func (r *webAuthnRepository) Delete(ctx context.Context, userID, id uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	methods, err := lockSignInMethods(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+	if methods-int(n) < 1 {
+		return ErrLastSignInMethod
+	}
+	return tx.Commit()
+}
@@ -7,9 +7,10 @@ import (
 
 	"github.com/flowmate/auth-service/internal/handlers"
 	"github.com/flowmate/auth-service/internal/middleware"
+	"github.com/flowmate/auth-service/internal/models"
 )
 
-func SetupAuthRoutes(app *fiber.App, authHandler *handlers.AuthHandler, rateLimiter *middleware.RateLimiter, authMiddleware *middleware.AuthMiddleware) {
+func SetupAuthRoutes(app *fiber.App, authHandler *handlers.AuthHandler, sessionHandler *handlers.SessionHandler, mfaHandler *handlers.MFAHandler, identityHandler *handlers.IdentityHandler, consentHandler *handlers.ConsentHandler, clientHandler *handlers.OAuthClientHandler, deviceHandler *handlers.DeviceHandler, patHandler *handlers.PersonalAccessTokenHandler, adminHandler *handlers.AdminHandler, rateLimiter *middleware.RateLimiter, authMiddleware *middleware.AuthMiddleware) {
 	api := app.Group("/api/v1")
 
 	auth := api.Group("/auth")
@@ -20,17 +21,97 @@ func SetupAuthRoutes(app *fiber.App, authHandler *handlers.AuthHandler, rateLimi
 	auth.Post("/login", authHandler.Login)
 	auth.Post("/refresh", authHandler.RefreshToken)
 	auth.Post("/logout", authHandler.Logout)
+	auth.Post("/mfa/verify", authHandler.VerifyMFA)
+	auth.Post("/verify-email", authHandler.VerifyEmail)
+	auth.Post("/verify-email/resend", authHandler.ResendVerification)
+	auth.Post("/forgot-password", authHandler.ForgotPassword)
+	auth.Post("/reset-password", authHandler.ResetPassword)
 
-	auth.Get("/oauth/github", authHandler.GetGitHubAuthURL)
-	auth.Get("/oauth/github/callback", authHandler.HandleGitHubCallback)
-	auth.Get("/oauth/github/callback/github", authHandler.HandleGitHubCallback)          // fallback if provider appended twice
-	auth.Get("/oauth/github/callback/github/callback", authHandler.HandleGitHubCallback) // fallback if provider appended twice
-	auth.Get("/oauth/google", authHandler.GetGoogleAuthURL)
-	auth.Get("/oauth/google/callback", authHandler.HandleGoogleCallback)
-	auth.Get("/oauth/google/callback/google", authHandler.HandleGoogleCallback)
-	auth.Get("/oauth/google/callback/google/callback", authHandler.HandleGoogleCallback)
+	auth.Post("/oauth/exchange", authHandler.ExchangeOAuthCode)
+	auth.Get("/oauth/:provider", authHandler.GetOAuthAuthURL)
+	auth.Get("/oauth/:provider/callback", authHandler.HandleOAuthCallback)
+
+	// The profile is also open to OAuth clients and personal access tokens
+	// granted account:read. It is registered ahead of the group so the
+	// first-party check below never runs for it.
+	api.Get("/user/me", authMiddleware.Protect(), authMiddleware.RequirePrincipal(models.PrincipalUser), authMiddleware.RequireScopes(models.ScopeAccountRead), authHandler.Me)
 
 	protected := api.Group("/user")
-	protected.Use(authMiddleware.Protect())
-	protected.Get("/me", authHandler.Me)
+	protected.Use(authMiddleware.Protect(), authMiddleware.FirstPartyOnly())
+
+	// Disabling TOTP and replacing recovery codes take a current code, so
+	// guessing it is throttled per user like sign-in is.
+	mfaCodeLimit := func(c *fiber.Ctx) error { return c.Next() }
+	if rateLimiter != nil {
+		mfaCodeLimit = rateLimiter.Limit(5, time.Minute)
+	}
+
+	protected.Get("/sessions", sessionHandler.List)
+	protected.Delete("/sessions", sessionHandler.RevokeOthers)
+	protected.Delete("/sessions/:id", sessionHandler.Revoke)
+	protected.Get("/mfa", mfaHandler.Status)
+	protected.Post("/mfa/totp", mfaHandler.EnrollTOTP)
+	protected.Post("/mfa/totp/confirm", mfaHandler.ConfirmTOTP)
+	protected.Delete("/mfa/totp", mfaCodeLimit, mfaHandler.DisableTOTP)
+	protected.Post("/mfa/recovery-codes", mfaCodeLimit, mfaHandler.RegenerateRecoveryCodes)
+	protected.Get("/identities", identityHandler.List)
+	protected.Post("/identities/:provider", identityHandler.Link)
+	protected.Delete("/identities/:provider", identityHandler.Unlink)
+	protected.Get("/oauth/requests/:id", consentHandler.Get)
+	protected.Post("/oauth/requests/:id", consentHandler.Decide)
+	protected.Get("/authorized-apps", consentHandler.List)
+	protected.Delete("/authorized-apps/:client_id", consentHandler.Revoke)
+	protected.Get("/oauth-clients", clientHandler.List)
+	protected.Post("/oauth-clients", authMiddleware.RequireVerifiedEmail(), clientHandler.Register)
+	protected.Delete("/oauth-clients/:client_id", clientHandler.Delete)
+	protected.Get("/personal-access-tokens", patHandler.List)
+	protected.Post("/personal-access-tokens", authMiddleware.RequireVerifiedEmail(), patHandler.Create)
+	protected.Delete("/personal-access-tokens/:id", patHandler.Revoke)
+
+	// User codes are short, so guessing them is throttled per user.
+	device := protected.Group("/device")
+	if rateLimiter != nil {
+		device.Use(rateLimiter.Limit(10, time.Minute))
+	}
+	device.Get("", deviceHandler.Get)
+	device.Post("", deviceHandler.Decide)
+
+	admin := api.Group("/admin", authMiddleware.Protect(), authMiddleware.FirstPartyOnly(), authMiddleware.RequireRole(models.RoleAdmin))
+	admin.Get("/users/:id/access", adminHandler.GetUserAccess)
+	admin.Put("/users/:id/access", adminHandler.UpdateUserAccess)
+}
+
+func SetupOAuth2Routes(app *fiber.App, oauth2Handler *handlers.OAuth2Handler) {
+	app.Get("/.well-known/openid-configuration", oauth2Handler.Discovery)
+
+	oauth2 := app.Group("/oauth2")
+	oauth2.Get("/authorize", oauth2Handler.Authorize)
+	oauth2.Post("/token", oauth2Handler.Token)
+	oauth2.Post("/device_authorization", oauth2Handler.DeviceAuthorization)
+	oauth2.Get("/userinfo", oauth2Handler.UserInfo)
+	oauth2.Post("/userinfo", oauth2Handler.UserInfo)
+	oauth2.Post("/introspect", oauth2Handler.Introspect)
+	oauth2.Post("/revoke", oauth2Handler.Revoke)
+}
+
+// SetupInternalRoutes registers service-to-service endpoints. They take
+// client_credentials tokens whose audience includes SERVICE_AUDIENCE, which
+// Protect checks, and each route requires its own scope.
+func SetupInternalRoutes(app *fiber.App, providerTokenHandler *handlers.ProviderTokenHandler, authMiddleware *middleware.AuthMiddleware) {
+	internal := app.Group("/internal/v1", authMiddleware.Protect(), authMiddleware.RequirePrincipal(models.PrincipalService))
+	internal.Get("/users/:id/provider-tokens/:provider", authMiddleware.RequireScopes(models.ScopeProviderTokensRead), providerTokenHandler.Get)
+}
+
+func SetupWebAuthnRoutes(app *fiber.App, webauthnHandler *handlers.WebAuthnHandler, authMiddleware *middleware.AuthMiddleware) {
+	webauthn := app.Group("/api/v1/auth/webauthn")
+	webauthn.Post("/login/begin", webauthnHandler.BeginLogin)
+	webauthn.Post("/login/finish", webauthnHandler.FinishLogin)
+	webauthn.Post("/mfa/begin", webauthnHandler.BeginMFA)
+	webauthn.Post("/mfa/finish", webauthnHandler.FinishMFA)
+
+	protected := webauthn.Group("", authMiddleware.Protect(), authMiddleware.FirstPartyOnly())
+	protected.Post("/register/begin", webauthnHandler.BeginRegistration)
+	protected.Post("/register/finish", webauthnHandler.FinishRegistration)
+	protected.Get("/credentials", webauthnHandler.ListCredentials)
+	protected.Delete("/credentials/:id", webauthnHandler.DeleteCredential)
 }
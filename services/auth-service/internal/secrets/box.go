@@ -0,0 +1,75 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/flowmate/auth-service/internal/config"
+)
+
+var ErrMalformedCiphertext = errors.New("malformed ciphertext")
+
+// Box encrypts secrets that are persisted at rest with AES-256-GCM.
+type Box struct {
+	aead cipher.AEAD
+}
+
+func NewBox(key []byte) (*Box, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+func LoadBox(cfg *config.Config) (*Box, error) {
+	if cfg.EncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEY must be base64: %w", err)
+		}
+		return NewBox(key)
+	}
+
+	if cfg.Environment == "production" {
+		return nil, errors.New("ENCRYPTION_KEY is required in production")
+	}
+
+	log.Println("ENCRYPTION_KEY not set, deriving one from JWT_SECRET")
+	key := sha256.Sum256([]byte("flowmate-encryption:" + cfg.JWTSecret))
+	return NewBox(key[:])
+}
+
+func (b *Box) Seal(plaintext []byte) (string, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := b.aead.Seal(nonce, nonce, plaintext, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (b *Box) Open(ciphertext string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, ErrMalformedCiphertext
+	}
+	if len(raw) < b.aead.NonceSize() {
+		return nil, ErrMalformedCiphertext
+	}
+	nonce, sealed := raw[:b.aead.NonceSize()], raw[b.aead.NonceSize():]
+	return b.aead.Open(nil, nonce, sealed, nil)
+}
@@ -0,0 +1,95 @@
+package secrets
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+)
+
+var (
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrSignedTokenExpired = errors.New("signed token expired")
+)
+
+// Signer issues compact HMAC-signed tokens for links sent outside the
+// service, such as email verification. The purpose is part of the signed
+// payload so a token minted for one flow cannot be replayed in another.
+type Signer struct {
+	key []byte
+}
+
+type signedPayload struct {
+	Purpose string          `json:"p"`
+	Expires int64           `json:"e"`
+	Data    json.RawMessage `json:"d"`
+}
+
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key}
+}
+
+func LoadSigner(cfg *config.Config) *Signer {
+	secret := cfg.EncryptionKey
+	if secret == "" {
+		secret = cfg.JWTSecret
+	}
+	key := sha256.Sum256([]byte("flowmate-signing:" + secret))
+	return NewSigner(key[:])
+}
+
+func (s *Signer) Sign(purpose string, data interface{}, ttl time.Duration) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(signedPayload{
+		Purpose: purpose,
+		Expires: time.Now().Add(ttl).Unix(),
+		Data:    raw,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+func (s *Signer) Verify(purpose, token string, data interface{}) error {
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidSignature
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return ErrInvalidSignature
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	var payload signedPayload
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return ErrInvalidSignature
+	}
+	if payload.Purpose != purpose {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > payload.Expires {
+		return ErrSignedTokenExpired
+	}
+	return json.Unmarshal(payload.Data, data)
+}
+
+func (s *Signer) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.key)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -12,14 +14,33 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/events"
+	"github.com/flowmate/auth-service/internal/keys"
+	"github.com/flowmate/auth-service/internal/mailer"
 	"github.com/flowmate/auth-service/internal/models"
 	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+	"github.com/flowmate/auth-service/pkg/authz"
 )
 
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrTokenExpired       = errors.New("token expired")
-	ErrInvalidToken       = errors.New("invalid token")
+	ErrInvalidToken       = authz.ErrInvalidToken
+	ErrTokenReused        = errors.New("refresh token reuse detected")
+	ErrTokenRevoked       = authz.ErrTokenRevoked
+	// ErrRevocationUnavailable is returned when the denylist cannot be
+	// consulted and DENYLIST_FAILURE_POLICY is "closed".
+	ErrRevocationUnavailable = authz.ErrUnavailable
+	// ErrEmailNotVerified is returned when UNVERIFIED_USER_POLICY is "block"
+	// and the account has not confirmed its address yet.
+	ErrEmailNotVerified = errors.New("email address not verified")
+	ErrInvalidMFAToken  = errors.New("invalid or expired mfa token")
+)
+
+const (
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
 )
 
 type AuthService interface {
@@ -29,18 +50,40 @@ type AuthService interface {
 	Logout(ctx context.Context, refreshToken string) error
 	GetUserByID(ctx context.Context, userID uuid.UUID) (*models.UserResponse, error)
 	ValidateToken(ctx context.Context, tokenString string) (*models.Claims, error)
+	IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*models.IntrospectionResponse, error)
+	RevokeToken(ctx context.Context, clientID, token, tokenTypeHint string) error
+	VerifyEmail(ctx context.Context, token string) (*models.UserResponse, error)
+	ResendVerification(ctx context.Context, email string) error
+	VerifyMFA(ctx context.Context, mfaToken, code string) (*models.AuthResponse, error)
+	BeginWebAuthnMFA(ctx context.Context, mfaToken string) (*models.WebAuthnCeremony, error)
+	VerifyWebAuthnMFA(ctx context.Context, mfaToken, ceremonyID string, credential []byte) (*models.AuthResponse, error)
+	PasskeyLogin(ctx context.Context, ceremonyID string, credential []byte) (*models.AuthResponse, error)
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
 }
 
 type authService struct {
 	userRepo  repository.UserRepository
 	tokenRepo repository.TokenRepository
+	keys      keys.KeySet
+	events    events.Emitter
+	mailer    mailer.Mailer
+	signer    *secrets.Signer
+	mfa       MFAService
+	webauthn  WebAuthnService
 	cfg       *config.Config
 }
 
-func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, cfg *config.Config) AuthService {
+func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, keySet keys.KeySet, emitter events.Emitter, m mailer.Mailer, signer *secrets.Signer, mfa MFAService, webauthn WebAuthnService, cfg *config.Config) AuthService {
 	return &authService{
 		userRepo:  userRepo,
 		tokenRepo: tokenRepo,
+		keys:      keySet,
+		events:    emitter,
+		mailer:    m,
+		signer:    signer,
+		mfa:       mfa,
+		webauthn:  webauthn,
 		cfg:       cfg,
 	}
 }
@@ -61,21 +104,16 @@ func (s *authService) Register(ctx context.Context, req *models.RegisterRequest)
 		return nil, err
 	}
 
-	tokens, err := s.generateTokens(user)
-	if err != nil {
-		return nil, err
+	// A mail outage should not fail registration; the user can ask for the
+	// link again.
+	if err := s.sendVerification(ctx, user); err != nil {
+		log.Printf("failed to send verification email to user %s: %v", user.ID, err)
 	}
 
-	if err := s.storeRefreshToken(ctx, tokens.RefreshToken, user); err != nil {
-		return nil, err
+	if s.cfg.UnverifiedUserPolicy == "block" {
+		return &models.AuthResponse{User: user.ToResponse(), EmailVerificationRequired: true}, nil
 	}
-
-	return &models.AuthResponse{
-		User:         user.ToResponse(),
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresIn:    tokens.ExpiresIn,
-	}, nil
+	return s.startSession(ctx, user)
 }
 
 func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*models.AuthResponse, error) {
@@ -88,26 +126,63 @@ func (s *authService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 		return nil, ErrInvalidCredentials
 	}
 
-	tokens, err := s.generateTokens(user)
+	return s.signIn(ctx, user)
+}
+
+// VerifyMFA completes a login that signIn paused for a second factor.
+func (s *authService) VerifyMFA(ctx context.Context, mfaToken, code string) (*models.AuthResponse, error) {
+	userID, err := s.mfaChallengeUser(ctx, mfaToken)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.mfa.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.completeMFA(ctx, mfaToken, userID)
+}
 
-	if err := s.storeRefreshToken(ctx, tokens.RefreshToken, user); err != nil {
+// mfaChallengeUser resolves a pending MFA login to its user. Every call counts
+// as an attempt, so a challenge cannot be guessed at indefinitely.
+func (s *authService) mfaChallengeUser(ctx context.Context, mfaToken string) (uuid.UUID, error) {
+	userIDStr, err := s.tokenRepo.AttemptMFAChallenge(ctx, hashToken(mfaToken), mfaChallengeMaxAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeNotFound) {
+			return uuid.Nil, ErrInvalidMFAToken
+		}
+		return uuid.Nil, err
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return uuid.Nil, ErrInvalidMFAToken
+	}
+	return userID, nil
+}
+
+func (s *authService) completeMFA(ctx context.Context, mfaToken string, userID uuid.UUID) (*models.AuthResponse, error) {
+	if err := s.tokenRepo.DeleteMFAChallenge(ctx, hashToken(mfaToken)); err != nil {
 		return nil, err
 	}
 
-	return &models.AuthResponse{
-		User:         user.ToResponse(),
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresIn:    tokens.ExpiresIn,
-	}, nil
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user)
 }
 
 func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*models.AuthResponse, error) {
 	tokenData, err := s.tokenRepo.GetRefreshToken(ctx, refreshToken)
 	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, s.detectReuse(ctx, refreshToken)
+		}
+		return nil, ErrInvalidToken
+	}
+
+	if tokenData.ClientID != "" {
+		// Tokens held by OAuth clients are refreshed at /oauth2/token and
+		// must not be traded for an unrestricted first-party session.
 		return nil, ErrInvalidToken
 	}
 
@@ -126,14 +201,22 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 		return nil, err
 	}
 
-	_ = s.tokenRepo.DeleteRefreshToken(ctx, refreshToken)
+	familyID := tokenData.FamilyID
+	if familyID == "" {
+		// Tokens issued before families existed start a new one on rotation.
+		familyID = uuid.New().String()
+	}
 
-	tokens, err := s.generateTokens(user)
+	tokens, err := s.generateTokens(ctx, user, familyID)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := s.storeRefreshToken(ctx, tokens.RefreshToken, user); err != nil {
+	data := s.refreshTokenData(ctx, user, familyID)
+	if err := s.tokenRepo.RotateRefreshToken(ctx, refreshToken, tokens.RefreshToken, data, s.refreshExpiry()); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
 		return nil, err
 	}
 
@@ -145,8 +228,43 @@ func (s *authService) RefreshToken(ctx context.Context, refreshToken string) (*m
 	}, nil
 }
 
+// detectReuse handles a refresh token that is no longer redeemable. If it was
+// already rotated, someone is replaying it, so the whole family is revoked.
+func (s *authService) detectReuse(ctx context.Context, refreshToken string) error {
+	familyID, err := s.tokenRepo.GetRotatedTokenFamily(ctx, refreshToken)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var userID string
+	if family, err := s.tokenRepo.GetTokenFamily(ctx, familyID); err == nil {
+		userID = family.UserID
+	}
+
+	if err := s.tokenRepo.RevokeTokenFamily(ctx, familyID); err != nil {
+		return err
+	}
+
+	s.events.Emit(ctx, events.SecurityEvent{
+		Type:      events.RefreshTokenReuse,
+		UserID:    userID,
+		SessionID: familyID,
+	})
+	return ErrTokenReused
+}
+
 func (s *authService) Logout(ctx context.Context, refreshToken string) error {
-	return s.tokenRepo.DeleteRefreshToken(ctx, refreshToken)
+	tokenData, err := s.tokenRepo.GetRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil
+		}
+		return err
+	}
+	if tokenData.FamilyID == "" {
+		return s.tokenRepo.DeleteRefreshToken(ctx, refreshToken)
+	}
+	return s.tokenRepo.RevokeTokenFamily(ctx, tokenData.FamilyID)
 }
 
 func (s *authService) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.UserResponse, error) {
@@ -158,29 +276,133 @@ func (s *authService) GetUserByID(ctx context.Context, userID uuid.UUID) (*model
 }
 
 func (s *authService) ValidateToken(ctx context.Context, tokenString string) (*models.Claims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(s.cfg.JWTSecret), nil
-	})
+	token, err := jwt.Parse(tokenString, keys.Keyfunc(s.keys), jwt.WithValidMethods(keys.ValidMethods()))
 	if err != nil {
 		return nil, ErrInvalidToken
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return &models.Claims{
-			UserID:   claims["user_id"].(string),
-			Email:    claims["email"].(string),
-			Username: claims["username"].(string),
-		}, nil
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	result, err := authz.FromJWT(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkRevoked(ctx, result.ID); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkRevoked consults the jti denylist. A short timeout keeps a slow Redis
+// from stalling every authenticated request; what happens when the lookup
+// fails is decided by DENYLIST_FAILURE_POLICY.
+func (s *authService) checkRevoked(ctx context.Context, jti string) error {
+	if jti == "" {
+		return nil
+	}
+
+	lookupCtx, cancel := context.WithTimeout(ctx, time.Duration(s.cfg.DenylistTimeoutMS)*time.Millisecond)
+	defer cancel()
+
+	revoked, err := s.tokenRepo.IsAccessTokenRevoked(lookupCtx, jti)
+	if err != nil {
+		if s.cfg.DenylistFailurePolicy == "closed" {
+			return ErrRevocationUnavailable
+		}
+		log.Printf("denylist lookup failed, accepting token %s: %v", jti, err)
+		return nil
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// signIn finishes a successful primary authentication. Accounts with a second
+// factor get a short-lived MFA challenge instead of tokens.
+func (s *authService) signIn(ctx context.Context, user *models.User) (*models.AuthResponse, error) {
+	if err := s.checkEmailPolicy(user); err != nil {
+		return nil, err
+	}
+
+	methods, err := s.mfaMethods(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(methods) == 0 {
+		return s.startSession(ctx, user)
+	}
+
+	mfaToken, err := s.generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepo.StoreMFAChallenge(ctx, hashToken(mfaToken), user.ID.String(), mfaChallengeTTL); err != nil {
+		return nil, err
+	}
+	return &models.AuthResponse{User: user.ToResponse(), MFARequired: true, MFAToken: mfaToken, MFAMethods: methods}, nil
+}
+
+func (s *authService) mfaMethods(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	var methods []string
+
+	totpEnabled, err := s.mfa.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totpEnabled {
+		methods = append(methods, models.MFAMethodTOTP)
+	}
+
+	hasPasskeys, err := s.webauthn.HasCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if hasPasskeys {
+		methods = append(methods, models.MFAMethodWebAuthn)
+	}
+	return methods, nil
+}
+
+func (s *authService) checkEmailPolicy(user *models.User) error {
+	if s.cfg.UnverifiedUserPolicy == "block" && !user.IsEmailVerified() {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
+
+// startSession issues the first token pair of a new login session. Every
+// sign-in method ends here so sessions look the same regardless of origin.
+func (s *authService) startSession(ctx context.Context, user *models.User) (*models.AuthResponse, error) {
+	if err := s.checkEmailPolicy(user); err != nil {
+		return nil, err
+	}
+
+	familyID := uuid.New().String()
+
+	tokens, err := s.generateTokens(ctx, user, familyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storeRefreshToken(ctx, tokens.RefreshToken, user, familyID); err != nil {
+		return nil, err
 	}
 
-	return nil, ErrInvalidToken
+	return &models.AuthResponse{
+		User:         user.ToResponse(),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	}, nil
 }
 
-func (s *authService) generateTokens(user *models.User) (*models.TokenPair, error) {
-	accessToken, err := s.generateAccessToken(user)
+func (s *authService) generateTokens(ctx context.Context, user *models.User, sessionID string) (*models.TokenPair, error) {
+	accessToken, err := s.generateAccessToken(ctx, user, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -197,17 +419,46 @@ func (s *authService) generateTokens(user *models.User) (*models.TokenPair, erro
 	}, nil
 }
 
-func (s *authService) generateAccessToken(user *models.User) (string, error) {
+func (s *authService) generateAccessToken(ctx context.Context, user *models.User, sessionID string) (string, error) {
+	return s.signAccessToken(ctx, user, sessionID, nil)
+}
+
+// signAccessToken issues an access token for the session; extra claims are
+// added on top of the standard user claims, and nil ones remove them.
+func (s *authService) signAccessToken(ctx context.Context, user *models.User, sessionID string, extra jwt.MapClaims) (string, error) {
+	jti := uuid.New().String()
+	expiresAt := time.Now().Add(time.Minute * time.Duration(s.cfg.JWTExpiryMinutes))
 	claims := jwt.MapClaims{
+		"jti":      jti,
+		"iss":      s.cfg.IssuerURL,
 		"user_id":  user.ID.String(),
 		"email":    user.Email,
 		"username": user.Username,
-		"exp":      time.Now().Add(time.Minute * time.Duration(s.cfg.JWTExpiryMinutes)).Unix(),
+		"sid":      sessionID,
+		"exp":      expiresAt.Unix(),
 		"iat":      time.Now().Unix(),
+		"roles":    strings.Fields(user.Roles),
+		"scope":    strings.Join(userScopes(s.cfg, user), " "),
+
+		"email_verified": user.IsEmailVerified(),
+	}
+	for name, value := range extra {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.cfg.JWTSecret))
+	key, err := s.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.tokenRepo.TrackAccessToken(ctx, sessionID, jti, expiresAt); err != nil {
+		return "", err
+	}
+	return key.Sign(claims)
 }
 
 func (s *authService) generateRefreshToken() (string, error) {
@@ -218,12 +469,22 @@ func (s *authService) generateRefreshToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(b), nil
 }
 
-func (s *authService) storeRefreshToken(ctx context.Context, token string, user *models.User) error {
-	data := &models.RefreshTokenData{
+func (s *authService) storeRefreshToken(ctx context.Context, token string, user *models.User, familyID string) error {
+	return s.tokenRepo.StoreRefreshToken(ctx, token, s.refreshTokenData(ctx, user, familyID), s.refreshExpiry())
+}
+
+func (s *authService) refreshTokenData(ctx context.Context, user *models.User, familyID string) *models.RefreshTokenData {
+	client := clientInfoFrom(ctx)
+	return &models.RefreshTokenData{
 		UserID:    user.ID.String(),
 		Email:     user.Email,
-		ExpiresAt: time.Now().Add(time.Hour * 24 * time.Duration(s.cfg.RefreshExpiryDays)),
+		FamilyID:  familyID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(s.refreshExpiry()),
 	}
-	expiry := time.Hour * 24 * time.Duration(s.cfg.RefreshExpiryDays)
-	return s.tokenRepo.StoreRefreshToken(ctx, token, data, expiry)
+}
+
+func (s *authService) refreshExpiry() time.Duration {
+	return time.Hour * 24 * time.Duration(s.cfg.RefreshExpiryDays)
 }
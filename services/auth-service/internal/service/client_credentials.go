@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/oidc"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const (
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// maxAssertionLifetime bounds how far ahead a client assertion may
+	// expire, and so how long its jti has to be remembered.
+	maxAssertionLifetime = 5 * time.Minute
+	assertionLeeway      = time.Minute
+)
+
+// assertionAlgs are accepted on client assertions. Clients register public
+// keys only, so HMAC and "none" never are.
+var assertionAlgs = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// ClientCredentials issues a service client a token of its own (RFC 6749
+// section 4.4). The client may narrow the scopes and audiences it was
+// registered with, never widen them.
+func (s *authorizationServer) ClientCredentials(ctx context.Context, client *models.OAuthClient, scope, audience string) (*models.OAuth2TokenResponse, error) {
+	if !client.Service {
+		return nil, oauth2Error("unauthorized_client", "the client_credentials grant is only available to service clients")
+	}
+
+	registered := strings.Fields(client.Scopes)
+	scopes := oauth.ParseScopes(scope)
+	if len(scopes) == 0 {
+		scopes = registered
+	} else if !hasScopes(registered, scopes) {
+		return nil, oauth2Error("invalid_scope", "the client is not allowed to request these scopes")
+	}
+
+	registered = strings.Fields(client.Audiences)
+	audiences := strings.Fields(audience)
+	if len(audiences) == 0 {
+		audiences = registered
+	} else if !hasScopes(registered, audiences) {
+		// RFC 8707 section 2.
+		return nil, oauth2Error("invalid_target", "the client is not allowed to request these audiences")
+	}
+
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+	return issuer.issueServiceToken(client.ClientID, scopes, audiences)
+}
+
+// issueServiceToken signs a token whose subject is the client itself. It
+// belongs to no session and comes without a refresh token; the client asks
+// for a new one when it expires.
+func (s *authService) issueServiceToken(clientID string, scopes, audiences []string) (*models.OAuth2TokenResponse, error) {
+	now := time.Now()
+	expiresIn := s.cfg.ServiceTokenExpiryMinutes * 60
+	scope := strings.Join(scopes, " ")
+	claims := jwt.MapClaims{
+		"jti":       uuid.New().String(),
+		"iss":       s.cfg.IssuerURL,
+		"sub":       clientID,
+		"client_id": clientID,
+		"aud":       audiences,
+		"scope":     scope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(time.Duration(expiresIn) * time.Second).Unix(),
+	}
+
+	key, err := s.keys.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := key.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &models.OAuth2TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   expiresIn,
+		Scope:       scope,
+	}, nil
+}
+
+// authenticateAssertion verifies a private_key_jwt client assertion (RFC
+// 7523 section 3): signed with a key the client registered, issued by and
+// about the client, addressed to this server and used only once.
+func (s *authorizationServer) authenticateAssertion(ctx context.Context, auth *models.ClientAuthentication) (*models.OAuthClient, error) {
+	if auth.AssertionType != clientAssertionType || auth.Assertion == "" || auth.ClientSecret != "" {
+		return nil, oauth2Error("invalid_client", "")
+	}
+
+	// The issuer names the client whose keys verify the signature.
+	unverified := jwt.MapClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(auth.Assertion, unverified); err != nil {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	clientID, _ := unverified.GetIssuer()
+	if clientID == "" || (auth.ClientID != "" && auth.ClientID != clientID) {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	client, err := s.clients.GetByClientID(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, oauth2Error("invalid_client", "")
+		}
+		return nil, err
+	}
+	if client.JWKS == nil {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	keys, err := oidc.ParseKeySet([]byte(*client.JWKS))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(auth.Assertion, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := oidc.LookupKey(keys, kid)
+		if !ok {
+			return nil, oidc.ErrUnknownKey
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods(assertionAlgs),
+		jwt.WithIssuer(clientID),
+		jwt.WithSubject(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(assertionLeeway),
+	)
+	if err != nil {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !s.assertionAudience(claims) {
+		return nil, oauth2Error("invalid_client", "")
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil || time.Until(exp.Time) > maxAssertionLifetime {
+		return nil, oauth2Error("invalid_client", "client assertion must expire within 5 minutes")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, oauth2Error("invalid_client", "client assertion has no jti")
+	}
+	fresh, err := s.tokenRepo.UseClientAssertion(ctx, clientID, jti, time.Until(exp.Time)+assertionLeeway)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		return nil, oauth2Error("invalid_client", "client assertion was already used")
+	}
+	return client, nil
+}
+
+// assertionAudience accepts the token endpoint URL, which RFC 7523 asks for,
+// as well as the issuer identifier.
+func (s *authorizationServer) assertionAudience(claims jwt.MapClaims) bool {
+	audiences, err := claims.GetAudience()
+	if err != nil {
+		return false
+	}
+	for _, aud := range audiences {
+		if aud == s.cfg.IssuerURL || aud == s.cfg.IssuerURL+"/oauth2/token" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/keys"
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+// newServiceClientTest registers a private_key_jwt service client, billing,
+// and returns the key it signs assertions with.
+func newServiceClientTest(t *testing.T) (*codeExchangeTest, *models.OAuthClient, *keys.Key) {
+	t.Helper()
+	tt := newCodeExchangeTest(t)
+	tt.auth.cfg.ServiceTokenExpiryMinutes = 5
+
+	key, err := keys.Generate(keys.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &models.OAuthClient{
+		ClientID:  "billing",
+		Service:   true,
+		Scopes:    "workflows:read workflows:write",
+		Audiences: "workflows mail",
+		JWKS:      publicJWKS(t, key),
+	}
+	tt.server.clients = fakeClients{clients: map[string]*models.OAuthClient{client.ClientID: client}}
+	return tt, client, key
+}
+
+// publicJWKS is the key set a client registers for key.
+func publicJWKS(t *testing.T, key *keys.Key) *string {
+	t.Helper()
+	data, err := json.Marshal(keys.JWKS{Keys: []keys.JWK{*keys.NewJWK(key)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := string(data)
+	return &set
+}
+
+// assertionClaims are valid claims for a billing client assertion.
+func assertionClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss": "billing",
+		"sub": "billing",
+		"aud": "https://auth.example/oauth2/token",
+		"jti": uuid.New().String(),
+		"iat": now.Unix(),
+		"exp": now.Add(time.Minute).Unix(),
+	}
+}
+
+func signAssertion(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) *models.ClientAuthentication {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	assertion, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.ClientAuthentication{AssertionType: clientAssertionType, Assertion: assertion}
+}
+
+func TestAuthenticateAssertion(t *testing.T) {
+	other, err := keys.Generate(keys.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		// sign defaults to the client's registered key.
+		sign    func(t *testing.T, key *keys.Key, claims jwt.MapClaims) *models.ClientAuthentication
+		wantErr bool
+	}{
+		{name: "valid"},
+		{name: "issuer identifier as audience", modify: func(c jwt.MapClaims) { c["aud"] = "https://auth.example" }},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "https://other.example/oauth2/token" }, wantErr: true},
+		{name: "expires too far ahead", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(10 * time.Minute).Unix() }, wantErr: true},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-5 * time.Minute).Unix() }, wantErr: true},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "no jti", modify: func(c jwt.MapClaims) { delete(c, "jti") }, wantErr: true},
+		{name: "subject is someone else", modify: func(c jwt.MapClaims) { c["sub"] = "mail" }, wantErr: true},
+		{name: "unknown client", modify: func(c jwt.MapClaims) { c["iss"], c["sub"] = "mail", "mail" }, wantErr: true},
+		{
+			name: "signed with an unregistered key",
+			sign: func(t *testing.T, key *keys.Key, claims jwt.MapClaims) *models.ClientAuthentication {
+				return signAssertion(t, other.SigningMethod(), other.SignKey(), key.ID, claims)
+			},
+			wantErr: true,
+		},
+		{
+			// The public key set is no secret, so it must not work as one.
+			name: "HS256",
+			sign: func(t *testing.T, key *keys.Key, claims jwt.MapClaims) *models.ClientAuthentication {
+				return signAssertion(t, jwt.SigningMethodHS256, []byte(*publicJWKS(t, key)), key.ID, claims)
+			},
+			wantErr: true,
+		},
+		{
+			name: "none",
+			sign: func(t *testing.T, key *keys.Key, claims jwt.MapClaims) *models.ClientAuthentication {
+				return signAssertion(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, key.ID, claims)
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt, client, key := newServiceClientTest(t)
+			claims := assertionClaims()
+			if tc.modify != nil {
+				tc.modify(claims)
+			}
+			var auth *models.ClientAuthentication
+			if tc.sign != nil {
+				auth = tc.sign(t, key, claims)
+			} else {
+				auth = signAssertion(t, key.SigningMethod(), key.SignKey(), key.ID, claims)
+			}
+
+			got, err := tt.server.AuthenticateClient(context.Background(), auth)
+			if tc.wantErr {
+				assertOAuth2Error(t, err, "invalid_client")
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ClientID != client.ClientID {
+				t.Errorf("client = %s, want %s", got.ClientID, client.ClientID)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAssertionReplay(t *testing.T) {
+	tt, _, key := newServiceClientTest(t)
+	ctx := context.Background()
+	auth := signAssertion(t, key.SigningMethod(), key.SignKey(), key.ID, assertionClaims())
+
+	if _, err := tt.server.AuthenticateClient(ctx, auth); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	_, err := tt.server.AuthenticateClient(ctx, auth)
+	assertOAuth2Error(t, err, "invalid_client")
+}
+
+func TestClientCredentials(t *testing.T) {
+	tests := []struct {
+		name         string
+		scope        string
+		audience     string
+		wantErr      string
+		wantScope    string
+		wantAudience []string
+	}{
+		{name: "registered scopes and audiences", wantScope: "workflows:read workflows:write", wantAudience: []string{"workflows", "mail"}},
+		{name: "narrowed", scope: "workflows:read", audience: "mail", wantScope: "workflows:read", wantAudience: []string{"mail"}},
+		{name: "widened scope", scope: "workflows:read billing:write", wantErr: "invalid_scope"},
+		{name: "widened audience", audience: "workflows billing", wantErr: "invalid_target"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt, client, _ := newServiceClientTest(t)
+			ctx := context.Background()
+
+			resp, err := tt.server.ClientCredentials(ctx, client, tc.scope, tc.audience)
+			if tc.wantErr != "" {
+				assertOAuth2Error(t, err, tc.wantErr)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Scope != tc.wantScope || resp.RefreshToken != "" {
+				t.Errorf("scope = %q, refresh token = %q; want %q and none", resp.Scope, resp.RefreshToken, tc.wantScope)
+			}
+			claims, err := tt.auth.ValidateToken(ctx, resp.AccessToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !claims.IsService() || claims.Subject != client.ClientID {
+				t.Errorf("principal = %s %s, want service %s", claims.Principal, claims.Subject, client.ClientID)
+			}
+			if !reflect.DeepEqual(claims.Audience, tc.wantAudience) {
+				t.Errorf("audience = %v, want %v", claims.Audience, tc.wantAudience)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsOnlyForServiceClients(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	_, err := tt.server.ClientCredentials(context.Background(), tt.client, "", "")
+	assertOAuth2Error(t, err, "unauthorized_client")
+}
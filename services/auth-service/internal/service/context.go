@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+type clientInfoKey struct{}
+
+// WithClientInfo attaches the caller's IP and user agent so that sessions
+// created or refreshed during the request can record where they are used.
+func WithClientInfo(ctx context.Context, info models.ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func clientInfoFrom(ctx context.Context) models.ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(models.ClientInfo)
+	return info
+}
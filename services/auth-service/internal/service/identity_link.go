@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+var (
+	ErrProviderAlreadyLinked = errors.New("a different account from this provider is already linked")
+	ErrLastSignInMethod      = repository.ErrLastSignInMethod
+)
+
+func (s *oauthService) ListSignInMethods(ctx context.Context, userID uuid.UUID) (*models.SignInMethods, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := s.userRepo.ListIdentities(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	passkeys, err := s.credRepo.CountByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SignInMethods{
+		HasPassword: user.PasswordHash != "",
+		Passkeys:    passkeys,
+		Identities:  identities,
+	}, nil
+}
+
+func (s *oauthService) StartLink(ctx context.Context, userID uuid.UUID, provider string, scopes []string) (*models.OAuthStart, error) {
+	if _, err := s.userRepo.GetByID(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.startAuth(ctx, provider, userID.String(), scopes)
+}
+
+// CompleteLink attaches the provider account that just signed in to the
+// user who started the link. No email match is needed: the user proved
+// control of both accounts in the same browser.
+func (s *oauthService) CompleteLink(ctx context.Context, provider, code string, state *models.OAuthState) error {
+	userID, err := uuid.Parse(state.LinkUserID)
+	if err != nil {
+		return ErrInvalidOAuthState
+	}
+
+	identity, err := s.exchange(ctx, provider, code, state)
+	if err != nil {
+		return err
+	}
+
+	if owner, err := s.userRepo.GetByIdentity(ctx, identity.Provider, identity.Subject); err == nil {
+		if owner.ID != userID {
+			return repository.ErrIdentityAlreadyLinked
+		}
+		// Already linked: this was a consent for more scopes.
+		return s.tokens.Save(ctx, identity)
+	} else if !errors.Is(err, repository.ErrUserNotFound) {
+		return err
+	}
+
+	identities, err := s.userRepo.ListIdentities(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, linked := range identities {
+		if linked.Provider == identity.Provider {
+			return ErrProviderAlreadyLinked
+		}
+	}
+
+	if err := s.userRepo.LinkIdentity(ctx, identityRecord(identity, userID)); err != nil {
+		return err
+	}
+	return s.tokens.Save(ctx, identity)
+}
+
+func (s *oauthService) Unlink(ctx context.Context, userID uuid.UUID, provider string) error {
+	return s.userRepo.UnlinkIdentity(ctx, userID, provider)
+}
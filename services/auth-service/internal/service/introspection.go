@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+var inactiveToken = &models.IntrospectionResponse{Active: false}
+
+// IntrospectToken implements RFC 7662. The hint only decides which token type
+// is tried first; both are always checked.
+func (s *authService) IntrospectToken(ctx context.Context, token, tokenTypeHint string) (*models.IntrospectionResponse, error) {
+	lookups := []func(context.Context, string) (*models.IntrospectionResponse, error){
+		s.introspectAccessToken,
+		s.introspectRefreshToken,
+	}
+	if tokenTypeHint == models.TokenTypeHintRefreshToken {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		resp, err := lookup(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		if resp.Active {
+			return resp, nil
+		}
+	}
+	return inactiveToken, nil
+}
+
+func (s *authService) introspectAccessToken(ctx context.Context, token string) (*models.IntrospectionResponse, error) {
+	claims, err := s.ValidateToken(ctx, token)
+	if err != nil {
+		return inactiveToken, nil
+	}
+
+	return &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Scopes, " "),
+		ClientID:  claims.ClientID,
+		Username:  claims.Username,
+		TokenType: "Bearer",
+		Exp:       claims.ExpiresAt.Unix(),
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       claims.Subject,
+		Aud:       claims.Audience,
+		Jti:       claims.ID,
+		SessionID: claims.SessionID,
+	}, nil
+}
+
+func (s *authService) introspectRefreshToken(ctx context.Context, token string) (*models.IntrospectionResponse, error) {
+	data, err := s.tokenRepo.GetRefreshToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return inactiveToken, nil
+		}
+		return nil, err
+	}
+	if time.Now().After(data.ExpiresAt) {
+		return inactiveToken, nil
+	}
+
+	return &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(data.Scopes, " "),
+		ClientID:  data.ClientID,
+		Username:  data.Email,
+		TokenType: models.TokenTypeHintRefreshToken,
+		Exp:       data.ExpiresAt.Unix(),
+		Sub:       data.UserID,
+		SessionID: data.FamilyID,
+	}, nil
+}
+
+// RevokeToken implements RFC 7009 for the client clientID. Revoking a refresh
+// token ends its whole session, including the access tokens issued to it.
+// Tokens issued to another client are left alone (section 2.1) unless the
+// caller is one of OAUTH_GATEWAY_CLIENTS. Neither they nor unknown or already
+// invalid tokens are an error, so callers cannot probe for tokens.
+func (s *authService) RevokeToken(ctx context.Context, clientID, token, tokenTypeHint string) error {
+	if tokenTypeHint != models.TokenTypeHintAccessToken {
+		found, err := s.revokeRefreshToken(ctx, clientID, token)
+		if err != nil || found {
+			return err
+		}
+	}
+
+	if claims, err := s.ValidateToken(ctx, token); err == nil {
+		if claims.ID == "" || !s.mayRevoke(clientID, claims.ClientID) {
+			return nil
+		}
+		return s.tokenRepo.RevokeAccessToken(ctx, claims.ID, claims.ExpiresAt)
+	}
+
+	if tokenTypeHint == models.TokenTypeHintAccessToken {
+		_, err := s.revokeRefreshToken(ctx, clientID, token)
+		return err
+	}
+	return nil
+}
+
+// revokeRefreshToken reports whether token is a refresh token, whether or
+// not the caller was allowed to revoke it.
+func (s *authService) revokeRefreshToken(ctx context.Context, clientID, token string) (bool, error) {
+	data, err := s.tokenRepo.GetRefreshToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if !s.mayRevoke(clientID, data.ClientID) {
+		return true, nil
+	}
+	if data.FamilyID == "" {
+		return true, s.tokenRepo.DeleteRefreshToken(ctx, token)
+	}
+	return true, s.tokenRepo.RevokeTokenFamily(ctx, data.FamilyID)
+}
+
+// mayRevoke reports whether caller may revoke a token issued to owner, which
+// is empty for first-party tokens.
+func (s *authService) mayRevoke(caller, owner string) bool {
+	if caller == "" {
+		return false
+	}
+	return caller == owner || isGatewayClient(s.cfg, caller)
+}
+
+// isGatewayClient reports whether clientID is listed in OAUTH_GATEWAY_CLIENTS,
+// the first-party gateways trusted with every user's tokens.
+func isGatewayClient(cfg *config.Config, clientID string) bool {
+	return clientID != "" && hasScopes(oauth.ParseScopes(cfg.GatewayClients), []string{clientID})
+}
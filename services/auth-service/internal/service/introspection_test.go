@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+func TestRevokeTokenOnlyForItsClient(t *testing.T) {
+	tests := []struct {
+		name        string
+		caller      string
+		gateways    string
+		wantRevoked bool
+	}{
+		{"issuing client", "client-1", "", true},
+		{"other client", "client-2", "", false},
+		{"gateway client", "gateway", "gateway", true},
+		{"other client with gateways configured", "client-2", "gateway", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newCodeExchangeTest(t)
+			tt.auth.cfg.GatewayClients = tc.gateways
+			ctx := context.Background()
+			resp, err := tt.server.ExchangeCode(ctx, tt.client, tt.issueCode(t, models.ScopeOpenID, models.ScopeOfflineAccess), testRedirectURI, testCodeVerifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.auth.RevokeToken(ctx, tc.caller, resp.RefreshToken, ""); err != nil {
+				t.Fatalf("revoke refresh token: %v", err)
+			}
+			_, err = tt.tokens.GetRefreshToken(ctx, resp.RefreshToken)
+			if revoked := errors.Is(err, repository.ErrRefreshTokenNotFound); revoked != tc.wantRevoked {
+				t.Errorf("refresh token revoked = %v, want %v", revoked, tc.wantRevoked)
+			}
+			_, err = tt.auth.ValidateToken(ctx, resp.AccessToken)
+			if revoked := errors.Is(err, ErrTokenRevoked); revoked != tc.wantRevoked {
+				t.Errorf("access token revoked with its session = %v, want %v", revoked, tc.wantRevoked)
+			}
+		})
+	}
+}
+
+func TestRevokeAccessTokenOnlyForItsClient(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	ctx := context.Background()
+	resp, err := tt.server.ExchangeCode(ctx, tt.client, tt.issueCode(t, models.ScopeOpenID), testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tt.auth.RevokeToken(ctx, "client-2", resp.AccessToken, models.TokenTypeHintAccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.auth.ValidateToken(ctx, resp.AccessToken); err != nil {
+		t.Fatalf("another client revoked the token: %v", err)
+	}
+
+	if err := tt.auth.RevokeToken(ctx, tt.client.ClientID, resp.AccessToken, models.TokenTypeHintAccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.auth.ValidateToken(ctx, resp.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("err = %v, want %v", err, ErrTokenRevoked)
+	}
+}
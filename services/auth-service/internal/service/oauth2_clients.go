@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+var ErrInvalidClientMetadata = errors.New("invalid client metadata")
+
+var defaultClientScopes = []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail}
+
+func (s *authorizationServer) RegisterClient(ctx context.Context, ownerID uuid.UUID, req *models.OAuthClientRequest) (*models.OAuthClientResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidClientMetadata)
+	}
+	if len(req.RedirectURIs) == 0 {
+		return nil, fmt.Errorf("%w: at least one redirect_uri is required", ErrInvalidClientMetadata)
+	}
+	for _, uri := range req.RedirectURIs {
+		if err := validateRedirectURI(uri); err != nil {
+			return nil, err
+		}
+	}
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultClientScopes
+	}
+	if !hasScopes(s.supportedScopes(), scopes) {
+		return nil, fmt.Errorf("%w: unsupported scope", ErrInvalidClientMetadata)
+	}
+
+	clientID, err := randomClientID()
+	if err != nil {
+		return nil, err
+	}
+	client := &models.OAuthClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: strings.Join(req.RedirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+		Public:       req.Public,
+		OwnerID:      &ownerID,
+	}
+
+	var secret string
+	if !client.Public {
+		secret, err = randomURLToken()
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecretHash = stringPtr(hashToken(secret))
+	}
+
+	if err := s.clients.Create(ctx, client); err != nil {
+		return nil, err
+	}
+	resp := client.ToResponse()
+	resp.ClientSecret = secret
+	return resp, nil
+}
+
+// validateRedirectURI accepts absolute https URIs, and plain http only for
+// loopback addresses used by native apps and local development.
+func validateRedirectURI(uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return fmt.Errorf("%w: invalid redirect_uri %q", ErrInvalidClientMetadata, uri)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: redirect_uri must use https: %q", ErrInvalidClientMetadata, uri)
+}
+
+func randomClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *authorizationServer) ListClients(ctx context.Context, ownerID uuid.UUID) ([]*models.OAuthClientResponse, error) {
+	clients, err := s.clients.ListByOwner(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		out = append(out, client.ToResponse())
+	}
+	return out, nil
+}
+
+func (s *authorizationServer) DeleteClient(ctx context.Context, ownerID uuid.UUID, clientID string) error {
+	return s.clients.Delete(ctx, ownerID, clientID)
+}
+
+func (s *authorizationServer) ListAuthorizedApps(ctx context.Context, userID uuid.UUID) ([]*models.AuthorizedAppResponse, error) {
+	consents, err := s.clients.ListConsents(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.AuthorizedAppResponse, 0, len(consents))
+	for _, consent := range consents {
+		out = append(out, consent.ToResponse())
+	}
+	return out, nil
+}
+
+func (s *authorizationServer) RevokeAuthorizedApp(ctx context.Context, userID uuid.UUID, clientID string) error {
+	if err := s.clients.DeleteConsent(ctx, userID, clientID); err != nil {
+		return err
+	}
+
+	families, err := s.tokenRepo.ListUserTokenFamilies(ctx, userID.String())
+	if err != nil {
+		return err
+	}
+	for _, family := range families {
+		if family.ClientID != clientID {
+			continue
+		}
+		if err := s.tokenRepo.RevokeTokenFamily(ctx, family.ID); err != nil {
+			return err
+		}
+	}
+	return s.tokenRepo.RevokeClientSessions(ctx, userID.String(), clientID)
+}
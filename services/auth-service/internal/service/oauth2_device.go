@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const (
+	deviceCodeTTL = 10 * time.Minute
+	// deviceCodeGrace keeps an expired authorization around, so a device
+	// still polling is told expired_token rather than invalid_grant.
+	deviceCodeGrace    = 5 * time.Minute
+	devicePollInterval = 5 * time.Second
+	deviceSlowDown     = 5 * time.Second
+
+	// userCodeAlphabet has no vowels, so codes do not spell words, and no
+	// digits to confuse with letters (RFC 8628 section 6.1). Eight
+	// characters give about 34 bits.
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var ErrDeviceCodeNotFound = errors.New("device code not found or expired")
+
+// AuthorizeDevice starts a device login (RFC 8628) for a first-party device
+// client. The device shows the user code and polls DeviceToken.
+func (s *authorizationServer) AuthorizeDevice(ctx context.Context, clientID string) (*models.DeviceAuthorizationResponse, error) {
+	if !s.isDeviceClient(clientID) {
+		return nil, oauth2Error("invalid_client", "")
+	}
+
+	deviceCode, err := randomURLToken()
+	if err != nil {
+		return nil, err
+	}
+	client := clientInfoFrom(ctx)
+	auth := &models.DeviceAuthorization{
+		ClientID:  clientID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		ExpiresAt: time.Now().Add(deviceCodeTTL),
+	}
+
+	// A collision between pending user codes is unlikely, but would hand
+	// one device's approval to the other.
+	for attempt := 0; ; attempt++ {
+		auth.UserCode, err = randomUserCode()
+		if err != nil {
+			return nil, err
+		}
+		err = s.tokenRepo.StoreDeviceAuthorization(ctx, hashToken(deviceCode), auth, deviceCodeTTL+deviceCodeGrace)
+		if !errors.Is(err, repository.ErrUserCodeInUse) || attempt == 2 {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	userCode := formatUserCode(auth.UserCode)
+	verification := strings.TrimRight(s.cfg.FrontendURL, "/") + "/device"
+	return &models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verification,
+		VerificationURIComplete: verification + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int(deviceCodeTTL.Seconds()),
+		Interval:                int(devicePollInterval.Seconds()),
+	}, nil
+}
+
+func (s *authorizationServer) DevicePrompt(ctx context.Context, userCode string) (*models.DevicePrompt, error) {
+	_, auth, err := s.pendingDevice(ctx, userCode)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DevicePrompt{
+		UserCode:  formatUserCode(auth.UserCode),
+		ClientID:  auth.ClientID,
+		IP:        auth.IP,
+		UserAgent: auth.UserAgent,
+		ExpiresAt: auth.ExpiresAt,
+	}, nil
+}
+
+func (s *authorizationServer) DecideDevice(ctx context.Context, userID uuid.UUID, userCode string, approve bool) error {
+	deviceCodeHash, auth, err := s.pendingDevice(ctx, userCode)
+	if err != nil {
+		return err
+	}
+	decision := models.DeviceDenied
+	if approve {
+		decision = userID.String()
+	}
+	if err := s.tokenRepo.DecideDeviceAuthorization(ctx, deviceCodeHash, auth.UserCode, decision); err != nil {
+		if errors.Is(err, repository.ErrDeviceCodeNotFound) {
+			return ErrDeviceCodeNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *authorizationServer) pendingDevice(ctx context.Context, userCode string) (string, *models.DeviceAuthorization, error) {
+	deviceCodeHash, auth, err := s.tokenRepo.GetDeviceAuthorization(ctx, normalizeUserCode(userCode))
+	if err != nil {
+		if errors.Is(err, repository.ErrDeviceCodeNotFound) {
+			return "", nil, ErrDeviceCodeNotFound
+		}
+		return "", nil, err
+	}
+	if time.Now().After(auth.ExpiresAt) {
+		return "", nil, ErrDeviceCodeNotFound
+	}
+	return deviceCodeHash, auth, nil
+}
+
+// DeviceToken answers a device's poll. Once the user approves, the device
+// gets a first-party session, the same as a password login.
+func (s *authorizationServer) DeviceToken(ctx context.Context, clientID, deviceCode string) (*models.OAuth2TokenResponse, error) {
+	if !s.isDeviceClient(clientID) {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	if deviceCode == "" {
+		return nil, oauth2Error("invalid_request", "device_code is required")
+	}
+
+	auth, slowDown, err := s.tokenRepo.PollDeviceAuthorization(ctx, hashToken(deviceCode), devicePollInterval, deviceSlowDown)
+	if err != nil {
+		if errors.Is(err, repository.ErrDeviceCodeNotFound) {
+			return nil, oauth2Error("invalid_grant", "invalid device_code")
+		}
+		return nil, err
+	}
+	switch {
+	case auth.ClientID != clientID:
+		return nil, oauth2Error("invalid_grant", "device_code was issued to another client")
+	case auth.Denied:
+		return nil, oauth2Error("access_denied", "")
+	case auth.UserID != "":
+	case time.Now().After(auth.ExpiresAt):
+		return nil, oauth2Error("expired_token", "")
+	case slowDown:
+		return nil, oauth2Error("slow_down", "")
+	default:
+		return nil, oauth2Error("authorization_pending", "")
+	}
+
+	userID, err := uuid.Parse(auth.UserID)
+	if err != nil {
+		return nil, oauth2Error("invalid_grant", "")
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, oauth2Error("invalid_grant", "")
+		}
+		return nil, err
+	}
+
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+	// The user approved from a signed-in session, second factor included.
+	resp, err := issuer.startSession(ctx, user)
+	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			return nil, oauth2Error("access_denied", err.Error())
+		}
+		return nil, err
+	}
+	return &models.OAuth2TokenResponse{
+		AccessToken:  resp.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    resp.ExpiresIn,
+		RefreshToken: resp.RefreshToken,
+	}, nil
+}
+
+func (s *authorizationServer) isDeviceClient(clientID string) bool {
+	return clientID != "" && hasScopes(oauth.ParseScopes(s.cfg.DeviceClientIDs), []string{clientID})
+}
+
+func randomUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	code := make([]byte, userCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits the code in two halves for display, BCDF-GHJK.
+func formatUserCode(code string) string {
+	if len(code) != userCodeLength {
+		return code
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// normalizeUserCode accepts what users type: any case, with or without the
+// dash or spaces.
+func normalizeUserCode(input string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		if strings.ContainsRune(userCodeAlphabet, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
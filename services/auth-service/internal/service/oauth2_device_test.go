@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+const testDeviceClient = "flowmate-cli"
+
+// startDevice begins a device login and returns its device and user codes.
+func startDevice(t *testing.T, tt *codeExchangeTest) (string, string) {
+	t.Helper()
+	tt.server.cfg.DeviceClientIDs = testDeviceClient
+	tt.server.cfg.FrontendURL = "https://app.example"
+	resp, err := tt.server.AuthorizeDevice(context.Background(), testDeviceClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.DeviceCode, resp.UserCode
+}
+
+// rewindLastPoll pretends the device last polled ago earlier.
+func rewindLastPoll(t *testing.T, tt *codeExchangeTest, deviceCode string, ago time.Duration) {
+	t.Helper()
+	last := time.Now().Add(-ago).UnixMilli()
+	tt.redis.HSet("device_poll:"+hashToken(deviceCode), "last", strconv.FormatInt(last, 10))
+}
+
+func TestDeviceTokenPendingAndSlowDown(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	deviceCode, _ := startDevice(t, tt)
+	ctx := context.Background()
+
+	_, err := tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "authorization_pending")
+
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "slow_down")
+
+	// The interval is now 10 seconds, so polling after the original 5 is
+	// still too fast.
+	rewindLastPoll(t, tt, deviceCode, devicePollInterval+time.Second)
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "slow_down")
+
+	rewindLastPoll(t, tt, deviceCode, devicePollInterval+3*deviceSlowDown)
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "authorization_pending")
+}
+
+func TestDeviceTokenDeliveredOnce(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	deviceCode, userCode := startDevice(t, tt)
+	ctx := context.Background()
+
+	if err := tt.server.DecideDevice(ctx, tt.user.ID, userCode, true); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	if err != nil {
+		t.Fatalf("first poll: %v", err)
+	}
+	if resp.AccessToken == "" || resp.RefreshToken == "" {
+		t.Fatalf("response = %+v, want access and refresh tokens", resp)
+	}
+	claims, err := tt.auth.ValidateToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != tt.user.ID.String() || claims.ClientID != "" {
+		t.Errorf("claims = %+v, want a first-party token for %s", claims, tt.user.ID)
+	}
+
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "invalid_grant")
+	if err := tt.server.DecideDevice(ctx, tt.user.ID, userCode, true); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Errorf("deciding again: err = %v, want %v", err, ErrDeviceCodeNotFound)
+	}
+}
+
+func TestDeviceTokenDenied(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	deviceCode, userCode := startDevice(t, tt)
+	ctx := context.Background()
+
+	if err := tt.server.DecideDevice(ctx, tt.user.ID, userCode, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "access_denied")
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "invalid_grant")
+}
+
+func TestDeviceTokenExpired(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	tt.server.cfg.DeviceClientIDs = testDeviceClient
+	ctx := context.Background()
+	deviceCode := "expired-device-code"
+	auth := &models.DeviceAuthorization{
+		ClientID:  testDeviceClient,
+		UserCode:  "BCDFGHJK",
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := tt.tokens.StoreDeviceAuthorization(ctx, hashToken(deviceCode), auth, deviceCodeGrace-time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	// Within the grace window the device learns why it should stop.
+	_, err := tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "expired_token")
+	if _, err := tt.server.DevicePrompt(ctx, auth.UserCode); !errors.Is(err, ErrDeviceCodeNotFound) {
+		t.Errorf("prompt for an expired code: err = %v, want %v", err, ErrDeviceCodeNotFound)
+	}
+
+	tt.redis.FastForward(deviceCodeGrace)
+	_, err = tt.server.DeviceToken(ctx, testDeviceClient, deviceCode)
+	assertOAuth2Error(t, err, "invalid_grant")
+}
+
+func TestDeviceTokenClientMismatch(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	deviceCode, _ := startDevice(t, tt)
+	ctx := context.Background()
+
+	_, err := tt.server.DeviceToken(ctx, "flowmate-desktop", deviceCode)
+	assertOAuth2Error(t, err, "invalid_client")
+
+	tt.server.cfg.DeviceClientIDs = testDeviceClient + " flowmate-desktop"
+	_, err = tt.server.DeviceToken(ctx, "flowmate-desktop", deviceCode)
+	assertOAuth2Error(t, err, "invalid_grant")
+}
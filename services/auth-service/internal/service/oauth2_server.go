@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const (
+	// authRequestTTL bounds how long the user has to sign in to the
+	// frontend and answer the consent screen.
+	authRequestTTL = 10 * time.Minute
+	authCodeTTL    = time.Minute
+)
+
+var (
+	// ErrUnknownClient and ErrInvalidRedirectURI are reported to the user,
+	// never redirected: the redirect URI cannot be trusted until both pass.
+	ErrUnknownClient       = errors.New("unknown client_id")
+	ErrInvalidRedirectURI  = errors.New("redirect_uri is not registered for this client")
+	ErrAuthRequestNotFound = errors.New("authorization request not found or expired")
+)
+
+// OAuth2Error is reported to OAuth clients as an RFC 6749 error response or
+// error redirect.
+type OAuth2Error struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuth2Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func oauth2Error(code, description string) error {
+	return &OAuth2Error{Code: code, Description: description}
+}
+
+// AuthorizationServer lets third-party applications sign users in with
+// FlowMate and act on their behalf: authorization code with PKCE, consent,
+// ID tokens and userinfo. Tokens come from the same issuer as first-party
+// ones and carry the client_id and granted scopes.
+type AuthorizationServer interface {
+	// Authorize validates an /oauth2/authorize request and parks it until the
+	// user consents in the frontend. Errors other than ErrUnknownClient and
+	// ErrInvalidRedirectURI are *OAuth2Error and go back to the client.
+	Authorize(ctx context.Context, params *models.AuthorizeParams) (string, error)
+	ConsentPrompt(ctx context.Context, userID uuid.UUID, requestID string) (*models.ConsentPrompt, error)
+	// DecideConsent completes the request and returns the URL to send the
+	// browser to: the client's redirect URI with a code or an error.
+	DecideConsent(ctx context.Context, userID uuid.UUID, requestID string, approve bool) (string, error)
+
+	AuthenticateClient(ctx context.Context, auth *models.ClientAuthentication) (*models.OAuthClient, error)
+	ExchangeCode(ctx context.Context, client *models.OAuthClient, code, redirectURI, codeVerifier string) (*models.OAuth2TokenResponse, error)
+	RefreshToken(ctx context.Context, client *models.OAuthClient, refreshToken, scope string) (*models.OAuth2TokenResponse, error)
+	// ClientCredentials issues a service client a token for its own use;
+	// audience is a space separated subset of its registered audiences.
+	ClientCredentials(ctx context.Context, client *models.OAuthClient, scope, audience string) (*models.OAuth2TokenResponse, error)
+	UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error)
+	Discovery() (*models.OpenIDConfiguration, error)
+
+	// AuthorizeDevice, DevicePrompt, DecideDevice and DeviceToken implement
+	// the device authorization grant for first-party devices such as the
+	// CLI, which end up with an ordinary first-party session.
+	AuthorizeDevice(ctx context.Context, clientID string) (*models.DeviceAuthorizationResponse, error)
+	DevicePrompt(ctx context.Context, userCode string) (*models.DevicePrompt, error)
+	DecideDevice(ctx context.Context, userID uuid.UUID, userCode string, approve bool) error
+	DeviceToken(ctx context.Context, clientID, deviceCode string) (*models.OAuth2TokenResponse, error)
+
+	RegisterClient(ctx context.Context, ownerID uuid.UUID, req *models.OAuthClientRequest) (*models.OAuthClientResponse, error)
+	ListClients(ctx context.Context, ownerID uuid.UUID) ([]*models.OAuthClientResponse, error)
+	DeleteClient(ctx context.Context, ownerID uuid.UUID, clientID string) error
+	ListAuthorizedApps(ctx context.Context, userID uuid.UUID) ([]*models.AuthorizedAppResponse, error)
+	// RevokeAuthorizedApp withdraws consent and ends every session the
+	// client holds for the user.
+	RevokeAuthorizedApp(ctx context.Context, userID uuid.UUID, clientID string) error
+}
+
+type authorizationServer struct {
+	clients   repository.OAuthClientRepository
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
+	authSvc   AuthService
+	cfg       *config.Config
+}
+
+func NewAuthorizationServer(clients repository.OAuthClientRepository, userRepo repository.UserRepository, tokenRepo repository.TokenRepository, authSvc AuthService, cfg *config.Config) AuthorizationServer {
+	return &authorizationServer{
+		clients:   clients,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		authSvc:   authSvc,
+		cfg:       cfg,
+	}
+}
+
+func (s *authorizationServer) Authorize(ctx context.Context, params *models.AuthorizeParams) (string, error) {
+	client, err := s.clients.GetByClientID(ctx, params.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return "", ErrUnknownClient
+		}
+		return "", err
+	}
+	if params.RedirectURI == "" || !client.AllowsRedirect(params.RedirectURI) {
+		return "", ErrInvalidRedirectURI
+	}
+
+	if params.ResponseType != "code" {
+		return "", oauth2Error("unsupported_response_type", "only response_type=code is supported")
+	}
+	// PKCE is required of every client, confidential ones included.
+	if params.CodeChallenge == "" || params.CodeChallengeMethod != "S256" {
+		return "", oauth2Error("invalid_request", "code_challenge with code_challenge_method=S256 is required")
+	}
+	scopes := oauth.ParseScopes(params.Scope)
+	if len(scopes) == 0 {
+		return "", oauth2Error("invalid_scope", "scope is required")
+	}
+	if !hasScopes(strings.Fields(client.Scopes), scopes) {
+		return "", oauth2Error("invalid_scope", "the client is not allowed to request these scopes")
+	}
+	if params.Prompt == "none" {
+		// Consent happens in the frontend, so it cannot be skipped here.
+		return "", oauth2Error("interaction_required", "prompt=none is not supported")
+	}
+
+	requestID, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	req := &models.AuthorizationRequest{
+		ClientID:      client.ClientID,
+		RedirectURI:   params.RedirectURI,
+		Scopes:        scopes,
+		State:         params.State,
+		CodeChallenge: params.CodeChallenge,
+		Nonce:         params.Nonce,
+		ForceConsent:  params.Prompt == "consent",
+	}
+	if err := s.tokenRepo.StoreAuthorizationRequest(ctx, hashToken(requestID), req, authRequestTTL); err != nil {
+		return "", err
+	}
+	return requestID, nil
+}
+
+func (s *authorizationServer) ConsentPrompt(ctx context.Context, userID uuid.UUID, requestID string) (*models.ConsentPrompt, error) {
+	req, err := s.tokenRepo.GetAuthorizationRequest(ctx, hashToken(requestID))
+	if err != nil {
+		if errors.Is(err, repository.ErrAuthRequestNotFound) {
+			return nil, ErrAuthRequestNotFound
+		}
+		return nil, err
+	}
+	client, err := s.clients.GetByClientID(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, ErrAuthRequestNotFound
+		}
+		return nil, err
+	}
+
+	granted, err := s.grantedScopes(ctx, userID, client.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ConsentPrompt{
+		RequestID:       requestID,
+		ClientID:        client.ClientID,
+		ClientName:      client.Name,
+		Scopes:          req.Scopes,
+		ConsentRequired: req.ForceConsent || !hasScopes(granted, req.Scopes),
+	}, nil
+}
+
+func (s *authorizationServer) DecideConsent(ctx context.Context, userID uuid.UUID, requestID string, approve bool) (string, error) {
+	req, err := s.tokenRepo.ConsumeAuthorizationRequest(ctx, hashToken(requestID))
+	if err != nil {
+		if errors.Is(err, repository.ErrAuthRequestNotFound) {
+			return "", ErrAuthRequestNotFound
+		}
+		return "", err
+	}
+	if !approve {
+		return s.redirectURL(req, url.Values{"error": {"access_denied"}}), nil
+	}
+
+	granted, err := s.grantedScopes(ctx, userID, req.ClientID)
+	if err != nil {
+		return "", err
+	}
+	if err := s.clients.SaveConsent(ctx, userID, req.ClientID, strings.Join(unionScopes(granted, req.Scopes), " ")); err != nil {
+		return "", err
+	}
+
+	code, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	record := &models.AuthorizationCode{
+		ClientID:      req.ClientID,
+		UserID:        userID.String(),
+		RedirectURI:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+	}
+	if err := s.tokenRepo.StoreAuthorizationCode(ctx, hashToken(code), record, authCodeTTL); err != nil {
+		return "", err
+	}
+	return s.redirectURL(req, url.Values{"code": {code}}), nil
+}
+
+// redirectURL adds the response parameters, the request's state and the
+// issuer (RFC 9207) to the client's redirect URI.
+func (s *authorizationServer) redirectURL(req *models.AuthorizationRequest, params url.Values) string {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	query.Set("iss", s.cfg.IssuerURL)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (s *authorizationServer) grantedScopes(ctx context.Context, userID uuid.UUID, clientID string) ([]string, error) {
+	consent, err := s.clients.GetConsent(ctx, userID, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrConsentNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return strings.Fields(consent.Scopes), nil
+}
+
+// AuthenticateClient checks the credentials presented at the token
+// endpoint. Public clients identify themselves with client_id alone.
+func (s *authorizationServer) AuthenticateClient(ctx context.Context, auth *models.ClientAuthentication) (*models.OAuthClient, error) {
+	if auth.Assertion != "" || auth.AssertionType != "" {
+		return s.authenticateAssertion(ctx, auth)
+	}
+	if auth.ClientID == "" {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	client, err := s.clients.GetByClientID(ctx, auth.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, oauth2Error("invalid_client", "")
+		}
+		return nil, err
+	}
+
+	if client.Public {
+		if auth.ClientSecret != "" {
+			return nil, oauth2Error("invalid_client", "public clients have no secret")
+		}
+		return client, nil
+	}
+	if auth.ClientSecret == "" || client.ClientSecretHash == nil ||
+		subtle.ConstantTimeCompare([]byte(hashToken(auth.ClientSecret)), []byte(*client.ClientSecretHash)) != 1 {
+		return nil, oauth2Error("invalid_client", "")
+	}
+	return client, nil
+}
+
+func (s *authorizationServer) ExchangeCode(ctx context.Context, client *models.OAuthClient, code, redirectURI, codeVerifier string) (*models.OAuth2TokenResponse, error) {
+	if code == "" || codeVerifier == "" {
+		return nil, oauth2Error("invalid_request", "code and code_verifier are required")
+	}
+	record, err := s.tokenRepo.ConsumeAuthorizationCode(ctx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrAuthCodeNotFound) {
+			return nil, oauth2Error("invalid_grant", "invalid or expired code")
+		}
+		return nil, err
+	}
+	if record.ClientID != client.ClientID || record.RedirectURI != redirectURI {
+		return nil, oauth2Error("invalid_grant", "code was issued to another client or redirect_uri")
+	}
+	if subtle.ConstantTimeCompare([]byte(oauth.CodeChallenge(codeVerifier)), []byte(record.CodeChallenge)) != 1 {
+		return nil, oauth2Error("invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	userID, err := uuid.Parse(record.UserID)
+	if err != nil {
+		return nil, oauth2Error("invalid_grant", "")
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, oauth2Error("invalid_grant", "")
+		}
+		return nil, err
+	}
+
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+	return issuer.issueClientTokens(ctx, &clientGrant{
+		clientID: client.ClientID,
+		user:     user,
+		scopes:   record.Scopes,
+		nonce:    record.Nonce,
+	})
+}
+
+func (s *authorizationServer) RefreshToken(ctx context.Context, client *models.OAuthClient, refreshToken, scope string) (*models.OAuth2TokenResponse, error) {
+	if refreshToken == "" {
+		return nil, oauth2Error("invalid_request", "refresh_token is required")
+	}
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+	return issuer.refreshClientTokens(ctx, client.ClientID, refreshToken, oauth.ParseScopes(scope))
+}
+
+func (s *authorizationServer) UserInfo(ctx context.Context, accessToken string) (map[string]interface{}, error) {
+	claims, err := s.authSvc.ValidateToken(ctx, accessToken)
+	if err != nil || claims.IsService() {
+		return nil, oauth2Error("invalid_token", "")
+	}
+	// First-party tokens may read the whole profile; client tokens get
+	// what their scopes cover, and need openid to call this at all.
+	scopes := []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail}
+	if claims.ClientID != "" {
+		scopes = claims.Scopes
+	}
+	if !hasScopes(scopes, []string{models.ScopeOpenID}) {
+		return nil, oauth2Error("insufficient_scope", "")
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, oauth2Error("invalid_token", "")
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, oauth2Error("invalid_token", "")
+		}
+		return nil, err
+	}
+	return userClaims(user, scopes), nil
+}
+
+func (s *authorizationServer) Discovery() (*models.OpenIDConfiguration, error) {
+	issuer, err := s.issuer()
+	if err != nil {
+		return nil, err
+	}
+	key, err := issuer.keys.SigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	// The revocation and introspection endpoints authenticate clients the
+	// same way as the token endpoint.
+	authMethods := []string{"client_secret_basic", "client_secret_post", "private_key_jwt", "none"}
+	base := s.cfg.IssuerURL
+	return &models.OpenIDConfiguration{
+		Issuer:                            base,
+		AuthorizationEndpoint:             base + "/oauth2/authorize",
+		TokenEndpoint:                     base + "/oauth2/token",
+		UserInfoEndpoint:                  base + "/oauth2/userinfo",
+		DeviceAuthorizationEndpoint:       base + "/oauth2/device_authorization",
+		RevocationEndpoint:                base + "/oauth2/revoke",
+		IntrospectionEndpoint:             base + "/oauth2/introspect",
+		JWKSURI:                           base + "/.well-known/jwks.json",
+		ScopesSupported:                   s.supportedScopes(),
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", models.GrantTypeDeviceCode},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{key.Algorithm},
+		TokenEndpointAuthMethodsSupported: authMethods,
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce",
+			"email", "email_verified", "name", "preferred_username", "picture", "updated_at",
+		},
+		TokenEndpointAuthSigningAlgValuesSupported: assertionAlgs,
+		RevocationEndpointAuthMethodsSupported:     authMethods,
+		IntrospectionEndpointAuthMethodsSupported:  authMethods,
+	}, nil
+}
+
+func (s *authorizationServer) supportedScopes() []string {
+	scopes := []string{models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail, models.ScopeOfflineAccess}
+	return unionScopes(scopes, apiScopes(s.cfg))
+}
+
+func (s *authorizationServer) issuer() (*authService, error) {
+	issuer, ok := s.authSvc.(*authService)
+	if !ok {
+		return nil, errors.New("auth service unavailable")
+	}
+	return issuer, nil
+}
+
+// unionScopes returns a followed by the scopes of b it does not contain.
+func unionScopes(a, b []string) []string {
+	out := append([]string{}, a...)
+	for _, scope := range b {
+		if !hasScopes(out, []string{scope}) {
+			out = append(out, scope)
+		}
+	}
+	return out
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/keys"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const (
+	testRedirectURI  = "https://app.example/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// staticKeys signs with a single key.
+type staticKeys struct {
+	key *keys.Key
+}
+
+func (k staticKeys) SigningKey() (*keys.Key, error) {
+	return k.key, nil
+}
+
+func (k staticKeys) VerificationKey(kid string) (*keys.Key, error) {
+	if kid != k.key.ID {
+		return nil, keys.ErrKeyNotFound
+	}
+	return k.key, nil
+}
+
+func (k staticKeys) JWKS() *keys.JWKS {
+	return &keys.JWKS{Keys: []keys.JWK{*keys.NewJWK(k.key)}}
+}
+
+// fakeUsers holds users in memory. Methods the tests do not use panic.
+type fakeUsers struct {
+	repository.UserRepository
+	users map[uuid.UUID]*models.User
+}
+
+func (r *fakeUsers) GetByID(_ context.Context, id uuid.UUID) (*models.User, error) {
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrUserNotFound
+	}
+	return user, nil
+}
+
+func (r *fakeUsers) GetByEmail(_ context.Context, email string) (*models.User, error) {
+	for _, user := range r.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (r *fakeUsers) Update(_ context.Context, user *models.User) error {
+	r.users[user.ID] = user
+	return nil
+}
+
+// fakeClients holds registered clients in memory and keeps no consents.
+// Methods the tests do not use panic.
+type fakeClients struct {
+	repository.OAuthClientRepository
+	clients map[string]*models.OAuthClient
+}
+
+func (r fakeClients) GetByClientID(_ context.Context, clientID string) (*models.OAuthClient, error) {
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, repository.ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+func (fakeClients) DeleteConsent(context.Context, uuid.UUID, string) error {
+	return nil
+}
+
+type codeExchangeTest struct {
+	server *authorizationServer
+	auth   *authService
+	tokens repository.TokenRepository
+	redis  *miniredis.Miniredis
+	user   *models.User
+	client *models.OAuthClient
+}
+
+func newCodeExchangeTest(t *testing.T) *codeExchangeTest {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { rdb.Close() })
+
+	key, err := keys.Generate(keys.AlgEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", Username: "user", EmailVerifiedAt: &now}
+	users := &fakeUsers{users: map[uuid.UUID]*models.User{user.ID: user}}
+	tokens := repository.NewTokenRepository(rdb)
+	cfg := &config.Config{
+		JWTExpiryMinutes:     15,
+		RefreshExpiryDays:    30,
+		IssuerURL:            "https://auth.example",
+		UnverifiedUserPolicy: "restrict",
+		DenylistTimeoutMS:    100,
+	}
+	auth := &authService{userRepo: users, tokenRepo: tokens, keys: staticKeys{key: key}, cfg: cfg}
+	return &codeExchangeTest{
+		server: &authorizationServer{clients: fakeClients{}, userRepo: users, tokenRepo: tokens, authSvc: auth, cfg: cfg},
+		auth:   auth,
+		tokens: tokens,
+		redis:  mr,
+		user:   user,
+		client: &models.OAuthClient{ClientID: "client-1", Public: true},
+	}
+}
+
+// issueCode stores an authorization code as the consent step would.
+func (tt *codeExchangeTest) issueCode(t *testing.T, scopes ...string) string {
+	t.Helper()
+	code, err := randomURLToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := &models.AuthorizationCode{
+		ClientID:      tt.client.ClientID,
+		UserID:        tt.user.ID.String(),
+		RedirectURI:   testRedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: oauth.CodeChallenge(testCodeVerifier),
+		Nonce:         "nonce-1",
+	}
+	if err := tt.tokens.StoreAuthorizationCode(context.Background(), hashToken(code), record, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func assertOAuth2Error(t *testing.T, err error, code string) {
+	t.Helper()
+	var oauthErr *OAuth2Error
+	if !errors.As(err, &oauthErr) || oauthErr.Code != code {
+		t.Fatalf("err = %v, want %s", err, code)
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	ctx := context.Background()
+	code := tt.issueCode(t, models.ScopeOpenID, models.ScopeOfflineAccess)
+
+	resp, err := tt.server.ExchangeCode(ctx, tt.client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if resp.AccessToken == "" || resp.IDToken == "" || resp.RefreshToken == "" {
+		t.Fatalf("response = %+v, want access, ID and refresh tokens", resp)
+	}
+	claims, err := tt.auth.ValidateToken(ctx, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("issued access token rejected: %v", err)
+	}
+	if claims.ClientID != tt.client.ClientID || claims.UserID != tt.user.ID.String() {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Codes are single use.
+	_, err = tt.server.ExchangeCode(ctx, tt.client, code, testRedirectURI, testCodeVerifier)
+	assertOAuth2Error(t, err, "invalid_grant")
+}
+
+func TestExchangeCodeRejects(t *testing.T) {
+	tests := []struct {
+		name         string
+		clientID     string
+		redirectURI  string
+		codeVerifier string
+		want         string
+	}{
+		{"wrong code_verifier", "client-1", testRedirectURI, "wrong-verifier-wrong-verifier-wrong-verifier", "invalid_grant"},
+		{"code_challenge as code_verifier", "client-1", testRedirectURI, oauth.CodeChallenge(testCodeVerifier), "invalid_grant"},
+		{"missing code_verifier", "client-1", testRedirectURI, "", "invalid_request"},
+		{"other client", "client-2", testRedirectURI, testCodeVerifier, "invalid_grant"},
+		{"missing redirect_uri", "client-1", "", testCodeVerifier, "invalid_grant"},
+		{"redirect_uri with a trailing slash", "client-1", testRedirectURI + "/", testCodeVerifier, "invalid_grant"},
+		{"redirect_uri with a query", "client-1", testRedirectURI + "?next=/", testCodeVerifier, "invalid_grant"},
+		{"redirect_uri with another host", "client-1", "https://evil.example/callback", testCodeVerifier, "invalid_grant"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tt := newCodeExchangeTest(t)
+			ctx := context.Background()
+			code := tt.issueCode(t, models.ScopeOpenID)
+
+			client := &models.OAuthClient{ClientID: tc.clientID, Public: true}
+			_, err := tt.server.ExchangeCode(ctx, client, code, tc.redirectURI, tc.codeVerifier)
+			assertOAuth2Error(t, err, tc.want)
+
+			if tc.want == "invalid_grant" {
+				// A failed attempt burns the code, so the right verifier
+				// cannot be guessed afterwards.
+				_, err = tt.server.ExchangeCode(ctx, tt.client, code, testRedirectURI, testCodeVerifier)
+				assertOAuth2Error(t, err, "invalid_grant")
+			}
+		})
+	}
+}
+
+func TestRevokeAuthorizedAppEndsSessionsWithoutRefreshToken(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	ctx := context.Background()
+	code := tt.issueCode(t, models.ScopeOpenID)
+
+	resp, err := tt.server.ExchangeCode(ctx, tt.client, code, testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatalf("exchange: %v", err)
+	}
+	if resp.RefreshToken != "" {
+		t.Fatal("refresh token issued without offline_access")
+	}
+
+	if err := tt.server.RevokeAuthorizedApp(ctx, tt.user.ID, tt.client.ClientID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tt.auth.ValidateToken(ctx, resp.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("access token after revoking the app: err = %v, want %v", err, ErrTokenRevoked)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// clientGrant is what a user authorized an OAuth client to do.
+type clientGrant struct {
+	clientID string
+	user     *models.User
+	scopes   []string
+	nonce    string
+}
+
+// issueClientTokens issues the tokens for a client grant. Each grant is a
+// session of its own, so the user can end it like any other; only grants
+// with offline_access get a refresh token to keep it alive.
+func (s *authService) issueClientTokens(ctx context.Context, grant *clientGrant) (*models.OAuth2TokenResponse, error) {
+	if err := s.checkEmailPolicy(grant.user); err != nil {
+		return nil, oauth2Error("invalid_grant", err.Error())
+	}
+
+	sessionID := uuid.New().String()
+	offline := hasScopes(grant.scopes, []string{models.ScopeOfflineAccess})
+	if !offline {
+		// Without a refresh token there is no family to revoke the session
+		// through, so it is tracked on its own until the token expires.
+		expiresAt := time.Now().Add(time.Duration(s.cfg.JWTExpiryMinutes) * time.Minute)
+		if err := s.tokenRepo.TrackClientSession(ctx, grant.user.ID.String(), grant.clientID, sessionID, expiresAt); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := s.clientAccessToken(ctx, grant, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if offline {
+		refreshToken, err := s.generateRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		data := s.clientRefreshTokenData(ctx, grant, sessionID)
+		if err := s.tokenRepo.StoreRefreshToken(ctx, refreshToken, data, s.refreshExpiry()); err != nil {
+			return nil, err
+		}
+		resp.RefreshToken = refreshToken
+	}
+	return resp, nil
+}
+
+// refreshClientTokens rotates a client's refresh token. The client may ask
+// for fewer scopes than were granted, but never more.
+func (s *authService) refreshClientTokens(ctx context.Context, clientID, refreshToken string, scopes []string) (*models.OAuth2TokenResponse, error) {
+	tokenData, err := s.tokenRepo.GetRefreshToken(ctx, refreshToken)
+	if err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			// A replayed token revokes its family, as for first-party
+			// sessions.
+			reuseErr := s.detectReuse(ctx, refreshToken)
+			if errors.Is(reuseErr, ErrInvalidToken) || errors.Is(reuseErr, ErrTokenReused) {
+				return nil, oauth2Error("invalid_grant", "invalid refresh token")
+			}
+			return nil, reuseErr
+		}
+		return nil, err
+	}
+	if tokenData.ClientID == "" || tokenData.ClientID != clientID {
+		return nil, oauth2Error("invalid_grant", "invalid refresh token")
+	}
+	if time.Now().After(tokenData.ExpiresAt) {
+		_ = s.tokenRepo.DeleteRefreshToken(ctx, refreshToken)
+		return nil, oauth2Error("invalid_grant", "refresh token expired")
+	}
+	if len(scopes) == 0 {
+		scopes = tokenData.Scopes
+	} else if !hasScopes(tokenData.Scopes, scopes) {
+		return nil, oauth2Error("invalid_scope", "scope exceeds the original grant")
+	}
+
+	userID, err := uuid.Parse(tokenData.UserID)
+	if err != nil {
+		return nil, oauth2Error("invalid_grant", "invalid refresh token")
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, oauth2Error("invalid_grant", "invalid refresh token")
+		}
+		return nil, err
+	}
+	if err := s.checkEmailPolicy(user); err != nil {
+		return nil, oauth2Error("invalid_grant", err.Error())
+	}
+
+	grant := &clientGrant{clientID: clientID, user: user, scopes: tokenData.Scopes}
+	resp, err := s.clientAccessToken(ctx, &clientGrant{clientID: clientID, user: user, scopes: scopes}, tokenData.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	newToken, err := s.generateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	data := s.clientRefreshTokenData(ctx, grant, tokenData.FamilyID)
+	if err := s.tokenRepo.RotateRefreshToken(ctx, refreshToken, newToken, data, s.refreshExpiry()); err != nil {
+		if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			return nil, oauth2Error("invalid_grant", "invalid refresh token")
+		}
+		return nil, err
+	}
+	resp.RefreshToken = newToken
+	return resp, nil
+}
+
+// clientAccessToken issues the access token, and an ID token when openid was
+// granted.
+func (s *authService) clientAccessToken(ctx context.Context, grant *clientGrant, sessionID string) (*models.OAuth2TokenResponse, error) {
+	// API scopes the user has since lost are left out, and come back on
+	// refresh if the user is granted them again.
+	scopes := withinUserScopes(s.cfg, grant.user, grant.scopes)
+	scope := strings.Join(scopes, " ")
+	claims := jwt.MapClaims{
+		"client_id": grant.clientID,
+		"scope":     scope,
+		"roles":     nil,
+	}
+	// The client can read its access token, so the profile claims follow
+	// the same scopes as the ID token.
+	if !hasScopes(scopes, []string{models.ScopeEmail}) {
+		claims["email"] = nil
+	}
+	if !hasScopes(scopes, []string{models.ScopeProfile}) {
+		claims["username"] = nil
+	}
+	accessToken, err := s.signAccessToken(ctx, grant.user, sessionID, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &models.OAuth2TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   s.cfg.JWTExpiryMinutes * 60,
+		Scope:       scope,
+	}
+	if hasScopes(grant.scopes, []string{models.ScopeOpenID}) {
+		resp.IDToken, err = s.generateIDToken(grant)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+func (s *authService) clientRefreshTokenData(ctx context.Context, grant *clientGrant, familyID string) *models.RefreshTokenData {
+	data := s.refreshTokenData(ctx, grant.user, familyID)
+	data.ClientID = grant.clientID
+	data.Scopes = grant.scopes
+	return data
+}
+
+func (s *authService) generateIDToken(grant *clientGrant) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for name, value := range userClaims(grant.user, grant.scopes) {
+		claims[name] = value
+	}
+	claims["iss"] = s.cfg.IssuerURL
+	claims["aud"] = grant.clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Minute * time.Duration(s.cfg.JWTExpiryMinutes)).Unix()
+	if grant.nonce != "" {
+		claims["nonce"] = grant.nonce
+	}
+
+	key, err := s.keys.SigningKey()
+	if err != nil {
+		return "", err
+	}
+	return key.Sign(claims)
+}
+
+// userClaims are the OpenID Connect standard claims the scopes allow.
+func userClaims(user *models.User, scopes []string) map[string]interface{} {
+	claims := map[string]interface{}{"sub": user.ID.String()}
+	if hasScopes(scopes, []string{models.ScopeEmail}) {
+		claims["email"] = user.Email
+		claims["email_verified"] = user.IsEmailVerified()
+	}
+	if hasScopes(scopes, []string{models.ScopeProfile}) {
+		claims["name"] = user.Username
+		claims["preferred_username"] = user.Username
+		claims["updated_at"] = user.UpdatedAt.Unix()
+		if user.AvatarURL != nil {
+			claims["picture"] = *user.AvatarURL
+		}
+	}
+	return claims
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// loginCodeTTL only needs to cover the frontend loading its callback page.
+const loginCodeTTL = time.Minute
+
+var ErrInvalidLoginCode = errors.New("invalid or expired login code")
+
+// IssueLoginCode parks a finished OAuth login in Redis behind a single-use
+// code, so the browser redirect never carries tokens.
+func (s *oauthService) IssueLoginCode(ctx context.Context, resp *models.AuthResponse) (string, error) {
+	code, err := randomURLToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.tokenRepo.StoreLoginCode(ctx, hashToken(code), resp, loginCodeTTL); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+func (s *oauthService) ExchangeLoginCode(ctx context.Context, code string) (*models.AuthResponse, error) {
+	resp, err := s.tokenRepo.ConsumeLoginCode(ctx, hashToken(code))
+	if err != nil {
+		if errors.Is(err, repository.ErrLoginCodeNotFound) {
+			return nil, ErrInvalidLoginCode
+		}
+		return nil, err
+	}
+	return resp, nil
+}
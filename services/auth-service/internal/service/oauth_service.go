@@ -1,252 +1,172 @@
 package service
 
 import (
-    "context"
-    "encoding/json"
-    "errors"
-    "fmt"
-    "io"
-    "net/http"
-    "net/url"
-    "strings"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
 
-	"github.com/flowmate/auth-service/internal/config"
 	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
 	"github.com/flowmate/auth-service/internal/repository"
 )
 
+var (
+	ErrOAuthEmailMissing   = errors.New("provider did not return an email address")
+	ErrAccountLinkRequired = errors.New("an account with this email already exists; sign in and link this provider from your account settings")
+)
+
 type OAuthService interface {
-	GetGitHubAuthURL(state string) string
-	GetGoogleAuthURL(state string) string
-	HandleGitHubCallback(ctx context.Context, code string) (*models.AuthResponse, error)
-	HandleGoogleCallback(ctx context.Context, code string) (*models.AuthResponse, error)
+	// StartAuth prepares a provider login: it stores a fresh state, PKCE
+	// verifier and nonce and returns the authorization URL.
+	StartAuth(ctx context.Context, provider string) (*models.OAuthStart, error)
+	// VerifyState consumes the state returned to the callback and checks it
+	// was issued to this browser for this provider. The stored state carries
+	// the PKCE verifier (and OIDC nonce) to redeem the code with.
+	VerifyState(ctx context.Context, provider, state, binding string) (*models.OAuthState, error)
+	HandleCallback(ctx context.Context, provider, code string, state *models.OAuthState) (*models.AuthResponse, error)
+	// IssueLoginCode and ExchangeLoginCode hand the login result to the
+	// frontend through a single-use code instead of the redirect URL.
+	IssueLoginCode(ctx context.Context, resp *models.AuthResponse) (string, error)
+	ExchangeLoginCode(ctx context.Context, code string) (*models.AuthResponse, error)
+
+	ListSignInMethods(ctx context.Context, userID uuid.UUID) (*models.SignInMethods, error)
+	// StartLink is StartAuth for a signed-in user adding a provider; the
+	// callback must then go to CompleteLink.
+	// Extra scopes are requested on top of the sign-in scopes.
+	StartLink(ctx context.Context, userID uuid.UUID, provider string, scopes []string) (*models.OAuthStart, error)
+	CompleteLink(ctx context.Context, provider, code string, state *models.OAuthState) error
+	// Unlink removes a provider unless it is the user's last way to sign in.
+	Unlink(ctx context.Context, userID uuid.UUID, provider string) error
 }
 
 type oauthService struct {
 	userRepo  repository.UserRepository
 	tokenRepo repository.TokenRepository
-	cfg       *config.Config
+	credRepo  repository.WebAuthnRepository
+	providers *oauth.Registry
+	tokens    ProviderTokenService
 	authSvc   AuthService
 }
 
-func NewOAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, cfg *config.Config, authSvc AuthService) OAuthService {
+func NewOAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, credRepo repository.WebAuthnRepository, providers *oauth.Registry, tokens ProviderTokenService, authSvc AuthService) OAuthService {
 	return &oauthService{
 		userRepo:  userRepo,
 		tokenRepo: tokenRepo,
-		cfg:       cfg,
+		credRepo:  credRepo,
+		providers: providers,
+		tokens:    tokens,
 		authSvc:   authSvc,
 	}
 }
 
-func (s *oauthService) GetGitHubAuthURL(state string) string {
-	baseURL := "https://github.com/login/oauth/authorize"
-	params := url.Values{
-		"client_id":    {s.cfg.GitHubClientID},
-		"redirect_uri": {fmt.Sprintf("%s/github/callback", strings.TrimRight(s.cfg.OAuthCallbackURL, "/"))},
-		"scope":        {"user:email"},
-		"state":        {state},
+func (s *oauthService) HandleCallback(ctx context.Context, provider, code string, state *models.OAuthState) (*models.AuthResponse, error) {
+	if state.LinkUserID != "" {
+		return nil, ErrInvalidOAuthState
 	}
-	return fmt.Sprintf("%s?%s", baseURL, params.Encode())
-}
-
-func (s *oauthService) HandleGitHubCallback(ctx context.Context, code string) (*models.AuthResponse, error) {
-	tokenResp, err := s.exchangeGitHubCode(code)
+	identity, err := s.exchange(ctx, provider, code, state)
 	if err != nil {
 		return nil, err
 	}
 
-	userInfo, err := s.getGitHubUserInfo(tokenResp.AccessToken)
+	user, err := s.findOrCreateUser(ctx, identity)
 	if err != nil {
 		return nil, err
 	}
-
-	user, err := s.userRepo.GetByGitHubID(ctx, fmt.Sprintf("%d", userInfo.ID))
-	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			user = &models.User{
-				Email:     userInfo.Email,
-				Username:  userInfo.Login,
-				AvatarURL: stringPtr(userInfo.AvatarURL),
-				GitHubID:  stringPtr(fmt.Sprintf("%d", userInfo.ID)),
-			}
-			if err := s.userRepo.Create(ctx, user); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
-		}
+	if err := s.tokens.Save(ctx, identity); err != nil {
+		log.Printf("failed to store %s token for user %s: %v", provider, user.ID, err)
 	}
-
 	return s.issueTokens(ctx, user)
 }
 
-func (s *oauthService) exchangeGitHubCode(code string) (*struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	Scope       string `json:"scope"`
-}, error) {
-	tokenURL := "https://github.com/login/oauth/access_token"
-	data := url.Values{
-		"client_id":     {s.cfg.GitHubClientID},
-		"client_secret": {s.cfg.GitHubClientSecret},
-		"code":          {code},
-	}
-
-	req, err := http.NewRequest("POST", tokenURL, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.URL.RawQuery = data.Encode()
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-		TokenType   string `json:"token_type"`
-		Scope       string `json:"scope"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, err
+func (s *oauthService) exchange(ctx context.Context, provider, code string, state *models.OAuthState) (*oauth.Identity, error) {
+	p, ok := s.providers.Get(provider)
+	if !ok {
+		return nil, ErrUnsupportedProvider
 	}
-	return &tokenResp, nil
+	return p.Exchange(ctx, code, oauth.AuthParams{
+		CodeVerifier: state.CodeVerifier,
+		Nonce:        state.Nonce,
+		Scopes:       state.Scopes,
+	})
 }
 
-func (s *oauthService) getGitHubUserInfo(accessToken string) (*GitHubUser, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user", nil)
-	if err != nil {
-		return nil, err
+// findOrCreateUser resolves the identity to a user. An unknown identity whose
+// email matches an existing account is linked to it only when both the
+// provider and FlowMate have verified that address; otherwise an attacker
+// could pre-register a victim's email, or assert one they do not own, and
+// share the account. In every other case the user must sign in and link
+// explicitly.
+func (s *oauthService) findOrCreateUser(ctx context.Context, identity *oauth.Identity) (*models.User, error) {
+	user, err := s.userRepo.GetByIdentity(ctx, identity.Provider, identity.Subject)
+	if err == nil {
+		// Keep the stored profile current; a failure here must not block
+		// the sign-in.
+		_ = s.userRepo.UpdateIdentityProfile(ctx, identityRecord(identity, user.ID))
+		return user, nil
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-	req.Header.Set("Accept", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+	if !errors.Is(err, repository.ErrUserNotFound) {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	var user GitHubUser
-	if err := json.Unmarshal(body, &user); err != nil {
-		return nil, err
+	if identity.Email == "" {
+		return nil, ErrOAuthEmailMissing
 	}
 
-	if user.Email == "" {
-		if emails, err := s.getGitHubEmails(accessToken); err == nil && len(emails) > 0 {
-			user.Email = emails[0].Email
+	existing, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		if !identity.EmailVerified || !existing.IsEmailVerified() {
+			return nil, ErrAccountLinkRequired
 		}
-	}
-	return &user, nil
-}
-
-func (s *oauthService) getGitHubEmails(accessToken string) ([]GitHubEmail, error) {
-	req, err := http.NewRequest("GET", "https://api.github.com/user/emails", nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	var emails []GitHubEmail
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		if err := s.userRepo.LinkIdentity(ctx, identityRecord(identity, existing.ID)); err != nil {
+			if errors.Is(err, repository.ErrIdentityAlreadyLinked) {
+				return nil, ErrAccountLinkRequired
+			}
+			return nil, err
+		}
+		return existing, nil
+	case !errors.Is(err, repository.ErrUserNotFound):
 		return nil, err
 	}
-	return emails, nil
-}
 
-func (s *oauthService) GetGoogleAuthURL(state string) string {
-	baseURL := "https://accounts.google.com/o/oauth2/v2/auth"
-	params := url.Values{
-		"client_id":     {s.cfg.GoogleClientID},
-		"redirect_uri":  {fmt.Sprintf("%s/google/callback", strings.TrimRight(s.cfg.OAuthCallbackURL, "/"))},
-		"response_type": {"code"},
-		"scope":         {"email profile"},
-		"state":         {state},
-	}
-	return fmt.Sprintf("%s?%s", baseURL, params.Encode())
-}
-
-func (s *oauthService) HandleGoogleCallback(ctx context.Context, code string) (*models.AuthResponse, error) {
-	tokenURL := "https://oauth2.googleapis.com/token"
-	data := url.Values{
-		"client_id":     {s.cfg.GoogleClientID},
-		"client_secret": {s.cfg.GoogleClientSecret},
-		"code":          {code},
-		"grant_type":    {"authorization_code"},
-		"redirect_uri":  {fmt.Sprintf("%s/google/callback", strings.TrimRight(s.cfg.OAuthCallbackURL, "/"))},
-	}
-
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil {
-		return nil, err
+	username := identity.Username
+	if username == "" {
+		username = identity.Email
 	}
-	defer resp.Body.Close()
-
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
+	user = &models.User{
+		Email:    identity.Email,
+		Username: generateUsername(username),
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
-		return nil, err
+	if identity.AvatarURL != "" {
+		user.AvatarURL = stringPtr(identity.AvatarURL)
 	}
-
-	userInfo, err := s.getGoogleUserInfo(tokenResp.AccessToken)
-	if err != nil {
-		return nil, err
+	if identity.EmailVerified {
+		user.EmailVerifiedAt = timePtr(time.Now())
 	}
 
-	user, err := s.userRepo.GetByGoogleID(ctx, userInfo.ID)
-	if err != nil {
-		if errors.Is(err, repository.ErrUserNotFound) {
-			username := generateUsername(userInfo.Email)
-			user = &models.User{
-				Email:     userInfo.Email,
-				Username:  username,
-				AvatarURL: stringPtr(userInfo.Picture),
-				GoogleID:  &userInfo.ID,
-			}
-			if err := s.userRepo.Create(ctx, user); err != nil {
-				return nil, err
-			}
-		} else {
-			return nil, err
+	if err := s.userRepo.CreateWithIdentity(ctx, user, identityRecord(identity, uuid.Nil)); err != nil {
+		if errors.Is(err, repository.ErrEmailAlreadyExists) {
+			return nil, ErrAccountLinkRequired
 		}
-	}
-
-	return s.issueTokens(ctx, user)
-}
-
-func (s *oauthService) getGoogleUserInfo(accessToken string) (*GoogleUser, error) {
-	req, err := http.NewRequest("GET", "https://www.googleapis.com/oauth2/v2/userinfo", nil)
-	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	return user, nil
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+func identityRecord(identity *oauth.Identity, userID uuid.UUID) *models.Identity {
+	record := &models.Identity{
+		UserID:   userID,
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Profile:  identity.Profile,
 	}
-	defer resp.Body.Close()
-
-	var user GoogleUser
-	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
-		return nil, err
+	if identity.Email != "" {
+		record.Email = stringPtr(identity.Email)
 	}
-	return &user, nil
+	return record
 }
 
 func (s *oauthService) issueTokens(ctx context.Context, user *models.User) (*models.AuthResponse, error) {
@@ -254,46 +174,17 @@ func (s *oauthService) issueTokens(ctx context.Context, user *models.User) (*mod
 	if !ok {
 		return nil, errors.New("auth service unavailable")
 	}
-	tokens, err := issuer.generateTokens(user)
-	if err != nil {
-		return nil, err
-	}
-	if err := issuer.storeRefreshToken(ctx, tokens.RefreshToken, user); err != nil {
-		return nil, err
-	}
-	return &models.AuthResponse{
-		User:         user.ToResponse(),
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
-		ExpiresIn:    tokens.ExpiresIn,
-	}, nil
-}
-
-type GitHubUser struct {
-	ID        int    `json:"id"`
-	Login     string `json:"login"`
-	Email     string `json:"email"`
-	AvatarURL string `json:"avatar_url"`
-	Name      string `json:"name"`
-}
-
-type GitHubEmail struct {
-	Email    string `json:"email"`
-	Primary  bool   `json:"primary"`
-	Verified bool   `json:"verified"`
-}
-
-type GoogleUser struct {
-	ID      string `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
+	return issuer.signIn(ctx, user)
 }
 
 func stringPtr(s string) *string {
 	return &s
 }
 
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
 func generateUsername(email string) string {
 	for i, c := range email {
 		if c == '@' {
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// oauthStateTTL bounds how long a user may spend on the provider's consent
+// screen.
+const oauthStateTTL = 10 * time.Minute
+
+var (
+	ErrUnsupportedProvider = errors.New("unsupported provider")
+	ErrInvalidOAuthState   = errors.New("invalid or expired oauth state")
+)
+
+func (s *oauthService) StartAuth(ctx context.Context, provider string) (*models.OAuthStart, error) {
+	return s.startAuth(ctx, provider, "", nil)
+}
+
+func (s *oauthService) startAuth(ctx context.Context, provider, linkUserID string, scopes []string) (*models.OAuthStart, error) {
+	p, ok := s.providers.Get(provider)
+	if !ok {
+		return nil, ErrUnsupportedProvider
+	}
+
+	// Links come from account settings, often to grant more scopes, so the
+	// provider is asked to show consent again.
+	params := oauth.AuthParams{Scopes: scopes, ForceConsent: linkUserID != ""}
+	for _, v := range []*string{&params.State, &params.CodeVerifier, &params.Nonce} {
+		token, err := randomURLToken()
+		if err != nil {
+			return nil, err
+		}
+		*v = token
+	}
+	binding, err := randomURLToken()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := p.AuthCodeURL(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.tokenRepo.StoreOAuthState(ctx, hashToken(params.State), &models.OAuthState{
+		Provider:     provider,
+		CodeVerifier: params.CodeVerifier,
+		BindingHash:  hashToken(binding),
+		Nonce:        params.Nonce,
+		LinkUserID:   linkUserID,
+		Scopes:       scopes,
+	}, oauthStateTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OAuthStart{
+		URL:     authURL,
+		State:   params.State,
+		Binding: binding,
+	}, nil
+}
+
+func (s *oauthService) VerifyState(ctx context.Context, provider, state, binding string) (*models.OAuthState, error) {
+	if state == "" || binding == "" {
+		return nil, ErrInvalidOAuthState
+	}
+
+	stored, err := s.tokenRepo.ConsumeOAuthState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthStateNotFound) {
+			return nil, ErrInvalidOAuthState
+		}
+		return nil, err
+	}
+
+	if stored.Provider != provider ||
+		subtle.ConstantTimeCompare([]byte(stored.BindingHash), []byte(hashToken(binding))) != 1 {
+		return nil, ErrInvalidOAuthState
+	}
+	return stored, nil
+}
+
+// randomURLToken returns 32 random bytes in base64url, which also satisfies
+// RFC 7636's 43-128 character rule for code verifiers.
+func randomURLToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/flowmate/auth-service/internal/mailer"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const minPasswordLength = 8
+
+var (
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrWeakPassword      = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+)
+
+// ForgotPassword emails a reset link if the address belongs to an account.
+// It reports success either way, and the link is made and sent after it
+// returns, so neither the answer nor its timing tells whether the address
+// is registered.
+func (s *authService) ForgotPassword(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// The request context is finished with once the request is answered.
+	go func() {
+		if err := s.sendPasswordReset(context.Background(), user); err != nil {
+			log.Printf("failed to send password reset email to user %s: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+func (s *authService) sendPasswordReset(ctx context.Context, user *models.User) error {
+	token, err := s.generateRefreshToken()
+	if err != nil {
+		return err
+	}
+	ttl := time.Duration(s.cfg.PasswordResetTTLMinutes) * time.Minute
+	if err := s.tokenRepo.StorePasswordResetToken(ctx, hashToken(token), user.ID.String(), ttl); err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render(mailer.TemplatePasswordReset, user.Email, mailer.PasswordResetData{
+		Username:       user.Username,
+		Link:           fmt.Sprintf("%s/reset-password?token=%s", strings.TrimRight(s.cfg.FrontendURL, "/"), url.QueryEscape(token)),
+		ExpiresMinutes: s.cfg.PasswordResetTTLMinutes,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
+
+// ResetPassword redeems a reset token, sets the new password and signs the
+// user out everywhere, since whoever knew the old password may hold sessions.
+func (s *authService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if len(newPassword) < minPasswordLength {
+		return ErrWeakPassword
+	}
+
+	userIDStr, err := s.tokenRepo.ConsumePasswordResetToken(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrResetTokenNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		return ErrInvalidResetToken
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), s.cfg.BcryptCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hashedPassword)
+	// Following the emailed link proves control of the address.
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = timePtr(time.Now())
+	}
+	if err := s.userRepo.Update(ctx, user); err != nil {
+		return err
+	}
+
+	return s.tokenRepo.DeleteUserTokens(ctx, user.ID.String())
+}
+
+// hashToken is how single-use secrets are stored server side. They are
+// random and high-entropy, so a fast hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/flowmate/auth-service/internal/mailer"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// chanMailer hands each message to the test, since reset emails are sent
+// after ForgotPassword returns.
+type chanMailer chan *mailer.Message
+
+func (m chanMailer) Send(_ context.Context, msg *mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+var resetLink = regexp.MustCompile(`reset-password\?token=(\S+)`)
+
+// requestReset asks for a reset link for the test user and returns its token.
+func requestReset(t *testing.T, tt *codeExchangeTest) string {
+	t.Helper()
+	sent := make(chanMailer, 1)
+	tt.auth.mailer = sent
+	tt.auth.cfg.FrontendURL = "https://app.example"
+	tt.auth.cfg.PasswordResetTTLMinutes = 30
+	tt.auth.cfg.BcryptCost = bcrypt.MinCost
+
+	if err := tt.auth.ForgotPassword(context.Background(), tt.user.Email); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-sent:
+		match := resetLink.FindStringSubmatch(msg.Text)
+		if match == nil {
+			t.Fatalf("no reset link in %q", msg.Text)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	case <-time.After(5 * time.Second):
+		t.Fatal("no password reset email was sent")
+		return ""
+	}
+}
+
+func TestForgotPasswordUnknownEmail(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	sent := make(chanMailer, 1)
+	tt.auth.mailer = sent
+
+	if err := tt.auth.ForgotPassword(context.Background(), "nobody@example.com"); err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+	select {
+	case msg := <-sent:
+		t.Fatalf("sent %q to an unknown address", msg.Subject)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestResetPasswordTokenIsSingleUse(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	token := requestReset(t, tt)
+	ctx := context.Background()
+
+	if err := tt.auth.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("first reset: %v", err)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(tt.user.PasswordHash), []byte("new-password")); err != nil {
+		t.Fatalf("password not changed: %v", err)
+	}
+
+	if err := tt.auth.ResetPassword(ctx, token, "other-password"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Fatalf("second reset: err = %v, want %v", err, ErrInvalidResetToken)
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(tt.user.PasswordHash), []byte("new-password")); err != nil {
+		t.Fatal("a reused token changed the password")
+	}
+}
+
+func TestResetPasswordEndsSessions(t *testing.T) {
+	tt := newCodeExchangeTest(t)
+	ctx := context.Background()
+	resp, err := tt.server.ExchangeCode(ctx, tt.client, tt.issueCode(t, models.ScopeOpenID, models.ScopeOfflineAccess), testRedirectURI, testCodeVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tt.auth.ResetPassword(ctx, requestReset(t, tt), "new-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := tt.tokens.GetRefreshToken(ctx, resp.RefreshToken); !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		t.Errorf("refresh token: err = %v, want %v", err, repository.ErrRefreshTokenNotFound)
+	}
+	if _, err := tt.auth.ValidateToken(ctx, resp.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("access token: err = %v, want %v", err, ErrTokenRevoked)
+	}
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// lastUsedResolution limits last-used tracking to one write per token a
+// minute, however busy the script using it.
+const lastUsedResolution = time.Minute
+
+var ErrInvalidPersonalAccessToken = errors.New("invalid personal access token")
+
+// PersonalAccessTokenService manages the long-lived tokens users create for
+// automation. Tokens act for the user within their scopes but, like OAuth
+// client tokens, cannot manage the account.
+type PersonalAccessTokenService interface {
+	// Create returns the new token; it is shown once and only its hash is
+	// kept.
+	Create(ctx context.Context, userID uuid.UUID, req *models.PersonalAccessTokenRequest) (*models.PersonalAccessTokenResponse, error)
+	List(ctx context.Context, userID uuid.UUID) ([]*models.PersonalAccessTokenResponse, error)
+	Revoke(ctx context.Context, userID, id uuid.UUID) error
+
+	// Validate resolves a presented token to claims for its user, limited
+	// to the token's scopes that the user still holds, and records the use.
+	// Like client tokens, the claims carry no roles: a token is confined to
+	// its scopes, whatever its user may do.
+	Validate(ctx context.Context, token string) (*models.Claims, error)
+	Introspect(ctx context.Context, token string) (*models.IntrospectionResponse, error)
+	// RevokeToken deletes a token presented by value, as when a leaked
+	// token is reported. Unknown tokens are not an error.
+	RevokeToken(ctx context.Context, token string) error
+}
+
+type personalAccessTokenService struct {
+	tokens   repository.PersonalAccessTokenRepository
+	userRepo repository.UserRepository
+	cfg      *config.Config
+}
+
+func NewPersonalAccessTokenService(tokens repository.PersonalAccessTokenRepository, userRepo repository.UserRepository, cfg *config.Config) PersonalAccessTokenService {
+	return &personalAccessTokenService{
+		tokens:   tokens,
+		userRepo: userRepo,
+		cfg:      cfg,
+	}
+}
+
+func (s *personalAccessTokenService) Create(ctx context.Context, userID uuid.UUID, req *models.PersonalAccessTokenRequest) (*models.PersonalAccessTokenResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidPersonalAccessToken)
+	}
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidPersonalAccessToken)
+	}
+	if !hasScopes(apiScopes(s.cfg), req.Scopes) {
+		return nil, fmt.Errorf("%w: scopes must be %s or listed in OAUTH2_SCOPES", ErrInvalidPersonalAccessToken, models.ScopeAccountRead)
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidPersonalAccessToken)
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasScopes(userScopes(s.cfg, user), req.Scopes) {
+		return nil, fmt.Errorf("%w: scopes must be granted to your account", ErrInvalidPersonalAccessToken)
+	}
+
+	secret, err := randomURLToken()
+	if err != nil {
+		return nil, err
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+	record := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: hashToken(token),
+		Scopes:    strings.Join(unionScopes(nil, req.Scopes), " "),
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.tokens.Create(ctx, record); err != nil {
+		return nil, err
+	}
+
+	resp := record.ToResponse()
+	resp.Token = token
+	return resp, nil
+}
+
+func (s *personalAccessTokenService) List(ctx context.Context, userID uuid.UUID) ([]*models.PersonalAccessTokenResponse, error) {
+	tokens, err := s.tokens.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.PersonalAccessTokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		out = append(out, token.ToResponse())
+	}
+	return out, nil
+}
+
+func (s *personalAccessTokenService) Revoke(ctx context.Context, userID, id uuid.UUID) error {
+	return s.tokens.Delete(ctx, userID, id)
+}
+
+func (s *personalAccessTokenService) Validate(ctx context.Context, token string) (*models.Claims, error) {
+	if !strings.HasPrefix(token, models.PersonalAccessTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+	pat, err := s.tokens.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrPersonalAccessTokenNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	if pat.IsExpired() {
+		return nil, ErrInvalidToken
+	}
+	user, err := s.userRepo.GetByID(ctx, pat.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	s.recordUse(ctx, pat)
+
+	claims := &models.Claims{
+		ID:                  pat.ID.String(),
+		UserID:              user.ID.String(),
+		Email:               user.Email,
+		Username:            user.Username,
+		EmailVerified:       user.IsEmailVerified(),
+		IssuedAt:            pat.CreatedAt,
+		Scopes:              withinUserScopes(s.cfg, user, strings.Fields(pat.Scopes)),
+		Principal:           models.PrincipalUser,
+		Subject:             user.ID.String(),
+		PersonalAccessToken: true,
+	}
+	if pat.ExpiresAt != nil {
+		claims.ExpiresAt = *pat.ExpiresAt
+	}
+	return claims, nil
+}
+
+// recordUse updates the token's last use. The IP is the caller's when known
+// and cleared otherwise, so a stale address is never shown with a new time.
+func (s *personalAccessTokenService) recordUse(ctx context.Context, pat *models.PersonalAccessToken) {
+	if pat.LastUsedAt != nil && time.Since(*pat.LastUsedAt) < lastUsedResolution {
+		return
+	}
+	if err := s.tokens.UpdateLastUsed(ctx, pat.ID, clientInfoFrom(ctx).IP); err != nil {
+		log.Printf("failed to record use of personal access token %s: %v", pat.ID, err)
+	}
+}
+
+func (s *personalAccessTokenService) Introspect(ctx context.Context, token string) (*models.IntrospectionResponse, error) {
+	claims, err := s.Validate(ctx, token)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			return inactiveToken, nil
+		}
+		return nil, err
+	}
+
+	resp := &models.IntrospectionResponse{
+		Active:    true,
+		Scope:     strings.Join(claims.Scopes, " "),
+		Username:  claims.Username,
+		TokenType: "Bearer",
+		Iat:       claims.IssuedAt.Unix(),
+		Sub:       claims.Subject,
+		Jti:       claims.ID,
+	}
+	if !claims.ExpiresAt.IsZero() {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	return resp, nil
+}
+
+func (s *personalAccessTokenService) RevokeToken(ctx context.Context, token string) error {
+	err := s.tokens.DeleteByHash(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrPersonalAccessTokenNotFound) {
+		return nil
+	}
+	return err
+}
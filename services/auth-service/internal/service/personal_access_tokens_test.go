@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// fakePATs holds personal access tokens in memory and counts recorded uses.
+// Methods the tests do not use panic.
+type fakePATs struct {
+	repository.PersonalAccessTokenRepository
+	tokens map[string]*models.PersonalAccessToken
+	uses   []string
+}
+
+func (r *fakePATs) Create(_ context.Context, token *models.PersonalAccessToken) error {
+	token.ID = uuid.New()
+	token.CreatedAt = time.Now()
+	r.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (r *fakePATs) GetByHash(_ context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, repository.ErrPersonalAccessTokenNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (r *fakePATs) UpdateLastUsed(_ context.Context, id uuid.UUID, ip string) error {
+	for _, token := range r.tokens {
+		if token.ID == id {
+			now := time.Now()
+			token.LastUsedAt, token.LastUsedIP = &now, &ip
+		}
+	}
+	r.uses = append(r.uses, ip)
+	return nil
+}
+
+type patTest struct {
+	service *personalAccessTokenService
+	tokens  *fakePATs
+	user    *models.User
+}
+
+func newPATTest(t *testing.T) *patTest {
+	t.Helper()
+	user := &models.User{ID: uuid.New(), Email: "user@example.com", Username: "user", Scopes: "billing:read"}
+	tokens := &fakePATs{tokens: map[string]*models.PersonalAccessToken{}}
+	cfg := &config.Config{OAuth2Scopes: "workflows:read billing:read", DefaultUserScopes: "workflows:read"}
+	return &patTest{
+		service: &personalAccessTokenService{
+			tokens:   tokens,
+			userRepo: &fakeUsers{users: map[uuid.UUID]*models.User{user.ID: user}},
+			cfg:      cfg,
+		},
+		tokens: tokens,
+		user:   user,
+	}
+}
+
+func (pt *patTest) create(t *testing.T, expiresAt *time.Time, scopes ...string) string {
+	t.Helper()
+	resp, err := pt.service.Create(context.Background(), pt.user.ID, &models.PersonalAccessTokenRequest{Name: "ci", Scopes: scopes, ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.Token
+}
+
+func TestPersonalAccessTokenValidate(t *testing.T) {
+	pt := newPATTest(t)
+	ctx := context.Background()
+	token := pt.create(t, nil, "workflows:read", "billing:read")
+
+	claims, err := pt.service.Validate(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.PersonalAccessToken || claims.Subject != pt.user.ID.String() || len(claims.Roles) != 0 {
+		t.Errorf("claims = %+v, want a personal access token for %s without roles", claims, pt.user.ID)
+	}
+	if !claims.HasScopes("workflows:read", "billing:read") {
+		t.Errorf("scopes = %v", claims.Scopes)
+	}
+
+	for name, bad := range map[string]string{
+		"unknown token":      models.PersonalAccessTokenPrefix + "unknown",
+		"missing the prefix": token[len(models.PersonalAccessTokenPrefix):],
+	} {
+		if _, err := pt.service.Validate(ctx, bad); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+}
+
+func TestPersonalAccessTokenExpired(t *testing.T) {
+	pt := newPATTest(t)
+	expiresAt := time.Now().Add(time.Hour)
+	token := pt.create(t, &expiresAt, "workflows:read")
+
+	claims, err := pt.service.Validate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expires at = %v, want %v", claims.ExpiresAt, expiresAt)
+	}
+
+	past := time.Now().Add(-time.Second)
+	pt.tokens.tokens[hashToken(token)].ExpiresAt = &past
+	if _, err := pt.service.Validate(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidToken)
+	}
+	resp, err := pt.service.Introspect(context.Background(), token)
+	if err != nil || resp.Active {
+		t.Errorf("introspect = %+v, %v; want inactive", resp, err)
+	}
+}
+
+func TestPersonalAccessTokenScopesFollowUser(t *testing.T) {
+	pt := newPATTest(t)
+	token := pt.create(t, nil, "workflows:read", "billing:read")
+
+	// An admin takes billing:read away after the token was created.
+	pt.user.Scopes = ""
+	claims, err := pt.service.Validate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.HasScopes("billing:read") || !claims.HasScopes("workflows:read") {
+		t.Errorf("scopes = %v, want only workflows:read", claims.Scopes)
+	}
+}
+
+func TestPersonalAccessTokenLastUsedThrottle(t *testing.T) {
+	pt := newPATTest(t)
+	token := pt.create(t, nil, "workflows:read")
+	ctx := WithClientInfo(context.Background(), models.ClientInfo{IP: "192.0.2.1"})
+
+	for i := 0; i < 3; i++ {
+		if _, err := pt.service.Validate(ctx, token); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(pt.tokens.uses) != 1 || pt.tokens.uses[0] != "192.0.2.1" {
+		t.Fatalf("uses = %v, want one from 192.0.2.1", pt.tokens.uses)
+	}
+
+	earlier := time.Now().Add(-lastUsedResolution)
+	pt.tokens.tokens[hashToken(token)].LastUsedAt = &earlier
+	if _, err := pt.service.Validate(context.Background(), token); err != nil {
+		t.Fatal(err)
+	}
+	// Without a known caller the stale address is cleared.
+	if len(pt.tokens.uses) != 2 || pt.tokens.uses[1] != "" {
+		t.Errorf("uses = %v, want a second use without an address", pt.tokens.uses)
+	}
+}
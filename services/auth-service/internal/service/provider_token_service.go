@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+	"github.com/flowmate/auth-service/internal/secrets"
+)
+
+// providerTokenRefreshSkew renews tokens this long before they expire so
+// callers never receive one that dies mid-request.
+const providerTokenRefreshSkew = 2 * time.Minute
+
+var (
+	ErrProviderNotLinked         = errors.New("provider not linked")
+	ErrInsufficientProviderScope = errors.New("provider token lacks the requested scopes")
+	ErrProviderReauthRequired    = errors.New("provider access expired or was revoked; the user must grant it again")
+)
+
+// ProviderTokenService keeps the access tokens users granted to FlowMate at
+// their providers, so workflows can act on their GitHub or Google resources.
+type ProviderTokenService interface {
+	Save(ctx context.Context, identity *oauth.Identity) error
+	// GetToken returns a usable access token carrying every requested scope,
+	// refreshing it first when it is about to expire.
+	GetToken(ctx context.Context, userID uuid.UUID, provider string, scopes []string) (*models.ProviderTokenResponse, error)
+}
+
+type providerTokenService struct {
+	repo      repository.ProviderTokenRepository
+	providers *oauth.Registry
+	box       *secrets.Box
+}
+
+func NewProviderTokenService(repo repository.ProviderTokenRepository, providers *oauth.Registry, box *secrets.Box) ProviderTokenService {
+	return &providerTokenService{repo: repo, providers: providers, box: box}
+}
+
+func (s *providerTokenService) Save(ctx context.Context, identity *oauth.Identity) error {
+	if identity.Token == nil || identity.Token.AccessToken == "" {
+		return nil
+	}
+	record, err := s.seal(identity.Token, "")
+	if err != nil {
+		return err
+	}
+	return s.repo.Save(ctx, identity.Provider, identity.Subject, record)
+}
+
+func (s *providerTokenService) GetToken(ctx context.Context, userID uuid.UUID, provider string, scopes []string) (*models.ProviderTokenResponse, error) {
+	record, err := s.repo.GetByUser(ctx, userID, provider)
+	if err != nil {
+		if errors.Is(err, repository.ErrProviderTokenNotFound) {
+			return nil, ErrProviderNotLinked
+		}
+		return nil, err
+	}
+
+	granted := oauth.ParseScopes(record.Scopes)
+	if !hasScopes(granted, scopes) {
+		return nil, ErrInsufficientProviderScope
+	}
+
+	if record.ExpiresAt != nil && time.Until(*record.ExpiresAt) < providerTokenRefreshSkew {
+		if record, err = s.refresh(ctx, provider, record); err != nil {
+			return nil, err
+		}
+	}
+
+	accessToken, err := s.box.Open(record.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ProviderTokenResponse{
+		AccessToken: string(accessToken),
+		TokenType:   "Bearer",
+		ExpiresAt:   record.ExpiresAt,
+		Scopes:      oauth.ParseScopes(record.Scopes),
+	}, nil
+}
+
+func (s *providerTokenService) refresh(ctx context.Context, provider string, record *models.ProviderToken) (*models.ProviderToken, error) {
+	p, ok := s.providers.Get(provider)
+	if !ok {
+		return nil, ErrUnsupportedProvider
+	}
+	refresher, ok := p.(oauth.Refresher)
+	if !ok || record.RefreshToken == nil {
+		return nil, ErrProviderReauthRequired
+	}
+
+	refreshToken, err := s.box.Open(*record.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	token, err := refresher.Refresh(ctx, string(refreshToken))
+	if err != nil {
+		if errors.Is(err, oauth.ErrInvalidGrant) {
+			return nil, ErrProviderReauthRequired
+		}
+		return nil, err
+	}
+
+	refreshed, err := s.seal(token, record.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	refreshed.IdentityID = record.IdentityID
+	if err := s.repo.SaveForIdentity(ctx, refreshed); err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == nil {
+		refreshed.RefreshToken = record.RefreshToken
+	}
+	return refreshed, nil
+}
+
+// seal encrypts a provider token for storage. fallbackScopes is used when
+// the provider did not echo the granted scopes.
+func (s *providerTokenService) seal(token *oauth.Token, fallbackScopes string) (*models.ProviderToken, error) {
+	accessToken, err := s.box.Seal([]byte(token.AccessToken))
+	if err != nil {
+		return nil, err
+	}
+	record := &models.ProviderToken{
+		AccessToken: accessToken,
+		Scopes:      strings.Join(oauth.ParseScopes(token.Scope), " "),
+	}
+	if record.Scopes == "" {
+		record.Scopes = fallbackScopes
+	}
+	if token.RefreshToken != "" {
+		refreshToken, err := s.box.Seal([]byte(token.RefreshToken))
+		if err != nil {
+			return nil, err
+		}
+		record.RefreshToken = &refreshToken
+	}
+	if !token.Expiry.IsZero() {
+		record.ExpiresAt = timePtr(token.Expiry)
+	}
+	return record, nil
+}
+
+func hasScopes(granted, requested []string) bool {
+	have := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		have[scope] = true
+	}
+	for _, scope := range requested {
+		if !have[scope] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/oidc"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+// ServiceClientManager registers the backend services allowed to use the
+// client_credentials grant. Operators use it through cmd/clients; it is not
+// exposed over HTTP.
+type ServiceClientManager interface {
+	Register(ctx context.Context, req *models.ServiceClientRequest) (*models.OAuthClientResponse, error)
+	List(ctx context.Context) ([]*models.OAuthClientResponse, error)
+	// Delete removes the client. Tokens already issued to it stay valid
+	// until they expire.
+	Delete(ctx context.Context, clientID string) error
+}
+
+type serviceClientManager struct {
+	clients repository.OAuthClientRepository
+	cfg     *config.Config
+}
+
+func NewServiceClientManager(clients repository.OAuthClientRepository, cfg *config.Config) ServiceClientManager {
+	return &serviceClientManager{clients: clients, cfg: cfg}
+}
+
+func (m *serviceClientManager) Register(ctx context.Context, req *models.ServiceClientRequest) (*models.OAuthClientResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidClientMetadata)
+	}
+	// Service tokens carry API scopes only; the OpenID ones describe a user.
+	allowed := unionScopes(oauth.ParseScopes(m.cfg.OAuth2Scopes), []string{models.ScopeProviderTokensRead})
+	if !hasScopes(allowed, req.Scopes) {
+		return nil, fmt.Errorf("%w: scopes must be listed in OAUTH2_SCOPES or be %s", ErrInvalidClientMetadata, models.ScopeProviderTokensRead)
+	}
+	if len(req.Audiences) == 0 {
+		return nil, fmt.Errorf("%w: at least one audience is required", ErrInvalidClientMetadata)
+	}
+	for _, aud := range req.Audiences {
+		if aud == "" || strings.ContainsAny(aud, " \t\n") {
+			return nil, fmt.Errorf("%w: invalid audience %q", ErrInvalidClientMetadata, aud)
+		}
+	}
+
+	clientID, err := randomClientID()
+	if err != nil {
+		return nil, err
+	}
+	client := &models.OAuthClient{
+		ClientID:  clientID,
+		Name:      name,
+		Scopes:    strings.Join(req.Scopes, " "),
+		Service:   true,
+		Audiences: strings.Join(req.Audiences, " "),
+	}
+
+	var secret string
+	if req.JWKS != "" {
+		keys, err := oidc.ParseKeySet([]byte(req.JWKS))
+		if err != nil || len(keys) == 0 {
+			return nil, fmt.Errorf("%w: jwks has no usable signing keys", ErrInvalidClientMetadata)
+		}
+		client.JWKS = stringPtr(req.JWKS)
+	} else {
+		secret, err = randomURLToken()
+		if err != nil {
+			return nil, err
+		}
+		client.ClientSecretHash = stringPtr(hashToken(secret))
+	}
+
+	if err := m.clients.Create(ctx, client); err != nil {
+		return nil, err
+	}
+	resp := client.ToResponse()
+	resp.ClientSecret = secret
+	return resp, nil
+}
+
+func (m *serviceClientManager) List(ctx context.Context) ([]*models.OAuthClientResponse, error) {
+	clients, err := m.clients.ListService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		out = append(out, client.ToResponse())
+	}
+	return out, nil
+}
+
+func (m *serviceClientManager) Delete(ctx context.Context, clientID string) error {
+	return m.clients.DeleteService(ctx, clientID)
+}
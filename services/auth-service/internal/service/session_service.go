@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+type SessionService interface {
+	ListSessions(ctx context.Context, userID, currentSessionID string) ([]*models.SessionResponse, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) (int, error)
+}
+
+type sessionService struct {
+	tokenRepo repository.TokenRepository
+}
+
+func NewSessionService(tokenRepo repository.TokenRepository) SessionService {
+	return &sessionService{tokenRepo: tokenRepo}
+}
+
+func (s *sessionService) ListSessions(ctx context.Context, userID, currentSessionID string) ([]*models.SessionResponse, error) {
+	families, err := s.tokenRepo.ListUserTokenFamilies(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]*models.SessionResponse, 0, len(families))
+	for _, family := range families {
+		sessions = append(sessions, family.ToSessionResponse(currentSessionID))
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (s *sessionService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	family, err := s.tokenRepo.GetTokenFamily(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTokenFamilyNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	// Report other users' sessions as missing rather than forbidden so IDs
+	// cannot be probed.
+	if family.UserID != userID {
+		return ErrSessionNotFound
+	}
+	return s.tokenRepo.RevokeTokenFamily(ctx, sessionID)
+}
+
+func (s *sessionService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) (int, error) {
+	families, err := s.tokenRepo.ListUserTokenFamilies(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, family := range families {
+		if family.ID == currentSessionID {
+			continue
+		}
+		if err := s.tokenRepo.RevokeTokenFamily(ctx, family.ID); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/oauth"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+var ErrInvalidUserAccess = errors.New("invalid roles or scopes")
+
+// UserAccessService lets admins change a user's roles and scopes. Access
+// tokens already issued keep the old ones until they are refreshed.
+type UserAccessService interface {
+	Get(ctx context.Context, userID uuid.UUID) (*models.UserAccessResponse, error)
+	Update(ctx context.Context, userID uuid.UUID, req *models.UserAccessRequest) (*models.UserAccessResponse, error)
+}
+
+type userAccessService struct {
+	userRepo repository.UserRepository
+	cfg      *config.Config
+}
+
+func NewUserAccessService(userRepo repository.UserRepository, cfg *config.Config) UserAccessService {
+	return &userAccessService{userRepo: userRepo, cfg: cfg}
+}
+
+func (s *userAccessService) Get(ctx context.Context, userID uuid.UUID) (*models.UserAccessResponse, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.response(user), nil
+}
+
+func (s *userAccessService) Update(ctx context.Context, userID uuid.UUID, req *models.UserAccessRequest) (*models.UserAccessResponse, error) {
+	for _, role := range req.Roles {
+		if role == "" || strings.ContainsAny(role, " \t\n") {
+			return nil, fmt.Errorf("%w: invalid role %q", ErrInvalidUserAccess, role)
+		}
+	}
+	if !hasScopes(oauth.ParseScopes(s.cfg.OAuth2Scopes), req.Scopes) {
+		return nil, fmt.Errorf("%w: scopes must be listed in OAUTH2_SCOPES", ErrInvalidUserAccess)
+	}
+
+	roles := strings.Join(unionScopes(nil, req.Roles), " ")
+	scopes := strings.Join(unionScopes(nil, req.Scopes), " ")
+	if err := s.userRepo.UpdateAccess(ctx, userID, roles, scopes); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID)
+}
+
+func (s *userAccessService) response(user *models.User) *models.UserAccessResponse {
+	return &models.UserAccessResponse{
+		UserID:          user.ID,
+		Roles:           strings.Fields(user.Roles),
+		Scopes:          strings.Fields(user.Scopes),
+		EffectiveScopes: userScopes(s.cfg, user),
+	}
+}
+
+// apiScopes are the API scopes clients and personal access tokens may be
+// granted: the service's own and those listed in OAUTH2_SCOPES.
+func apiScopes(cfg *config.Config) []string {
+	return unionScopes([]string{models.ScopeAccountRead}, oauth.ParseScopes(cfg.OAuth2Scopes))
+}
+
+// userScopes are the API scopes the user's own tokens carry: the service's
+// own, the defaults everyone has and those granted to the user.
+func userScopes(cfg *config.Config, user *models.User) []string {
+	scopes := unionScopes([]string{models.ScopeAccountRead}, oauth.ParseScopes(cfg.DefaultUserScopes))
+	return unionScopes(scopes, strings.Fields(user.Scopes))
+}
+
+// withinUserScopes drops the API scopes the user does not hold, so neither
+// an OAuth client nor a personal access token can do more than its user.
+// The OpenID scopes only describe the user and are kept.
+func withinUserScopes(cfg *config.Config, user *models.User, scopes []string) []string {
+	held := userScopes(cfg, user)
+	out := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		switch scope {
+		case models.ScopeOpenID, models.ScopeProfile, models.ScopeEmail, models.ScopeOfflineAccess:
+		default:
+			if !hasScopes(held, []string{scope}) {
+				continue
+			}
+		}
+		out = append(out, scope)
+	}
+	return out
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+func TestWithinUserScopes(t *testing.T) {
+	cfg := &config.Config{OAuth2Scopes: "workflows:read workflows:write billing:read", DefaultUserScopes: "workflows:read"}
+	tests := []struct {
+		name       string
+		userScopes string
+		requested  []string
+		want       []string
+	}{
+		{"defaults and own scope", "", []string{models.ScopeAccountRead, "workflows:read"}, []string{models.ScopeAccountRead, "workflows:read"}},
+		{"granted on top of the defaults", "billing:read", []string{"billing:read"}, []string{"billing:read"}},
+		{"scope the user does not hold", "", []string{"workflows:read", "workflows:write"}, []string{"workflows:read"}},
+		{"scope the user lost", "", []string{"billing:read"}, []string{}},
+		{"OpenID scopes are kept", "", []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeOfflineAccess, "workflows:write"}, []string{models.ScopeOpenID, models.ScopeEmail, models.ScopeOfflineAccess}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := withinUserScopes(cfg, &models.User{Scopes: tc.userScopes}, tc.requested)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("withinUserScopes = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
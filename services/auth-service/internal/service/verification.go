@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/mailer"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const verifyEmailPurpose = "verify-email"
+
+var ErrInvalidVerificationToken = errors.New("invalid or expired verification link")
+
+// verificationClaims is signed into the link. Binding the email means a link
+// stops working once the account's address changes.
+type verificationClaims struct {
+	UserID string `json:"uid"`
+	Email  string `json:"email"`
+}
+
+func (s *authService) VerifyEmail(ctx context.Context, token string) (*models.UserResponse, error) {
+	var claims verificationClaims
+	if err := s.signer.Verify(verifyEmailPurpose, token, &claims); err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, userID, claims.Email); err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return user.ToResponse(), nil
+}
+
+// ResendVerification never reports whether the address belongs to an
+// account, so it cannot be used to enumerate users.
+func (s *authService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repository.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+	if user.IsEmailVerified() {
+		return nil
+	}
+
+	if err := s.sendVerification(ctx, user); err != nil {
+		log.Printf("failed to resend verification email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+func (s *authService) sendVerification(ctx context.Context, user *models.User) error {
+	ttl := time.Duration(s.cfg.EmailVerificationTTLHours) * time.Hour
+	token, err := s.signer.Sign(verifyEmailPurpose, verificationClaims{
+		UserID: user.ID.String(),
+		Email:  user.Email,
+	}, ttl)
+	if err != nil {
+		return err
+	}
+
+	msg, err := mailer.Render(mailer.TemplateVerifyEmail, user.Email, mailer.VerifyEmailData{
+		Username:     user.Username,
+		Link:         fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(s.cfg.FrontendURL, "/"), url.QueryEscape(token)),
+		ExpiresHours: s.cfg.EmailVerificationTTLHours,
+	})
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, msg)
+}
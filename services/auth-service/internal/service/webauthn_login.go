@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+
+	"github.com/flowmate/auth-service/internal/models"
+)
+
+// PasskeyLogin signs a user in with a discoverable credential. The ceremony
+// requires user verification, so no further factor is asked for.
+func (s *authService) PasskeyLogin(ctx context.Context, ceremonyID string, credential []byte) (*models.AuthResponse, error) {
+	user, err := s.webauthn.FinishLogin(ctx, ceremonyID, credential)
+	if err != nil {
+		return nil, err
+	}
+	return s.startSession(ctx, user)
+}
+
+func (s *authService) BeginWebAuthnMFA(ctx context.Context, mfaToken string) (*models.WebAuthnCeremony, error) {
+	userID, err := s.mfaChallengeUser(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	return s.webauthn.BeginMFA(ctx, userID)
+}
+
+func (s *authService) VerifyWebAuthnMFA(ctx context.Context, mfaToken, ceremonyID string, credential []byte) (*models.AuthResponse, error) {
+	userID, err := s.mfaChallengeUser(ctx, mfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.webauthn.FinishMFA(ctx, userID, ceremonyID, credential); err != nil {
+		return nil, err
+	}
+	return s.completeMFA(ctx, mfaToken, userID)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+
+	"github.com/flowmate/auth-service/internal/config"
+	"github.com/flowmate/auth-service/internal/events"
+	"github.com/flowmate/auth-service/internal/models"
+	"github.com/flowmate/auth-service/internal/repository"
+)
+
+const webauthnCeremonyTTL = 5 * time.Minute
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+	ceremonyMFA          = "mfa"
+)
+
+var (
+	ErrWebAuthnCeremonyNotFound   = errors.New("webauthn ceremony not found or expired")
+	ErrWebAuthnFailed             = errors.New("webauthn verification failed")
+	ErrWebAuthnCredentialNotFound = errors.New("passkey not found")
+	ErrWebAuthnCredentialExists   = errors.New("passkey already registered")
+	ErrWebAuthnCloned             = errors.New("passkey signature counter did not increase")
+)
+
+// WebAuthnService runs the registration and assertion ceremonies for passkeys
+// and security keys. Challenges live in Redis and can be answered once.
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, userID uuid.UUID) (*models.WebAuthnCeremony, error)
+	FinishRegistration(ctx context.Context, userID uuid.UUID, ceremonyID, name string, credential []byte) (*models.WebAuthnCredentialResponse, error)
+	ListCredentials(ctx context.Context, userID uuid.UUID) ([]*models.WebAuthnCredentialResponse, error)
+	DeleteCredential(ctx context.Context, userID, id uuid.UUID) error
+	HasCredentials(ctx context.Context, userID uuid.UUID) (bool, error)
+	// BeginLogin starts a passwordless login with a discoverable credential.
+	BeginLogin(ctx context.Context) (*models.WebAuthnCeremony, error)
+	FinishLogin(ctx context.Context, ceremonyID string, credential []byte) (*models.User, error)
+	// BeginMFA and FinishMFA use one of a known user's credentials as a
+	// second factor.
+	BeginMFA(ctx context.Context, userID uuid.UUID) (*models.WebAuthnCeremony, error)
+	FinishMFA(ctx context.Context, userID uuid.UUID, ceremonyID string, credential []byte) error
+}
+
+type webAuthnService struct {
+	wa        *webauthn.WebAuthn
+	credRepo  repository.WebAuthnRepository
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
+	events    events.Emitter
+}
+
+// ceremony is what is kept in Redis between the begin and finish calls.
+type ceremony struct {
+	Kind    string               `json:"kind"`
+	UserID  string               `json:"user_id,omitempty"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// webauthnUser adapts a user and their credentials to the library. The user
+// handle is the user's UUID, which is random and carries no personal data.
+type webauthnUser struct {
+	user        *models.User
+	records     []*models.WebAuthnCredential
+	credentials []webauthn.Credential
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return u.user.ID[:] }
+func (u *webauthnUser) WebAuthnName() string                       { return u.user.Email }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return u.user.Username }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+// NewWebAuthnService derives the relying party ID and allowed origins from
+// FRONTEND_URL unless WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS are set.
+func NewWebAuthnService(credRepo repository.WebAuthnRepository, userRepo repository.UserRepository, tokenRepo repository.TokenRepository, emitter events.Emitter, cfg *config.Config) (WebAuthnService, error) {
+	origins := config.GetAllowedOrigins(cfg.WebAuthnOrigins)
+	if len(origins) == 0 {
+		origins = []string{strings.TrimRight(cfg.FrontendURL, "/")}
+	}
+	rpID := cfg.WebAuthnRPID
+	if rpID == "" {
+		u, err := url.Parse(origins[0])
+		if err != nil || u.Hostname() == "" {
+			return nil, fmt.Errorf("cannot derive WEBAUTHN_RP_ID from %q", origins[0])
+		}
+		rpID = u.Hostname()
+	}
+
+	timeout := webauthn.TimeoutConfig{Enforce: true, Timeout: webauthnCeremonyTTL, TimeoutUVD: webauthnCeremonyTTL}
+	wa, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: cfg.WebAuthnRPName,
+		RPOrigins:     origins,
+		Timeouts:      webauthn.TimeoutsConfig{Login: timeout, Registration: timeout},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &webAuthnService{
+		wa:        wa,
+		credRepo:  credRepo,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+		events:    emitter,
+	}, nil
+}
+
+func (s *webAuthnService) BeginRegistration(ctx context.Context, userID uuid.UUID) (*models.WebAuthnCeremony, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	creation, session, err := s.wa.BeginRegistration(user,
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementPreferred,
+			UserVerification: protocol.VerificationPreferred,
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return s.saveCeremony(ctx, ceremonyRegistration, userID.String(), session, creation)
+}
+
+func (s *webAuthnService) FinishRegistration(ctx context.Context, userID uuid.UUID, ceremonyID, name string, credential []byte) (*models.WebAuthnCredentialResponse, error) {
+	session, err := s.consumeCeremony(ctx, ceremonyID, ceremonyRegistration, userID.String())
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+	created, err := s.wa.CreateCredential(user, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	transports := make([]string, len(created.Transport))
+	for i, t := range created.Transport {
+		transports[i] = string(t)
+	}
+
+	record := &models.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    created.ID,
+		PublicKey:       created.PublicKey,
+		AttestationType: created.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          created.Authenticator.AAGUID,
+		SignCount:       int64(created.Authenticator.SignCount),
+		Flags:           int16(created.Flags.ProtocolValue()),
+		Name:            name,
+	}
+	if err := s.credRepo.Create(ctx, record); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialExists) {
+			return nil, ErrWebAuthnCredentialExists
+		}
+		return nil, err
+	}
+	return record.ToResponse(), nil
+}
+
+func (s *webAuthnService) ListCredentials(ctx context.Context, userID uuid.UUID) ([]*models.WebAuthnCredentialResponse, error) {
+	records, err := s.credRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.WebAuthnCredentialResponse, 0, len(records))
+	for _, record := range records {
+		out = append(out, record.ToResponse())
+	}
+	return out, nil
+}
+
+// DeleteCredential refuses to delete the last passkey of an account that has
+// no password and no linked provider.
+func (s *webAuthnService) DeleteCredential(ctx context.Context, userID, id uuid.UUID) error {
+	if err := s.credRepo.Delete(ctx, userID, id); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+			return ErrWebAuthnCredentialNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *webAuthnService) HasCredentials(ctx context.Context, userID uuid.UUID) (bool, error) {
+	n, err := s.credRepo.CountByUser(ctx, userID)
+	return n > 0, err
+}
+
+func (s *webAuthnService) BeginLogin(ctx context.Context) (*models.WebAuthnCeremony, error) {
+	// Passwordless logins must verify the user (PIN or biometric) so the
+	// passkey alone stands in for both factors.
+	assertion, session, err := s.wa.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+	return s.saveCeremony(ctx, ceremonyLogin, "", session, assertion)
+}
+
+func (s *webAuthnService) FinishLogin(ctx context.Context, ceremonyID string, credential []byte) (*models.User, error) {
+	session, err := s.consumeCeremony(ctx, ceremonyID, ceremonyLogin, "")
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(credential)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	lookup := func(rawID, userHandle []byte) (webauthn.User, error) {
+		userID, err := uuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		return s.loadUser(ctx, userID)
+	}
+	found, validated, err := s.wa.ValidatePasskeyLogin(lookup, *session, parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+
+	user := found.(*webauthnUser)
+	if err := s.recordUse(ctx, user, validated); err != nil {
+		return nil, err
+	}
+	return user.user, nil
+}
+
+func (s *webAuthnService) BeginMFA(ctx context.Context, userID uuid.UUID) (*models.WebAuthnCeremony, error) {
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, ErrWebAuthnCredentialNotFound
+	}
+
+	assertion, session, err := s.wa.BeginLogin(user, webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		return nil, err
+	}
+	return s.saveCeremony(ctx, ceremonyMFA, userID.String(), session, assertion)
+}
+
+func (s *webAuthnService) FinishMFA(ctx context.Context, userID uuid.UUID, ceremonyID string, credential []byte) error {
+	session, err := s.consumeCeremony(ctx, ceremonyID, ceremonyMFA, userID.String())
+	if err != nil {
+		return err
+	}
+	user, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(credential)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+	validated, err := s.wa.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrWebAuthnFailed, err)
+	}
+	return s.recordUse(ctx, user, validated)
+}
+
+// recordUse applies the signature counter check. A counter that fails to
+// increase suggests the authenticator was cloned, so the login is refused.
+func (s *webAuthnService) recordUse(ctx context.Context, user *webauthnUser, credential *webauthn.Credential) error {
+	if credential.Authenticator.CloneWarning {
+		s.events.Emit(ctx, events.SecurityEvent{
+			Type:    events.WebAuthnCloneDetected,
+			UserID:  user.user.ID.String(),
+			Details: map[string]string{"credential_id": s.credentialRecordID(user, credential.ID)},
+		})
+		return ErrWebAuthnCloned
+	}
+	return s.credRepo.UpdateUsage(ctx, credential.ID, int64(credential.Authenticator.SignCount), int16(credential.Flags.ProtocolValue()))
+}
+
+func (s *webAuthnService) credentialRecordID(user *webauthnUser, credentialID []byte) string {
+	for _, record := range user.records {
+		if string(record.CredentialID) == string(credentialID) {
+			return record.ID.String()
+		}
+	}
+	return ""
+}
+
+func (s *webAuthnService) loadUser(ctx context.Context, userID uuid.UUID) (*webauthnUser, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	records, err := s.credRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials := make([]webauthn.Credential, 0, len(records))
+	for _, record := range records {
+		var transports []protocol.AuthenticatorTransport
+		for _, t := range strings.Split(record.Transports, ",") {
+			if t != "" {
+				transports = append(transports, protocol.AuthenticatorTransport(t))
+			}
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              record.CredentialID,
+			PublicKey:       record.PublicKey,
+			AttestationType: record.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(record.Flags)),
+			Authenticator: webauthn.Authenticator{
+				AAGUID:    record.AAGUID,
+				SignCount: uint32(record.SignCount),
+			},
+		})
+	}
+	return &webauthnUser{user: user, records: records, credentials: credentials}, nil
+}
+
+func (s *webAuthnService) saveCeremony(ctx context.Context, kind, userID string, session *webauthn.SessionData, options interface{}) (*models.WebAuthnCeremony, error) {
+	data, err := json.Marshal(ceremony{Kind: kind, UserID: userID, Session: *session})
+	if err != nil {
+		return nil, err
+	}
+	ceremonyID := uuid.New().String()
+	if err := s.tokenRepo.StoreWebAuthnCeremony(ctx, ceremonyID, data, webauthnCeremonyTTL); err != nil {
+		return nil, err
+	}
+	return &models.WebAuthnCeremony{CeremonyID: ceremonyID, Options: options}, nil
+}
+
+// consumeCeremony loads and deletes a ceremony, checking it was started for
+// the same purpose and, where relevant, the same user.
+func (s *webAuthnService) consumeCeremony(ctx context.Context, ceremonyID, kind, userID string) (*webauthn.SessionData, error) {
+	data, err := s.tokenRepo.ConsumeWebAuthnCeremony(ctx, ceremonyID)
+	if err != nil {
+		if errors.Is(err, repository.ErrCeremonyNotFound) {
+			return nil, ErrWebAuthnCeremonyNotFound
+		}
+		return nil, err
+	}
+
+	var c ceremony
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Kind != kind || c.UserID != userID {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+	return &c.Session, nil
+}
@@ -0,0 +1,87 @@
+package useragent
+
+import (
+	"regexp"
+	"strings"
+)
+
+type Info struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+	Raw     string `json:"raw"`
+}
+
+type rule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// Order matters: several browsers include the tokens of the engines they are
+// built on (Edge and Opera report Chrome, Chrome reports Safari).
+var browsers = []rule{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+	{"FlowMate CLI", regexp.MustCompile(`flowmate-cli/([\d.]+)`)},
+	{"curl", regexp.MustCompile(`curl/([\d.]+)`)},
+}
+
+var systems = []rule{
+	{"iOS", regexp.MustCompile(`(?:iPhone|iPad|iPod).*OS ([\d_]+)`)},
+	{"Android", regexp.MustCompile(`Android ([\d.]+)`)},
+	{"Windows", regexp.MustCompile(`Windows NT ([\d.]+)`)},
+	{"macOS", regexp.MustCompile(`Mac OS X ([\d_.]+)`)},
+	{"ChromeOS", regexp.MustCompile(`CrOS \S+ ([\d.]+)`)},
+	{"Linux", regexp.MustCompile(`Linux()`)},
+}
+
+func Parse(ua string) Info {
+	info := Info{Browser: "Unknown", OS: "Unknown", Device: "desktop", Raw: ua}
+	if ua == "" {
+		return info
+	}
+
+	if name, version := match(browsers, ua); name != "" {
+		info.Browser = join(name, majorVersion(version))
+	}
+	if name, version := match(systems, ua); name != "" {
+		info.OS = join(name, strings.ReplaceAll(version, "_", "."))
+	}
+
+	switch {
+	case strings.Contains(ua, "iPad") || strings.Contains(ua, "Tablet"):
+		info.Device = "tablet"
+	case strings.Contains(ua, "Mobi") || strings.Contains(ua, "iPhone"):
+		info.Device = "mobile"
+	case info.Browser == "Unknown" || strings.HasPrefix(info.Browser, "curl") || strings.HasPrefix(info.Browser, "FlowMate CLI"):
+		info.Device = "other"
+	}
+	return info
+}
+
+func match(rules []rule, ua string) (string, string) {
+	for _, r := range rules {
+		if m := r.pattern.FindStringSubmatch(ua); m != nil {
+			return r.name, m[1]
+		}
+	}
+	return "", ""
+}
+
+func majorVersion(version string) string {
+	if i := strings.Index(version, "."); i > 0 {
+		return version[:i]
+	}
+	return version
+}
+
+func join(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + " " + version
+}
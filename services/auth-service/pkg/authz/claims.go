@@ -0,0 +1,148 @@
+// Package authz verifies FlowMate access tokens and authorizes requests
+// carrying them. The auth service uses it for its own routes; other services
+// import it to accept the same tokens, verified against the published JWKS.
+package authz
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrUnavailable is returned when a token's status cannot be
+	// established, because the denylist or the key set cannot be reached.
+	ErrUnavailable = errors.New("token status unavailable")
+)
+
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+type Claims struct {
+	ID        string `json:"jti"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Username  string `json:"username"`
+	SessionID string `json:"sid"`
+	// EmailVerified is false only when the token says so explicitly; tokens
+	// issued before the claim existed are treated as verified.
+	EmailVerified bool      `json:"email_verified"`
+	IssuedAt      time.Time `json:"issued_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	// ClientID is set on tokens issued to OAuth clients acting for the
+	// user. Scopes are what the token may do: the user's own scopes on
+	// first-party tokens, the granted ones on all others.
+	ClientID string   `json:"client_id,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	// Principal says who the token speaks for. Subject is the user ID for
+	// users and the client ID for services, which have no UserID, Email or
+	// session. Audience lists the services a service token is meant for.
+	Principal string   `json:"principal"`
+	Subject   string   `json:"sub"`
+	Audience  []string `json:"aud,omitempty"`
+	// PersonalAccessToken marks claims resolved from a personal access token
+	// rather than a JWT. ID is then the token's ID and ExpiresAt is zero for
+	// tokens that do not expire.
+	PersonalAccessToken bool `json:"personal_access_token,omitempty"`
+	// Roles are the user's. Only first-party tokens carry them; service,
+	// OAuth client and personal access tokens have none.
+	Roles []string `json:"roles,omitempty"`
+}
+
+func (c *Claims) IsService() bool {
+	return c.Principal == PrincipalService
+}
+
+// HasRole reports whether the token's user holds role.
+func (c *Claims) HasRole(role string) bool {
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAudience reports whether the token was issued for aud.
+func (c *Claims) HasAudience(aud string) bool {
+	for _, a := range c.Audience {
+		if a == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScopes reports whether the token was granted every one of scopes.
+func (c *Claims) HasScopes(scopes ...string) bool {
+	for _, scope := range scopes {
+		found := false
+		for _, s := range c.Scopes {
+			if s == scope {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// FromJWT maps the claims of a verified access token. A token speaks either
+// for a user, or for a service client when its sub is the client ID.
+func FromJWT(claims jwt.MapClaims) (*Claims, error) {
+	result := &Claims{
+		ID:        stringClaim(claims, "jti"),
+		UserID:    stringClaim(claims, "user_id"),
+		Email:     stringClaim(claims, "email"),
+		Username:  stringClaim(claims, "username"),
+		SessionID: stringClaim(claims, "sid"),
+		ClientID:  stringClaim(claims, "client_id"),
+		Scopes:    strings.Fields(stringClaim(claims, "scope")),
+		// Tokens minted before the claim existed carry no opinion.
+		EmailVerified: true,
+	}
+	if verified, ok := claims["email_verified"].(bool); ok {
+		result.EmailVerified = verified
+	}
+	if roles, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range roles {
+			if role, ok := role.(string); ok {
+				result.Roles = append(result.Roles, role)
+			}
+		}
+	}
+	switch sub := stringClaim(claims, "sub"); {
+	case result.UserID != "":
+		result.Principal = PrincipalUser
+		result.Subject = result.UserID
+	case result.ClientID != "" && sub == result.ClientID:
+		// client_credentials tokens speak for the client itself.
+		result.Principal = PrincipalService
+		result.Subject = sub
+		result.EmailVerified = false
+		result.Audience, _ = claims.GetAudience()
+	default:
+		return nil, ErrInvalidToken
+	}
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+		result.ExpiresAt = exp.Time
+	}
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		result.IssuedAt = iat.Time
+	}
+	return result, nil
+}
+
+func stringClaim(claims jwt.MapClaims, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
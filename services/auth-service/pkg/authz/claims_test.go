@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestFromJWT(t *testing.T) {
+	tests := []struct {
+		name          string
+		claims        jwt.MapClaims
+		wantPrincipal string
+		wantSubject   string
+		wantAudience  []string
+		wantVerified  bool
+		wantErr       error
+	}{
+		{
+			name:          "first-party user token",
+			claims:        jwt.MapClaims{"sub": "user-1", "user_id": "user-1", "scope": "account:read"},
+			wantPrincipal: PrincipalUser,
+			wantSubject:   "user-1",
+			wantVerified:  true,
+		},
+		{
+			name:          "user token issued to a client",
+			claims:        jwt.MapClaims{"sub": "user-1", "user_id": "user-1", "client_id": "client-1", "email_verified": false},
+			wantPrincipal: PrincipalUser,
+			wantSubject:   "user-1",
+			wantVerified:  false,
+		},
+		{
+			name:          "service token",
+			claims:        jwt.MapClaims{"sub": "billing", "client_id": "billing", "aud": []interface{}{"workflows", "mail"}, "email_verified": true},
+			wantPrincipal: PrincipalService,
+			wantSubject:   "billing",
+			wantAudience:  []string{"workflows", "mail"},
+			wantVerified:  false,
+		},
+		{
+			name:    "client token whose sub is someone else",
+			claims:  jwt.MapClaims{"sub": "user-1", "client_id": "billing"},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "no user and no client",
+			claims:  jwt.MapClaims{"sub": "user-1"},
+			wantErr: ErrInvalidToken,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := FromJWT(tc.claims)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Principal != tc.wantPrincipal || claims.Subject != tc.wantSubject {
+				t.Errorf("principal = %q %q, want %q %q", claims.Principal, claims.Subject, tc.wantPrincipal, tc.wantSubject)
+			}
+			if !reflect.DeepEqual(claims.Audience, tc.wantAudience) {
+				t.Errorf("audience = %v, want %v", claims.Audience, tc.wantAudience)
+			}
+			if claims.EmailVerified != tc.wantVerified {
+				t.Errorf("email verified = %v, want %v", claims.EmailVerified, tc.wantVerified)
+			}
+		})
+	}
+}
+
+func TestFromJWTRolesAndScopes(t *testing.T) {
+	claims, err := FromJWT(jwt.MapClaims{
+		"sub":     "user-1",
+		"user_id": "user-1",
+		"scope":   "account:read workflows:write",
+		"roles":   []interface{}{"admin", 7, "support"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.HasScopes("account:read", "workflows:write") || claims.HasScopes("admin") {
+		t.Errorf("scopes = %v", claims.Scopes)
+	}
+	if want := []string{"admin", "support"}; !reflect.DeepEqual(claims.Roles, want) {
+		t.Errorf("roles = %v, want %v", claims.Roles, want)
+	}
+}
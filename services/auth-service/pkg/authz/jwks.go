@@ -0,0 +1,65 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/flowmate/auth-service/internal/oidc"
+)
+
+const clockSkew = time.Minute
+
+// jwksAlgs are the algorithms of keys the auth service publishes. HMAC keys
+// are never published, so HS256 tokens cannot be verified elsewhere.
+var jwksAlgs = []string{"RS256", "EdDSA"}
+
+// JWKSValidator verifies access tokens against the key set the auth service
+// publishes at /.well-known/jwks.json, refetching it when a token names an
+// unknown kid. It cannot see revocations, so tokens stay valid until they
+// expire; services that must honour revocation, or accept personal access
+// tokens, ask /oauth2/introspect instead.
+type JWKSValidator struct {
+	keys   *oidc.KeySet
+	issuer string
+}
+
+// NewJWKSValidator verifies tokens with the keys at jwksURL. Tokens must name
+// issuer as their iss unless it is empty. client should have a timeout.
+func NewJWKSValidator(jwksURL, issuer string, client *http.Client) *JWKSValidator {
+	return &JWKSValidator{keys: oidc.NewKeySet(jwksURL, client), issuer: issuer}
+}
+
+func (v *JWKSValidator) Validate(ctx context.Context, token string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(jwksAlgs),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(clockSkew),
+	}
+	if v.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(v.issuer))
+	}
+
+	// A key set that cannot be fetched says nothing about the token.
+	var fetchErr error
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, err := v.keys.Key(ctx, kid)
+		if err != nil && !errors.Is(err, oidc.ErrUnknownKey) {
+			fetchErr = err
+		}
+		return key, err
+	}, opts...)
+	if fetchErr != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, fetchErr)
+	}
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	return FromJWT(claims)
+}
@@ -0,0 +1,170 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Validator verifies an access token and returns its claims. Errors wrapping
+// ErrUnavailable answer 503 and ErrTokenRevoked a distinct 401.
+type Validator interface {
+	Validate(ctx context.Context, token string) (*Claims, error)
+}
+
+type Config struct {
+	// Audience is this service's name in service tokens; tokens minted for
+	// other services are refused. Empty refuses all service tokens.
+	Audience string
+	// Token extracts the token from the request. It defaults to
+	// BearerToken; errors of type *fiber.Error are answered as such.
+	Token func(c *fiber.Ctx) (string, error)
+}
+
+type Middleware struct {
+	validator Validator
+	cfg       Config
+}
+
+func New(validator Validator, cfg Config) *Middleware {
+	if cfg.Token == nil {
+		cfg.Token = BearerToken
+	}
+	return &Middleware{validator: validator, cfg: cfg}
+}
+
+// BearerToken reads the token from the Authorization header.
+func BearerToken(c *fiber.Ctx) (string, error) {
+	authHeader := c.Get("Authorization")
+	if authHeader == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Missing authorization header")
+	}
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "Invalid authorization header format")
+	}
+	return parts[1], nil
+}
+
+// ClaimsFrom returns the claims Protect verified, or nil outside it.
+func ClaimsFrom(c *fiber.Ctx) *Claims {
+	claims, _ := c.Locals("claims").(*Claims)
+	return claims
+}
+
+func (m *Middleware) Protect() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, err := m.cfg.Token(c)
+		if err != nil {
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				return c.Status(fe.Code).JSON(fiber.Map{"error": fe.Message})
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing authorization header"})
+		}
+
+		claims, err := m.validator.Validate(c.UserContext(), token)
+		if err != nil {
+			if errors.Is(err, ErrUnavailable) {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "Unable to verify token status"})
+			}
+			if errors.Is(err, ErrTokenRevoked) {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token has been revoked"})
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired token"})
+		}
+
+		// Service tokens name the services they are for; one minted for
+		// another service must not be replayed here.
+		if claims.IsService() && (m.cfg.Audience == "" || !claims.HasAudience(m.cfg.Audience)) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Token is not intended for this service"})
+		}
+
+		c.Locals("claims", claims)
+		c.Locals("principal", claims.Principal)
+		c.Locals("subject", claims.Subject)
+		c.Locals("userID", claims.UserID)
+		c.Locals("email", claims.Email)
+		c.Locals("username", claims.Username)
+		c.Locals("sessionID", claims.SessionID)
+		c.Locals("tokenID", claims.ID)
+		c.Locals("emailVerified", claims.EmailVerified)
+		c.Locals("clientID", claims.ClientID)
+		c.Locals("scopes", claims.Scopes)
+		c.Locals("personalAccessToken", claims.PersonalAccessToken)
+		c.Locals("roles", claims.Roles)
+		return c.Next()
+	}
+}
+
+// RequireScopes must run after Protect. It admits tokens granted every one of
+// the scopes, whoever they were issued to.
+func (m *Middleware) RequireScopes(scopes ...string) fiber.Handler {
+	required := strings.Join(scopes, " ")
+	return func(c *fiber.Ctx) error {
+		if claims := ClaimsFrom(c); claims == nil || !claims.HasScopes(scopes...) {
+			return insufficientScope(c, "This resource requires the scopes: "+required, required)
+		}
+		return c.Next()
+	}
+}
+
+// RequireRole must run after Protect. It admits users holding any of the
+// roles; service, OAuth client and personal access tokens carry none.
+func (m *Middleware) RequireRole(roles ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims := ClaimsFrom(c); claims != nil {
+			for _, role := range roles {
+				if claims.HasRole(role) {
+					return c.Next()
+				}
+			}
+		}
+		// A missing role is not a scope the client could ask for, so there
+		// is no insufficient_scope challenge.
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This resource requires the role: " + strings.Join(roles, " or ")})
+	}
+}
+
+// RequirePrincipal must run after Protect. It admits only tokens speaking for
+// the given kind of principal, PrincipalUser or PrincipalService.
+func (m *Middleware) RequirePrincipal(principal string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if claims := ClaimsFrom(c); claims == nil || claims.Principal != principal {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "This resource is only available to " + principal + " tokens"})
+		}
+		return c.Next()
+	}
+}
+
+// insufficientScope answers 403 with the RFC 6750 section 3 challenge, so
+// clients can tell a token lacking access from an invalid one.
+func insufficientScope(c *fiber.Ctx, description, scope string) error {
+	challenge := `Bearer error="insufficient_scope", error_description=` + quoteParam(description)
+	if scope != "" {
+		challenge += `, scope=` + quoteParam(scope)
+	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": description})
+}
+
+// quoteParam renders an auth-param value as an RFC 9110 quoted-string,
+// escaping quotes and backslashes and dropping control characters.
+func quoteParam(value string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range value {
+		switch {
+		case r == '"' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r == 0x7f:
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
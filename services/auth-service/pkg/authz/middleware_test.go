@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// tokens maps each test token to its claims.
+type tokens map[string]*Claims
+
+func (v tokens) Validate(_ context.Context, token string) (*Claims, error) {
+	claims, ok := v[token]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
+
+var testTokens = tokens{
+	"user":         {UserID: "user-1", Principal: PrincipalUser, Subject: "user-1", Scopes: []string{"account:read"}},
+	"admin":        {UserID: "user-2", Principal: PrincipalUser, Subject: "user-2", Roles: []string{"admin"}},
+	"service":      {ClientID: "billing", Principal: PrincipalService, Subject: "billing", Audience: []string{"workflows"}, Scopes: []string{"workflows:read"}},
+	"other-target": {ClientID: "billing", Principal: PrincipalService, Subject: "billing", Audience: []string{"mail"}, Scopes: []string{"workflows:read"}},
+}
+
+func serve(t *testing.T, m *Middleware, token string, handlers ...fiber.Handler) *http.Response {
+	t.Helper()
+	app := fiber.New()
+	handlers = append([]fiber.Handler{m.Protect()}, handlers...)
+	handlers = append(handlers, func(c *fiber.Ctx) error {
+		return c.SendStatus(http.StatusNoContent)
+	})
+	app.Get("/", handlers...)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestProtectServiceAudience(t *testing.T) {
+	tests := []struct {
+		name     string
+		audience string
+		token    string
+		want     int
+	}{
+		{"service token for this service", "workflows", "service", http.StatusNoContent},
+		{"service token for another service", "workflows", "other-target", http.StatusUnauthorized},
+		{"no audience configured", "", "service", http.StatusUnauthorized},
+		{"user tokens have no audience", "workflows", "user", http.StatusNoContent},
+		{"invalid token", "workflows", "forged", http.StatusUnauthorized},
+		{"no token", "workflows", "", http.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := serve(t, New(testTokens, Config{Audience: tc.audience}), tc.token)
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+		})
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	m := New(testTokens, Config{Audience: "workflows"})
+	tests := []struct {
+		name          string
+		token         string
+		scopes        []string
+		want          int
+		wantChallenge string
+	}{
+		{"granted", "user", []string{"account:read"}, http.StatusNoContent, ""},
+		{"service token granted", "service", []string{"workflows:read"}, http.StatusNoContent, ""},
+		{
+			"missing one of them", "user", []string{"account:read", "workflows:write"}, http.StatusForbidden,
+			`Bearer error="insufficient_scope", error_description="This resource requires the scopes: account:read workflows:write", scope="account:read workflows:write"`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := serve(t, m, tc.token, m.RequireScopes(tc.scopes...))
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+			if got := resp.Header.Get(fiber.HeaderWWWAuthenticate); got != tc.wantChallenge {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tc.wantChallenge)
+			}
+		})
+	}
+}
+
+func TestRequireRoleAndPrincipal(t *testing.T) {
+	m := New(testTokens, Config{Audience: "workflows"})
+	tests := []struct {
+		name    string
+		token   string
+		handler fiber.Handler
+		want    int
+	}{
+		{"role held", "admin", m.RequireRole("support", "admin"), http.StatusNoContent},
+		{"role missing", "user", m.RequireRole("admin"), http.StatusForbidden},
+		{"service tokens hold no role", "service", m.RequireRole("admin"), http.StatusForbidden},
+		{"user principal", "user", m.RequirePrincipal(PrincipalUser), http.StatusNoContent},
+		{"user token where a service is required", "user", m.RequirePrincipal(PrincipalService), http.StatusForbidden},
+		{"service principal", "service", m.RequirePrincipal(PrincipalService), http.StatusNoContent},
+		{"service token where a user is required", "service", m.RequirePrincipal(PrincipalUser), http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := serve(t, m, tc.token, tc.handler)
+			if resp.StatusCode != tc.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tc.want)
+			}
+			if resp.Header.Get(fiber.HeaderWWWAuthenticate) != "" {
+				t.Error("a missing role or principal must not send an insufficient_scope challenge")
+			}
+		})
+	}
+}
+
+func TestQuoteParam(t *testing.T) {
+	if got, want := quoteParam("a \"b\" \\c\r\n"), `"a \"b\" \\c"`; got != want {
+		t.Errorf("quoteParam = %s, want %s", got, want)
+	}
+}
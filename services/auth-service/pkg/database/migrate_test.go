@@ -0,0 +1,47 @@
+package database
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// TestMigrationsAreLoaded guards against files golang-migrate cannot parse,
+// which it skips without an error.
+func TestMigrationsAreLoaded(t *testing.T) {
+	entries, err := fs.ReadDir(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	loaded := 0
+	version, next := source.First()
+	for next == nil {
+		up, _, err := source.ReadUp(version)
+		if err != nil {
+			t.Fatalf("migration %d has no up file: %v", version, err)
+		}
+		up.Close()
+		down, _, err := source.ReadDown(version)
+		if err != nil {
+			t.Fatalf("migration %d has no down file: %v", version, err)
+		}
+		down.Close()
+		loaded += 2
+		version, next = source.Next(version)
+	}
+	if !errors.Is(next, fs.ErrNotExist) {
+		t.Fatal(next)
+	}
+	if loaded != len(entries) {
+		t.Fatalf("golang-migrate loaded %d of %d migration files; names must match NNN_name.up.sql or NNN_name.down.sql", loaded, len(entries))
+	}
+}
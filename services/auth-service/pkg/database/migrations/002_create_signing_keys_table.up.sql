@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS signing_keys (
+    id VARCHAR(100) PRIMARY KEY,
+    algorithm VARCHAR(20) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    activated_at TIMESTAMP,
+    retired_at TIMESTAMP,
+    expires_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_signing_keys_single_active ON signing_keys((TRUE)) WHERE activated_at IS NOT NULL AND retired_at IS NULL;
+CREATE UNIQUE INDEX idx_signing_keys_single_pending ON signing_keys((TRUE)) WHERE activated_at IS NULL;
+CREATE INDEX idx_signing_keys_expires_at ON signing_keys(expires_at);
@@ -0,0 +1,30 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS github_id VARCHAR(100) UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS google_id VARCHAR(100) UNIQUE;
+
+CREATE INDEX IF NOT EXISTS idx_users_github_id ON users(github_id);
+CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id);
+
+UPDATE users SET github_id = i.subject
+FROM user_identities i WHERE i.user_id = users.id AND i.provider = 'github';
+
+UPDATE users SET google_id = i.subject
+FROM user_identities i WHERE i.user_id = users.id AND i.provider = 'google';
+
+CREATE TABLE IF NOT EXISTS oidc_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_oidc_identities_user_id ON oidc_identities(user_id);
+
+INSERT INTO oidc_identities (user_id, provider, subject, email, created_at)
+SELECT user_id, provider, subject, email, linked_at FROM user_identities
+WHERE provider NOT IN ('github', 'google')
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS user_identities;
@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255),
+    profile JSONB NOT NULL DEFAULT '{}',
+    linked_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+INSERT INTO user_identities (user_id, provider, subject, email, linked_at)
+SELECT id, 'github', github_id, email, created_at FROM users WHERE github_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_identities (user_id, provider, subject, email, linked_at)
+SELECT id, 'google', google_id, email, created_at FROM users WHERE google_id IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+INSERT INTO user_identities (user_id, provider, subject, email, linked_at)
+SELECT user_id, provider, subject, email, created_at FROM oidc_identities
+ON CONFLICT DO NOTHING;
+
+DROP TABLE IF EXISTS oidc_identities;
+
+ALTER TABLE users DROP COLUMN IF EXISTS github_id;
+ALTER TABLE users DROP COLUMN IF EXISTS google_id;
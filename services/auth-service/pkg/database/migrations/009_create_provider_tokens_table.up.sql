@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS provider_tokens (
+    identity_id UUID PRIMARY KEY REFERENCES user_identities(id) ON DELETE CASCADE,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT,
+    scopes TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
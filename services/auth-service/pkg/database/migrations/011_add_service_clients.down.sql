@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_oauth_clients_service;
+
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS jwks;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS audiences;
+ALTER TABLE oauth_clients DROP COLUMN IF EXISTS service;
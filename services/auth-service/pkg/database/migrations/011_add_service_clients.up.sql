@@ -0,0 +1,5 @@
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS service BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS audiences TEXT NOT NULL DEFAULT '';
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS jwks TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_oauth_clients_service ON oauth_clients(service) WHERE service;